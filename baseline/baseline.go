@@ -0,0 +1,250 @@
+// Package baseline keeps an inventory of expected certificates, so that their
+// issuance is not reported.
+package baseline
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/source"
+)
+
+// Kind represents the hash an entry is keyed by.
+type Kind string
+
+const (
+	// CertSHA256 matches a single certificate.
+	CertSHA256 Kind = "cert_sha256"
+	// TBSSHA256 matches a certificate along with its precertificate.
+	TBSSHA256 Kind = "tbs_sha256"
+	// PubKeySHA256 matches any certificate for the same public key.
+	PubKeySHA256 Kind = "pubkey_sha256"
+)
+
+var (
+	// ErrUnknownKind is returned when an entry kind is not supported.
+	ErrUnknownKind = errors.New("unknown baseline entry kind")
+)
+
+// Entry represents an expected certificate.
+type Entry struct {
+	Kind   Kind   `json:"kind"`
+	SHA256 string `json:"sha256"`
+	// Subject, Names, NotAfter and Source describe the certificate the entry was imported from.
+	Subject  string    `json:"subject,omitempty"`
+	Names    []string  `json:"names,omitempty"`
+	NotAfter time.Time `json:"not_after,omitzero"`
+	Source   string    `json:"source,omitempty"`
+}
+
+// NewEntry returns an entry of the given kind for the certificate.
+func NewEntry(cert *x509.Certificate, kind Kind, src string) (Entry, error) {
+	issuance, err := source.NewIssuance(0, cert, nil, "")
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{
+		Kind:     kind,
+		Subject:  cert.Subject.String(),
+		Names:    cert.DNSNames,
+		NotAfter: cert.NotAfter.UTC(),
+		Source:   src,
+	}
+	switch kind {
+	case CertSHA256:
+		e.SHA256 = issuance.CertSHA256
+	case TBSSHA256:
+		e.SHA256 = issuance.TBSSHA256
+	case PubKeySHA256:
+		e.SHA256 = issuance.PubKeySHA256
+	default:
+		return Entry{}, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	return e, nil
+}
+
+// Baseline is an inventory of expected certificates.
+type Baseline struct {
+	Entries []Entry `json:"entries"`
+	index   map[Kind]map[string]int
+}
+
+// Load reads the baseline from filename. A baseline which does not exist yet,
+// or an empty filename, yields an empty baseline.
+func Load(filename string) (*Baseline, error) {
+	b := &Baseline{}
+	if filename == "" {
+		b.reindex()
+		return b, nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		b.reindex()
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	b.reindex()
+	return b, nil
+}
+
+func (b *Baseline) reindex() {
+	b.index = make(map[Kind]map[string]int)
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		e.SHA256 = strings.ToLower(e.SHA256)
+		if b.index[e.Kind] == nil {
+			b.index[e.Kind] = make(map[string]int)
+		}
+		b.index[e.Kind][e.SHA256] = i
+	}
+}
+
+// Len returns the number of entries in the baseline.
+func (b *Baseline) Len() int {
+	return len(b.Entries)
+}
+
+// Add adds entries to the baseline, skipping those already present.
+// It returns the number of entries added.
+func (b *Baseline) Add(entries ...Entry) int {
+	if b.index == nil {
+		b.reindex()
+	}
+	added := 0
+	for _, e := range entries {
+		e.SHA256 = strings.ToLower(e.SHA256)
+		if _, ok := b.index[e.Kind][e.SHA256]; ok {
+			continue
+		}
+		if b.index[e.Kind] == nil {
+			b.index[e.Kind] = make(map[string]int)
+		}
+		b.index[e.Kind][e.SHA256] = len(b.Entries)
+		b.Entries = append(b.Entries, e)
+		added++
+	}
+	return added
+}
+
+// Match returns the entry matching the issuance, if any.
+func (b *Baseline) Match(issuance api.Issuance) (Entry, bool) {
+	for kind, sha256 := range map[Kind]string{
+		CertSHA256:   issuance.CertSHA256,
+		TBSSHA256:    issuance.TBSSHA256,
+		PubKeySHA256: issuance.PubKeySHA256,
+	} {
+		if sha256 == "" {
+			continue
+		}
+		if i, ok := b.index[kind][strings.ToLower(sha256)]; ok {
+			return b.Entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Split separates expected issuances from unknown ones.
+func (b *Baseline) Split(issuances []api.Issuance) (unknown, expected []api.Issuance) {
+	for _, issuance := range issuances {
+		if _, ok := b.Match(issuance); ok {
+			expected = append(expected, issuance)
+			continue
+		}
+		unknown = append(unknown, issuance)
+	}
+	return unknown, expected
+}
+
+// Save writes the baseline to filename atomically.
+func (b *Baseline) Save(filename string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(dir, "baseline.*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(append(data, '\n')); err != nil {
+		tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// ParsePEM returns the end-entity certificates in PEM-encoded data.
+// CA certificates, such as intermediates bundled in a chain, and other
+// PEM blocks, such as private keys, are skipped.
+func ParsePEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if cert.IsCA {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// Import returns entries of the given kind for the certificates found in PEM files
+// at path. If path is a directory, files are looked up recursively, and files
+// without any certificate are skipped.
+func Import(path string, kind Kind) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		certs, err := ParsePEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, cert := range certs {
+			e, err := NewEntry(cert, kind, p)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,199 @@
+//go:build test
+// +build test
+
+package baseline
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCerts struct {
+	ca      *x509.Certificate
+	leaf    *x509.Certificate
+	precert *x509.Certificate
+	// renewal is issued for the same key as leaf.
+	renewal *x509.Certificate
+	// other is issued for another key.
+	other *x509.Certificate
+}
+
+func newTestCerts(t *testing.T) testCerts {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(tmpl, parent *x509.Certificate, pub *ecdsa.PublicKey) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(0, 0, 7),
+	}
+	ca := create(caTmpl, caTmpl, &caKey.PublicKey)
+	leafTmpl := func(serial int64, precert bool) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "www.example.com"},
+			DNSNames:     []string{"www.example.com"},
+			NotBefore:    time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:     time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if precert {
+			tmpl.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}, Critical: true, Value: []byte{0x05, 0x00}}}
+		}
+		return tmpl
+	}
+	return testCerts{
+		ca:      ca,
+		leaf:    create(leafTmpl(2, false), ca, &leafKey.PublicKey),
+		precert: create(leafTmpl(2, true), ca, &leafKey.PublicKey),
+		renewal: create(leafTmpl(3, false), ca, &leafKey.PublicKey),
+		other:   create(leafTmpl(4, false), ca, &otherKey.PublicKey),
+	}
+}
+
+func encodePEM(certs ...*x509.Certificate) []byte {
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return data
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	certs := newTestCerts(t)
+	cases := []struct {
+		kind     Kind
+		expected map[string]bool
+	}{
+		{
+			kind:     CertSHA256,
+			expected: map[string]bool{"leaf": true, "precert": false, "renewal": false, "other": false},
+		},
+		{
+			kind:     TBSSHA256,
+			expected: map[string]bool{"leaf": true, "precert": true, "renewal": false, "other": false},
+		},
+		{
+			kind:     PubKeySHA256,
+			expected: map[string]bool{"leaf": true, "precert": true, "renewal": true, "other": false},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(string(tc.kind), func(t *testing.T) {
+			t.Parallel()
+			b, err := Load("")
+			assert.NoError(t, err)
+			e, err := NewEntry(certs.leaf, tc.kind, "test")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, b.Add(e))
+			for name, cert := range map[string]*x509.Certificate{
+				"leaf":    certs.leaf,
+				"precert": certs.precert,
+				"renewal": certs.renewal,
+				"other":   certs.other,
+			} {
+				issuance, err := source.NewIssuance(0, cert, certs.ca, "")
+				assert.NoError(t, err)
+				_, ok := b.Match(issuance)
+				assert.Equal(t, tc.expected[name], ok, name)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+	certs := newTestCerts(t)
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	// Intermediates bundled in a chain are skipped.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fullchain.pem"), encodePEM(certs.leaf, certs.ca), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "other.crt"), encodePEM(certs.other), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600))
+
+	entries, err := Import(dir, TBSSHA256)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, TBSSHA256, entries[0].Kind)
+		assert.Equal(t, []string{"www.example.com"}, entries[0].Names)
+		assert.Equal(t, filepath.Join(dir, "fullchain.pem"), entries[0].Source)
+	}
+
+	single, err := Import(filepath.Join(dir, "sub", "other.crt"), CertSHA256)
+	assert.NoError(t, err)
+	assert.Len(t, single, 1)
+
+	_, err = Import(dir, "unknown")
+	assert.ErrorIs(t, err, ErrUnknownKind)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("broken")}), 0600))
+	_, err = Import(dir, TBSSHA256)
+	assert.Error(t, err)
+}
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+	certs := newTestCerts(t)
+	filename := filepath.Join(t.TempDir(), "sub", "baseline.json")
+	b, err := Load(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, b.Len())
+
+	e, err := NewEntry(certs.leaf, TBSSHA256, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Add(e, e))
+	assert.Equal(t, 0, b.Add(e))
+	assert.NoError(t, b.Save(filename))
+
+	b, err = Load(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{e}, b.Entries)
+	issuance, err := source.NewIssuance(0, certs.precert, certs.ca, "")
+	assert.NoError(t, err)
+	matched, ok := b.Match(issuance)
+	assert.True(t, ok)
+	assert.Equal(t, e, matched)
+
+	assert.NoError(t, os.WriteFile(filename, []byte("{"), 0600))
+	_, err = Load(filename)
+	assert.Error(t, err)
+}
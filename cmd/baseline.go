@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Hsn723/ct-monitor/baseline"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	baselineCmd = &cobra.Command{
+		Use:   "baseline",
+		Short: "manage the baseline of expected certificates",
+	}
+
+	baselineImportCmd = &cobra.Command{
+		Use:   "import PATH...",
+		Short: "add certificates from PEM files or directories to the baseline",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runBaselineImport,
+	}
+
+	baselineKind string
+)
+
+func init() {
+	baselineImportCmd.Flags().StringVar(&baselineKind, "kind", string(baseline.TBSSHA256), "hash to key entries by, one of cert_sha256, tbs_sha256 or pubkey_sha256")
+	baselineCmd.AddCommand(baselineImportCmd)
+	rootCmd.AddCommand(baselineCmd)
+}
+
+// importBaseline adds the certificates found at paths to the baseline stored in filename.
+// It returns the number of entries added and the size of the resulting baseline.
+func importBaseline(filename string, kind baseline.Kind, paths []string) (int, int, error) {
+	b, err := baseline.Load(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	added := 0
+	for _, path := range paths {
+		entries, err := baseline.Import(path, kind)
+		if err != nil {
+			return 0, 0, err
+		}
+		added += b.Add(entries...)
+	}
+	if err := b.Save(filename); err != nil {
+		return 0, 0, err
+	}
+	return added, b.Len(), nil
+}
+
+func runBaselineImport(cmd *cobra.Command, args []string) error {
+	conf, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	added, total, err := importBaseline(conf.BaselineConfig.Filename, baseline.Kind(baselineKind), args)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "added %d entries to %s, which now holds %d entries\n", added, conf.BaselineConfig.Filename, total)
+	return err
+}
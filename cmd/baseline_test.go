@@ -0,0 +1,76 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/baseline"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIssuancesBaseline(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	hist := history.NewBoltDB(filepath.Join(t.TempDir(), "history.db"))
+	r := newTestRunner(&config.Config{}, positions)
+	r.history = hist
+	r.baseline.Add(
+		baseline.Entry{Kind: baseline.TBSSHA256, SHA256: "AA"},
+		baseline.Entry{Kind: baseline.PubKeySHA256, SHA256: "cc"},
+	)
+	dc := config.DomainConfig{Name: "baseline.example.com"}
+	src := mockSource{
+		issuances: []api.Issuance{
+			{ID: 1, CertSHA256: "01", TBSSHA256: "aa"},
+			{ID: 2, CertSHA256: "02", TBSSHA256: "bb", PubKeySHA256: "cc"},
+			{ID: 3, CertSHA256: "03", TBSSHA256: "dd", PubKeySHA256: "ee"},
+		},
+	}
+	assert.NoError(t, r.checkIssuances(context.Background(), dc, src))
+
+	pending, err := positions.Pending()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, filter.Annotate([]api.Issuance{src.issuances[2]}), pending[0].Issuances)
+	}
+	records, err := hist.Query(history.Query{Domain: dc.Name})
+	assert.NoError(t, err)
+	verdicts := make(map[uint64]history.Verdict)
+	for _, rec := range records {
+		verdicts[rec.ID] = rec.Verdict
+	}
+	assert.Equal(t, map[uint64]history.Verdict{
+		1: history.VerdictExpected,
+		2: history.VerdictExpected,
+		3: history.VerdictReported,
+	}, verdicts)
+
+	// Nothing is reported when all issuances are expected.
+	r.baseline.Add(baseline.Entry{Kind: baseline.CertSHA256, SHA256: "03"})
+	dc = config.DomainConfig{Name: "expected.baseline.example.com"}
+	assert.NoError(t, r.checkIssuances(context.Background(), dc, src))
+	pending, err = positions.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func TestImportBaseline(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "baseline.json")
+	added, total, err := importBaseline(filename, baseline.TBSSHA256, []string{t.TempDir()})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, 0, total)
+	assert.FileExists(t, filename)
+
+	_, _, err = importBaseline(filename, baseline.TBSSHA256, []string{filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/cybozu-go/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	historyDateFormat = "2006-01-02"
+	tableOutput       = "table"
+	jsonOutput        = "json"
+)
+
+var (
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "query the history of observed certificate issuances",
+		Args:  cobra.NoArgs,
+		RunE:  runHistory,
+	}
+
+	historyQuery struct {
+		domain      string
+		name        string
+		issuer      string
+		since       string
+		until       string
+		annotations map[string]string
+		output      string
+	}
+
+	// ErrHistoryDisabled is returned when querying history while it is disabled.
+	ErrHistoryDisabled = errors.New("history is disabled, set history_config.enabled to record issuances")
+	// ErrUnknownOutput is returned when the output format is not supported.
+	ErrUnknownOutput = errors.New("unknown output format")
+)
+
+func init() {
+	historyCmd.Flags().StringVar(&historyQuery.domain, "domain", "", "configured domain the issuances were observed for")
+	historyCmd.Flags().StringVar(&historyQuery.name, "name", "", "glob pattern matched against DNS names, such as *.example.com")
+	historyCmd.Flags().StringVar(&historyQuery.issuer, "issuer", "", "substring of the issuer's name")
+	historyCmd.Flags().StringVar(&historyQuery.since, "since", "", "only show certificates valid from this date (YYYY-MM-DD or RFC 3339) onwards")
+	historyCmd.Flags().StringVar(&historyQuery.until, "until", "", "only show certificates valid from this date (YYYY-MM-DD or RFC 3339) at the latest")
+	historyCmd.Flags().StringToStringVar(&historyQuery.annotations, "annotation", nil, "annotation set by filters, as key=value, may be repeated")
+	historyCmd.Flags().StringVarP(&historyQuery.output, "output", "o", tableOutput, "output format, either table or json")
+	rootCmd.AddCommand(historyCmd)
+}
+
+// parseHistoryDate parses a date given either as YYYY-MM-DD or RFC 3339.
+// If endOfDay is set, dates without a time refer to the end of the day.
+func parseHistoryDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(historyDateFormat, s); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// recordHistory records the issuances of a page in the history database.
+// Errors are logged, as history is not essential to monitoring.
+// Reported issuances are those in the notifications, recorded along with their annotations.
+func (r *runner) recordHistory(dc config.DomainConfig, issuances, expected []api.Issuance, notifications []position.Notification, now time.Time) {
+	if len(issuances) == 0 {
+		return
+	}
+	isExpected := make(map[string]bool, len(expected))
+	for _, issuance := range expected {
+		isExpected[historyIssuanceKey(issuance)] = true
+	}
+	type report struct {
+		notificationID string
+		annotations    map[string]string
+	}
+	reported := make(map[string]report)
+	for _, n := range notifications {
+		for _, issuance := range n.Issuances {
+			reported[historyIssuanceKey(issuance.Issuance)] = report{
+				notificationID: n.ID,
+				annotations:    issuance.Annotations,
+			}
+		}
+	}
+	records := make([]history.Record, 0, len(issuances))
+	for _, issuance := range issuances {
+		rec := history.NewRecord(dc.Name, issuance, now)
+		key := historyIssuanceKey(issuance)
+		if isExpected[key] {
+			rec.Verdict = history.VerdictExpected
+		} else if report, ok := reported[key]; ok {
+			rec.Verdict = history.VerdictReported
+			rec.Status = history.StatusPending
+			rec.NotificationID = report.notificationID
+			rec.Annotations = report.annotations
+		}
+		records = append(records, rec)
+	}
+	if err := r.history.Record(records...); err != nil {
+		_ = log.Warn("failed to record history", map[string]interface{}{
+			"domain": dc.Name,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func historyIssuanceKey(issuance api.Issuance) string {
+	return strconv.FormatUint(issuance.ID, 10) + ":" + issuance.CertSHA256
+}
+
+func (r *runner) setHistoryStatus(notificationID string, status history.Status) {
+	if err := r.history.SetStatus(notificationID, status); err != nil {
+		_ = log.Warn("failed to record notification status in history", map[string]interface{}{
+			"id":    notificationID,
+			"error": err.Error(),
+		})
+	}
+}
+
+// releaseHistory closes the history database until the next run, so that it
+// can be queried between runs of ct-monitor serve.
+func (r *runner) releaseHistory() {
+	if err := r.history.Close(); err != nil {
+		_ = log.Warn("failed to close history database", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func writeHistoryTable(w io.Writer, records []history.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NOT BEFORE\tDOMAIN\tNAMES\tISSUER\tVERDICT\tSTATUS\tSHA256\tANNOTATIONS")
+	for _, r := range records {
+		issuer := r.IssuerFriendlyName
+		if issuer == "" {
+			issuer = r.Issuer
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.NotBefore.Format(time.RFC3339), r.Domain, strings.Join(r.Names, ","), issuer, r.Verdict, r.Status, r.CertSHA256, formatAnnotations(r.Annotations))
+	}
+	return tw.Flush()
+}
+
+// formatAnnotations formats annotations as key=value pairs sorted by key.
+func formatAnnotations(annotations map[string]string) string {
+	labels := make([]string, 0, len(annotations))
+	for _, k := range slices.Sorted(maps.Keys(annotations)) {
+		labels = append(labels, k+"="+annotations[k])
+	}
+	return strings.Join(labels, ",")
+}
+
+func writeHistory(w io.Writer, records []history.Record, output string) error {
+	switch output {
+	case tableOutput:
+		return writeHistoryTable(w, records)
+	case jsonOutput:
+		if records == nil {
+			records = []history.Record{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownOutput, output)
+	}
+}
+
+func runHistory(cmd *cobra.Command, _ []string) error {
+	conf, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+	if !conf.HistoryConfig.Enabled {
+		return ErrHistoryDisabled
+	}
+	since, err := parseHistoryDate(historyQuery.since, false)
+	if err != nil {
+		return err
+	}
+	until, err := parseHistoryDate(historyQuery.until, true)
+	if err != nil {
+		return err
+	}
+	records, err := conf.GetHistoryDB().Query(history.Query{
+		Domain:      historyQuery.domain,
+		NamePattern: historyQuery.name,
+		Issuer:      historyQuery.issuer,
+		Since:       since,
+		Until:       until,
+		Annotations: historyQuery.annotations,
+	})
+	if err != nil {
+		return err
+	}
+	return writeHistory(cmd.OutOrStdout(), records, historyQuery.output)
+}
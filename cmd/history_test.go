@@ -0,0 +1,108 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHistoryDate(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		date     string
+		endOfDay bool
+		expected time.Time
+		isErr    bool
+	}{
+		{title: "Empty", date: ""},
+		{title: "Date", date: "2026-03-01", expected: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{title: "EndOfDay", date: "2026-03-01", endOfDay: true, expected: time.Date(2026, 3, 1, 23, 59, 59, 999999999, time.UTC)},
+		{title: "RFC3339", date: "2026-03-01T12:00:00Z", endOfDay: true, expected: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{title: "Invalid", date: "yesterday", isErr: true},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := parseHistoryDate(tc.date, tc.endOfDay)
+			if tc.isErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.expected.Equal(actual), actual)
+		})
+	}
+}
+
+func TestWriteHistory(t *testing.T) {
+	t.Parallel()
+	rec := history.NewRecord("example.com", api.Issuance{
+		ID:         1,
+		Domains:    []string{"example.com", "www.example.com"},
+		NotBefore:  "2026-03-01T00:00:00Z",
+		CertSHA256: "aa",
+		Issuer:     api.Issuer{Name: "CN=R3", FriendlyName: "Let's Encrypt"},
+	}, time.Now())
+	rec.Annotations = map[string]string{"severity": "high", "owner": "payments"}
+	records := []history.Record{rec}
+	var buf bytes.Buffer
+	assert.NoError(t, writeHistory(&buf, records, tableOutput))
+	assert.Contains(t, buf.String(), "2026-03-01T00:00:00Z  example.com  example.com,www.example.com  Let's Encrypt  filtered  none    aa      owner=payments,severity=high")
+
+	buf.Reset()
+	assert.NoError(t, writeHistory(&buf, nil, jsonOutput))
+	assert.Equal(t, "[]\n", buf.String())
+
+	assert.ErrorIs(t, writeHistory(&buf, records, "yaml"), ErrUnknownOutput)
+}
+
+func TestHistoryRecording(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	hist := history.NewBoltDB(filepath.Join(t.TempDir(), "history.db"))
+	conf := &config.Config{
+		MailTemplate: config.MailTemplate{
+			Subject: config.DefaultSubjectTemplate,
+			Body:    config.DefaultBodyTemplate,
+		},
+	}
+	dc := config.DomainConfig{Name: "history.example.com"}
+	src := mockSource{
+		issuances: []api.Issuance{
+			{ID: 1, CertSHA256: "aa", NotBefore: "2026-03-01T00:00:00Z"},
+			{ID: 2, CertSHA256: "bb", NotBefore: "2026-03-02T00:00:00Z"},
+		},
+	}
+	r := newTestRunner(conf, positions)
+	r.history = hist
+	assert.NoError(t, r.checkIssuances(context.Background(), dc, src))
+	records, err := hist.Query(history.Query{Domain: dc.Name})
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	for _, rec := range records {
+		assert.Equal(t, history.VerdictReported, rec.Verdict)
+		assert.Equal(t, history.StatusPending, rec.Status)
+		assert.NotEmpty(t, rec.NotificationID)
+	}
+
+	r.deliverNotifications(context.Background(), time.Now())
+	records, err = hist.Query(history.Query{Domain: dc.Name})
+	assert.NoError(t, err)
+	for _, rec := range records {
+		assert.Equal(t, history.StatusSent, rec.Status)
+	}
+}
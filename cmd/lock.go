@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/cybozu-go/log"
+)
+
+// acquireRunLock acquires the run lock guarding the position store, according
+// to the lock policy. The returned context is derived from ctx and canceled with
+// position.ErrLockLost as cause if the lock is lost, so that checks and deliveries
+// stop before another process takes over. The returned function releases the lock.
+func acquireRunLock(ctx context.Context, conf *config.Config) (context.Context, func(), error) {
+	lc := conf.PositionConfig.Lock
+	switch lc.Policy {
+	case config.NoLockPolicy:
+		return ctx, func() {}, nil
+	case config.FailLockPolicy, config.WaitLockPolicy:
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", config.ErrUnknownLockPolicy, lc.Policy)
+	}
+	lock, err := conf.GetRunLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	wait := lc.Policy == config.WaitLockPolicy
+	acquireCtx := ctx
+	if wait && lc.Timeout > 0 {
+		var cancel context.CancelFunc
+		acquireCtx, cancel = context.WithTimeout(ctx, lc.Timeout)
+		defer cancel()
+	}
+	_ = log.Info("acquiring run lock", map[string]interface{}{
+		"policy": lc.Policy,
+	})
+	if err := position.Acquire(acquireCtx, lock, wait); err != nil {
+		return nil, nil, err
+	}
+	runCtx, unlock := holdRunLock(ctx, lock)
+	return runCtx, unlock, nil
+}
+
+// holdRunLock returns a context canceled with position.ErrLockLost as cause
+// if the acquired lock is lost, along with a function releasing the lock.
+func holdRunLock(ctx context.Context, lock position.Lock) (context.Context, func()) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	if l, ok := lock.(position.LosableLock); ok {
+		go func() {
+			select {
+			case <-runCtx.Done():
+			case <-l.Lost():
+				_ = log.Error("run lock lost, stopping", nil)
+				cancel(position.ErrLockLost)
+			}
+		}()
+	}
+	return runCtx, func() {
+		cancel(nil)
+		if err := lock.Unlock(); err != nil {
+			_ = log.Error("failed to release run lock", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+}
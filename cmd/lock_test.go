@@ -0,0 +1,92 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireRunLock(t *testing.T) {
+	t.Parallel()
+	newConf := func(filename string, policy config.LockPolicy) *config.Config {
+		return &config.Config{
+			PositionConfig: config.PositionConfig{
+				Store:    config.TOMLPositionStore,
+				Filename: filename,
+				Lock:     config.LockConfig{Policy: policy},
+			},
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "positions.toml")
+	_, unlock, err := acquireRunLock(context.Background(), newConf(filename, config.FailLockPolicy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, _, err = acquireRunLock(context.Background(), newConf(filename, config.FailLockPolicy))
+	assert.ErrorIs(t, err, position.ErrLocked)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = acquireRunLock(ctx, newConf(filename, config.WaitLockPolicy))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, noop, err := acquireRunLock(context.Background(), newConf(filename, config.NoLockPolicy))
+	assert.NoError(t, err)
+	noop()
+
+	_, _, err = acquireRunLock(context.Background(), newConf(filename, "hoge"))
+	assert.ErrorIs(t, err, config.ErrUnknownLockPolicy)
+
+	unlock()
+	_, unlock, err = acquireRunLock(context.Background(), newConf(filename, config.FailLockPolicy))
+	assert.NoError(t, err)
+	unlock()
+}
+
+type losableLock struct {
+	lost     chan struct{}
+	unlocked bool
+}
+
+func (l *losableLock) TryLock() error {
+	return nil
+}
+
+func (l *losableLock) Unlock() error {
+	l.unlocked = true
+	return nil
+}
+
+func (l *losableLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func TestHoldRunLock(t *testing.T) {
+	t.Parallel()
+	lock := &losableLock{lost: make(chan struct{})}
+	ctx, unlock := holdRunLock(context.Background(), lock)
+	assert.NoError(t, ctx.Err())
+	close(lock.lost)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not canceled after losing the lock")
+	}
+	assert.ErrorIs(t, context.Cause(ctx), position.ErrLockLost)
+	unlock()
+	assert.True(t, lock.unlocked)
+
+	lock = &losableLock{lost: make(chan struct{})}
+	ctx, unlock = holdRunLock(context.Background(), lock)
+	unlock()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.NotErrorIs(t, context.Cause(ctx), position.ErrLockLost)
+}
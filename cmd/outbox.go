@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/cybozu-go/log"
+)
+
+// outboxBackoff returns the delay before retrying a delivery which failed the given number of times.
+func outboxBackoff(oc config.OutboxConfig, attempts int) time.Duration {
+	d := oc.InitialBackoff
+	for i := 1; i < attempts && d < oc.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, oc.MaxBackoff)
+}
+
+// deliverNotifications delivers the notifications pending in the outbox which are due.
+// Due notifications for the same domain and mailer are coalesced into a single
+// report, so that a backlog fetched over several pages is not reported in as many
+// emails. Failed deliveries are rescheduled with exponential backoff.
+// Delivery stops when ctx is canceled, leaving remaining notifications pending.
+func (r *runner) deliverNotifications(ctx context.Context, now time.Time) {
+	pending, err := r.positions.Pending()
+	if err != nil {
+		_ = log.Error("failed to read outbox", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	due := make([]position.Notification, 0, len(pending))
+	for _, n := range pending {
+		if !n.NextAttempt.After(now) {
+			due = append(due, n)
+		}
+	}
+	for _, batch := range position.Coalesce(due) {
+		if ctx.Err() != nil {
+			break
+		}
+		r.deliverBatch(batch, now)
+	}
+	if err := r.positions.Flush(); err != nil {
+		_ = log.Error("failed to write outbox", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// deliverBatch delivers notifications sharing the same domain, mailer and warning
+// as a single report.
+func (r *runner) deliverBatch(batch []position.Notification, now time.Time) {
+	first := batch[0]
+	dc := config.DomainConfig{Name: first.Domain, Mailer: config.Mailer(first.Mailer)}
+	mailSender := getMailSenderForDomain(r.conf, dc, r.defaultMailSender)
+	tplVars := mailTemplateVars{
+		Domain:  first.Domain,
+		Warning: first.Warning,
+	}
+	for _, n := range batch {
+		tplVars.Issuances = append(tplVars.Issuances, n.Issuances...)
+	}
+	id := position.BatchID(batch)
+	if err := sendMail(mailSender, id, tplVars, r.conf.MailTemplate); err != nil {
+		for _, n := range batch {
+			r.rescheduleNotification(n, err, now)
+		}
+		return
+	}
+	for _, n := range batch {
+		r.setHistoryStatus(n.ID, history.StatusSent)
+		if err := r.positions.Ack(n.ID); err != nil {
+			_ = log.Error("failed to acknowledge notification", map[string]interface{}{
+				"id":    n.ID,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+func (r *runner) rescheduleNotification(n position.Notification, err error, now time.Time) {
+	n.Attempts++
+	n.LastError = err.Error()
+	n.NextAttempt = now.Add(outboxBackoff(r.conf.OutboxConfig, n.Attempts))
+	_ = log.Warn("failed to deliver notification, retrying later", map[string]interface{}{
+		"id":           n.ID,
+		"domain":       n.Domain,
+		"attempts":     n.Attempts,
+		"next_attempt": n.NextAttempt.Format(time.RFC3339),
+		"error":        err.Error(),
+	})
+	r.setHistoryStatus(n.ID, history.StatusRetrying)
+	if err := r.positions.Reschedule(n); err != nil {
+		_ = log.Error("failed to reschedule notification", map[string]interface{}{
+			"id":    n.ID,
+			"error": err.Error(),
+		})
+	}
+}
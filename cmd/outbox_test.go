@@ -0,0 +1,149 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMailer struct {
+	keys []string
+	err  error
+}
+
+func (m *recordingMailer) Init() error {
+	return nil
+}
+
+func (m *recordingMailer) Send(subject, body string) error {
+	return m.SendWithKey("", subject, body)
+}
+
+func (m *recordingMailer) SendWithKey(key, _, _ string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	t.Parallel()
+	oc := config.OutboxConfig{
+		InitialBackoff: time.Minute,
+		MaxBackoff:     10 * time.Minute,
+	}
+	cases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Minute},
+		{attempts: 2, expected: 2 * time.Minute},
+		{attempts: 4, expected: 8 * time.Minute},
+		{attempts: 5, expected: 10 * time.Minute},
+		{attempts: 100, expected: 10 * time.Minute},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, outboxBackoff(oc, tc.attempts), tc.attempts)
+	}
+}
+
+func TestDeliverNotifications(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dc := config.DomainConfig{Name: "outbox.example.com"}
+	key := getPositionKey(dc)
+	n := position.NewNotification(key, dc.Name, "", filter.Annotate([]api.Issuance{{ID: 1}}), now)
+	assert.NoError(t, positions.Commit(key, nil, n))
+
+	m := &recordingMailer{err: assert.AnError}
+	r := &runner{
+		conf: &config.Config{
+			MailTemplate: config.MailTemplate{
+				Subject: config.DefaultSubjectTemplate,
+				Body:    config.DefaultBodyTemplate,
+			},
+			OutboxConfig: config.OutboxConfig{
+				InitialBackoff: time.Minute,
+				MaxBackoff:     time.Hour,
+			},
+		},
+		positions:         positions,
+		history:           history.NoOpDB{},
+		defaultMailSender: m,
+	}
+
+	// Failed deliveries are kept in the outbox and rescheduled.
+	r.deliverNotifications(context.Background(), now)
+	pending, err := positions.Pending()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, n.ID, pending[0].ID)
+		assert.Equal(t, 1, pending[0].Attempts)
+		assert.Equal(t, assert.AnError.Error(), pending[0].LastError)
+		assert.True(t, now.Add(time.Minute).Equal(pending[0].NextAttempt))
+	}
+
+	// Notifications are not delivered before they are due.
+	m.err = nil
+	r.deliverNotifications(context.Background(), now.Add(30*time.Second))
+	assert.Empty(t, m.keys)
+
+	r.deliverNotifications(context.Background(), now.Add(time.Minute))
+	assert.Equal(t, []string{n.ID}, m.keys)
+	pending, err = positions.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDeliverNotificationsCoalesced(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dc := config.DomainConfig{Name: "pages.example.com"}
+	key := getPositionKey(dc)
+	other := config.DomainConfig{Name: "other.example.com"}
+	first := position.NewNotification(key, dc.Name, "", filter.Annotate([]api.Issuance{{ID: 1}}), now)
+	second := position.NewNotification(key, dc.Name, "", filter.Annotate([]api.Issuance{{ID: 2}}), now.Add(time.Second))
+	third := position.NewNotification(getPositionKey(other), other.Name, "", filter.Annotate([]api.Issuance{{ID: 3}}), now.Add(2*time.Second))
+	assert.NoError(t, positions.Commit(key, nil, first))
+	assert.NoError(t, positions.Commit(key, nil, second))
+	assert.NoError(t, positions.Commit(getPositionKey(other), nil, third))
+
+	m := &recordingMailer{}
+	r := &runner{
+		conf: &config.Config{
+			MailTemplate: config.MailTemplate{
+				Subject: config.DefaultSubjectTemplate,
+				Body:    config.DefaultBodyTemplate,
+			},
+		},
+		positions:         positions,
+		history:           history.NoOpDB{},
+		defaultMailSender: m,
+	}
+
+	// Nothing is delivered once the run is canceled, for instance when the run lock is lost.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.deliverNotifications(ctx, now.Add(time.Minute))
+	assert.Empty(t, m.keys)
+
+	// Pages of the same domain are reported at once.
+	r.deliverNotifications(context.Background(), now.Add(time.Minute))
+	assert.Equal(t, []string{position.BatchID([]position.Notification{first, second}), third.ID}, m.keys)
+	pending, err := positions.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/cybozu-go/log"
+)
+
+const (
+	positionFlagSeparator = ":"
+)
+
+// escapePositionName escapes a domain name for use in a position key.
+// Names are case-insensitive, and viper lowercases keys and splits them on dots,
+// so names are lowercased and any character other than [a-z0-9-] is hex-escaped
+// as _XX. This keeps the encoding collision-free.
+func escapePositionName(name string) string {
+	var b strings.Builder
+	for _, c := range []byte(strings.ToLower(strings.TrimSuffix(name, "."))) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "_%02x", c)
+	}
+	return b.String()
+}
+
+func flagValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// getPositionKey returns the position key for the domain, which includes the
+// query flags so that configurations differing only by flags do not share a position.
+func getPositionKey(dc config.DomainConfig) string {
+	return fmt.Sprintf("%s%sw%ds%d", escapePositionName(dc.Name), positionFlagSeparator, flagValue(dc.MatchWildcards), flagValue(dc.IncludeSubdomains))
+}
+
+// migratePositions moves positions stored under legacy keys to the keys returned
+// by getPositionKey, so that no issuance is skipped after upgrading.
+// A legacy key shared by several domains holds the position of whichever
+// domain was checked last, which may be ahead of the others, so it is not
+// migrated and those domains start from scratch.
+// Legacy keys are removed once migrated.
+func migratePositions(positions position.Store, domains []config.DomainConfig) error {
+	legacy := make(map[string][]config.DomainConfig)
+	for _, dc := range domains {
+		key := getDomainConfigName(dc.Name)
+		legacy[key] = append(legacy[key], dc)
+	}
+	migrated := false
+	for key, dcs := range legacy {
+		cursor, err := positions.Get(key)
+		if err != nil {
+			return err
+		}
+		if len(cursor) == 0 {
+			continue
+		}
+		if len(dcs) > 1 {
+			names := make([]string, 0, len(dcs))
+			for _, dc := range dcs {
+				names = append(names, dc.Name)
+			}
+			_ = log.Warn("legacy position shared by several domains, starting them from scratch", map[string]interface{}{
+				"key":     key,
+				"domains": names,
+			})
+			cursor = nil
+		}
+		for _, dc := range dcs {
+			newKey := getPositionKey(dc)
+			current, err := positions.Get(newKey)
+			if err != nil {
+				return err
+			}
+			if len(current) > 0 || cursor == nil {
+				continue
+			}
+			if err := positions.Set(newKey, cursor); err != nil {
+				return err
+			}
+			_ = log.Info("migrated legacy position", map[string]interface{}{
+				"domain": dc.Name,
+				"from":   key,
+				"to":     newKey,
+			})
+		}
+		if err := positions.Delete(key); err != nil {
+			return err
+		}
+		migrated = true
+	}
+	if !migrated {
+		return nil
+	}
+	return positions.Flush()
+}
@@ -0,0 +1,108 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPositionKey(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title  string
+		dc     config.DomainConfig
+		expect string
+	}{
+		{
+			title:  "Simple",
+			dc:     config.DomainConfig{Name: "example.com"},
+			expect: "example_2ecom:w0s0",
+		},
+		{
+			title:  "Flags",
+			dc:     config.DomainConfig{Name: "example.com", MatchWildcards: true, IncludeSubdomains: true},
+			expect: "example_2ecom:w1s1",
+		},
+		{
+			title:  "CaseAndTrailingDot",
+			dc:     config.DomainConfig{Name: "Example.COM."},
+			expect: "example_2ecom:w0s0",
+		},
+		{
+			title:  "Escaped",
+			dc:     config.DomainConfig{Name: "_dmarc.a-b.com"},
+			expect: "_5fdmarc_2ea-b_2ecom:w0s0",
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expect, getPositionKey(tc.dc))
+		})
+	}
+}
+
+func TestGetPositionKeyCollisions(t *testing.T) {
+	t.Parallel()
+	domains := []config.DomainConfig{
+		{Name: "a-b.com"},
+		{Name: "a.b-com"},
+		{Name: "a_2eb.com"},
+		{Name: "a.b.com"},
+		{Name: "a.b.com", MatchWildcards: true},
+		{Name: "a.b.com", IncludeSubdomains: true},
+	}
+	seen := make(map[string]string)
+	for _, dc := range domains {
+		key := getPositionKey(dc)
+		assert.NotContains(t, seen, key, "collision with %s", seen[key])
+		seen[key] = dc.Name
+	}
+}
+
+func TestMigratePositions(t *testing.T) {
+	positions, positionFile := newTestPositionStore(t)
+	// migrate.example.com and migrate-example.com share a legacy key.
+	shared := getDomainConfigName("migrate.example.com")
+	single := getDomainConfigName("single.migrate.example.com")
+	kept := getDomainConfigName("unknown.migrate.example.com")
+	renamed := config.DomainConfig{Name: "renamed.migrate.example.com", MatchWildcards: true}
+	upToDate := config.DomainConfig{Name: "single.migrate.example.com", MatchWildcards: true}
+	assert.NoError(t, positions.Set(shared, source.Cursor{source.DefaultCursorKey: 10, "log": 20}))
+	assert.NoError(t, positions.Set(single, source.Cursor{source.DefaultCursorKey: 30}))
+	assert.NoError(t, positions.Set(kept, source.Cursor{source.DefaultCursorKey: 40}))
+	assert.NoError(t, positions.Set(getPositionKey(upToDate), source.Cursor{source.DefaultCursorKey: 50}))
+	assert.NoError(t, positions.Set(getDomainConfigName(renamed.Name), source.Cursor{source.DefaultCursorKey: 60, "log": 70}))
+
+	domains := []config.DomainConfig{
+		{Name: "migrate.example.com"},
+		{Name: "migrate-example.com", IncludeSubdomains: true},
+		{Name: "single.migrate.example.com"},
+		upToDate,
+		renamed,
+	}
+	assert.NoError(t, migratePositions(positions, domains))
+	// Positions shared by several domains may belong to any of them, so they are dropped.
+	assert.Empty(t, getTestCursor(t, positions, getPositionKey(domains[0])))
+	assert.Empty(t, getTestCursor(t, positions, getPositionKey(domains[1])))
+	assert.Empty(t, getTestCursor(t, positions, getPositionKey(domains[2])))
+	assert.Equal(t, source.Cursor{source.DefaultCursorKey: 60, "log": 70}, getTestCursor(t, positions, getPositionKey(renamed)))
+	assert.Equal(t, source.Cursor{source.DefaultCursorKey: 50}, getTestCursor(t, positions, getPositionKey(upToDate)))
+	assert.Empty(t, getTestCursor(t, positions, shared))
+	assert.Empty(t, getTestCursor(t, positions, single))
+	assert.Equal(t, source.Cursor{source.DefaultCursorKey: 40}, getTestCursor(t, positions, kept))
+
+	written := viper.New()
+	written.SetConfigFile(positionFile)
+	assert.NoError(t, written.ReadInConfig())
+	assert.Equal(t, uint64(70), written.GetUint64(getPositionKey(renamed)+"@log"))
+	assert.False(t, written.IsSet(shared))
+	assert.False(t, written.IsSet(getPositionKey(domains[0])))
+}
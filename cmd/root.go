@@ -2,18 +2,24 @@ package cmd
 
 import (
 	"bytes"
-	"os"
-	"path/filepath"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/signal"
 	"strings"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/Hsn723/certspotter-client/api"
 	"github.com/Hsn723/ct-monitor/config"
 	"github.com/Hsn723/ct-monitor/filter"
 	"github.com/Hsn723/ct-monitor/mailer"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
 	"github.com/cybozu-go/log"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -21,10 +27,15 @@ var (
 		Use:   "ct-monitor",
 		Short: "ct-monitor queries the certspotter API for new certificate issuances",
 		RunE:  runRoot,
+
+		PersistentPreRunE: setLogFormat,
 	}
-	position = viper.New()
 
 	configFile string
+	logFormat  string
+
+	// ErrUnknownLogFormat is returned when the log format is not supported.
+	ErrUnknownLogFormat = errors.New("unknown log format")
 
 	version string
 	commit  string
@@ -34,43 +45,32 @@ var (
 
 type mailTemplateVars struct {
 	Domain    string
-	Issuances []api.Issuance
+	Issuances []filter.AnnotatedIssuance
+	Warning   string
 }
 
-func createFile(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
-		}
-		file, err := os.Create(path)
-		if err != nil {
-			return err
-		}
-		file.Close()
-	}
-	return nil
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", config.DefaultConfigFile, "path to configuration file")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "plain", "log format, one of plain, logfmt or json")
 }
 
-func initPosition(pc config.PositionConfig) {
-	position.SetConfigFile(pc.Filename)
-	if err := createFile(pc.Filename); err != nil {
-		_ = log.Critical(err.Error(), nil)
+// setLogFormat sets the format of logs, including those forwarded from plugins.
+func setLogFormat(_ *cobra.Command, _ []string) error {
+	switch logFormat {
+	case "plain":
+		log.DefaultLogger().SetFormatter(log.PlainFormat{})
+	case "logfmt":
+		log.DefaultLogger().SetFormatter(log.Logfmt{})
+	case "json":
+		log.DefaultLogger().SetFormatter(log.JSONFormat{})
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownLogFormat, logFormat)
 	}
-	if err := position.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			_ = log.Critical(err.Error(), nil)
-		}
-	}
-	_ = log.Info("using position file", map[string]interface{}{
-		"path": position.ConfigFileUsed(),
-	})
-	position.WatchConfig()
-}
-
-func init() {
-	rootCmd.Flags().StringVarP(&configFile, "config", "c", config.DefaultConfigFile, "path to configuration file")
+	return nil
 }
 
+// getDomainConfigName returns the legacy position key for the domain.
+// Use getPositionKey instead, as legacy keys are not collision-free.
 func getDomainConfigName(domain string) string {
 	return strings.ReplaceAll(domain, ".", "-")
 }
@@ -88,7 +88,7 @@ func getTemplatedMailContent(templateString string, vars mailTemplateVars) (stri
 	return buf.String(), nil
 }
 
-func sendMail(mailSender mailer.Mailer, tplVars mailTemplateVars, mt config.MailTemplate) error {
+func sendMail(mailSender mailer.Mailer, key string, tplVars mailTemplateVars, mt config.MailTemplate) error {
 	subject, err := getTemplatedMailContent(mt.Subject, tplVars)
 	if err != nil {
 		return err
@@ -100,23 +100,14 @@ func sendMail(mailSender mailer.Mailer, tplVars mailTemplateVars, mt config.Mail
 	_ = log.Info("sending report", map[string]interface{}{
 		"domain": tplVars.Domain,
 	})
-	return mailSender.Send(subject, body)
+	return mailer.SendWithKey(mailSender, key, subject, body)
 }
 
-func checkIssuances(dc config.DomainConfig, c api.CertspotterClient, mailSender mailer.Mailer, fc config.FilterConfig, mt config.MailTemplate) error {
-	key := getDomainConfigName(dc.Name)
-	lastIssuance := position.GetUint64(key)
-	issuances, err := c.GetIssuances(dc.Name, dc.MatchWildcards, dc.IncludeSubdomains, lastIssuance)
-	if err != nil {
-		return err
-	}
-	if len(issuances) == 0 {
-		_ = log.Info("no new issuances observed", map[string]interface{}{
-			"domain": dc.Name,
-		})
-		return nil
-	}
-	lastIssuance = issuances[len(issuances)-1].ID
+// filterPage applies the domain's filter chain to a single page of issuances.
+// Issuances are returned along with the annotations attached by filters.
+// When filters fail closed, all issuances are returned along with a warning
+// for recipients. When filters abort, an error is returned.
+func (r *runner) filterPage(dc config.DomainConfig, issuances []api.Issuance) ([]filter.AnnotatedIssuance, string, error) {
 	for _, issuance := range issuances {
 		_ = log.Info("observed issuance", map[string]interface{}{
 			"id":     issuance.ID,
@@ -124,66 +115,147 @@ func checkIssuances(dc config.DomainConfig, c api.CertspotterClient, mailSender
 			"sha256": issuance.Cert.SHA256,
 		})
 	}
-	issuances, err = filter.ApplyFilters(fc.Filters, issuances)
+	chain, err := r.getFilterChain(dc)
 	if err != nil {
-		_ = log.Info("errors encountered running filters", map[string]interface{}{
-			"error":   err.Error(),
-			"domain":  dc.Name,
-			"filters": fc.Filters,
+		_ = log.Error("could not compile filters, reporting all issuances", map[string]interface{}{
+			"error":  err.Error(),
+			"domain": dc.Name,
 		})
+		return filter.Annotate(issuances), "", nil
 	}
-	if len(issuances) == 0 {
-		position.Set(key, lastIssuance)
-		return nil
+	res, err := chain.FilterAnnotated(r.getFilterMetadata(dc), filter.Annotate(issuances))
+	switch {
+	case errors.Is(err, filter.ErrAborted):
+		return nil, "", fmt.Errorf("aborting check: %w", err)
+	case errors.Is(err, filter.ErrFailedClosed):
+		_ = log.Warn("filters failed closed, reporting all issuances", map[string]interface{}{
+			"error":  err.Error(),
+			"domain": dc.Name,
+		})
+		return res, "filters failed, issuances are reported unfiltered: " + err.Error(), nil
+	case err != nil:
+		_ = log.Warn("errors encountered running filters", map[string]interface{}{
+			"error":  err.Error(),
+			"domain": dc.Name,
+		})
 	}
-	tplVars := mailTemplateVars{
-		Domain:    dc.Name,
-		Issuances: issuances,
+	return res, "", nil
+}
+
+// newNotifications returns notifications for the issuances, one for each mailer
+// they are routed to, in order of appearance. The warning, if any, is sent along.
+func (r *runner) newNotifications(dc config.DomainConfig, key string, issuances []filter.AnnotatedIssuance, warning string, now time.Time) []position.Notification {
+	var mailers []config.Mailer
+	routed := make(map[config.Mailer][]filter.AnnotatedIssuance)
+	for _, issuance := range issuances {
+		m := r.conf.GetRouteMailer(dc, issuance.Annotations)
+		if _, ok := routed[m]; !ok {
+			mailers = append(mailers, m)
+		}
+		routed[m] = append(routed[m], issuance)
 	}
-	if err := sendMail(mailSender, tplVars, mt); err != nil {
-		return err
+	notifications := make([]position.Notification, 0, len(mailers))
+	for _, m := range mailers {
+		n := position.NewNotification(key, dc.Name, string(m), routed[m], now)
+		n.Warning = warning
+		notifications = append(notifications, n)
 	}
-	position.Set(key, lastIssuance)
-	_ = log.Info("done checking", map[string]interface{}{
-		"domain": dc.Name,
-	})
-	return nil
+	return notifications
 }
 
-func atomicWritePosition(pc config.PositionConfig) error {
-	tmpFile, err := os.CreateTemp(filepath.Dir(pc.Filename), "position.*.toml")
-	if err != nil {
-		return err
+// checkIssuances pages through new issuances for the domain until it is caught up
+// or the pagination budget is spent. For each page, issuances remaining after
+// filters are committed to the outbox along with the position, which is written
+// right away. Reports are sent out separately by deliverNotifications.
+// Issuances matching the baseline are expected, and neither filtered nor reported.
+// Every issuance observed is recorded in the history database.
+// Requests to the source, including retries, are given up when ctx is canceled.
+func (r *runner) checkIssuances(ctx context.Context, dc config.DomainConfig, src source.IssuanceSource) error {
+	key := getPositionKey(dc)
+	q := source.Query{
+		Domain:            dc.Name,
+		MatchWildcards:    dc.MatchWildcards,
+		IncludeSubdomains: dc.IncludeSubdomains,
 	}
-	if err := position.WriteConfigAs(tmpFile.Name()); err != nil {
-		return err
-	}
-	fi, err := tmpFile.Stat()
+	pc := r.conf.PaginationConfig
+	cursor, err := r.positions.Get(key)
 	if err != nil {
 		return err
 	}
-	if fi.Size() == 0 {
-		return nil
+	total := 0
+	for page := 1; ; page++ {
+		issuances, next, err := src.GetIssuances(ctx, q, cursor)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		unknown, expected := r.baseline.Split(issuances)
+		if len(expected) > 0 {
+			_ = log.Info("observed expected issuances", map[string]interface{}{
+				"domain":    dc.Name,
+				"issuances": len(expected),
+			})
+		}
+		var filtered []filter.AnnotatedIssuance
+		var warning string
+		var notifications []position.Notification
+		if len(issuances) == 0 {
+			_ = log.Info("no new issuances observed", map[string]interface{}{
+				"domain": dc.Name,
+			})
+		} else if len(unknown) > 0 {
+			filtered, warning, err = r.filterPage(dc, unknown)
+			if err != nil {
+				return err
+			}
+		}
+		if len(filtered) > 0 {
+			notifications = r.newNotifications(dc, key, filtered, warning, now)
+		}
+		if err := r.positions.Commit(key, next, notifications...); err != nil {
+			return err
+		}
+		r.recordHistory(dc, issuances, expected, notifications, now)
+		if err := r.positions.Flush(); err != nil {
+			return err
+		}
+		total += len(issuances)
+		// Sources scanning logs return empty pages while advancing through
+		// entries for other domains, so only a cursor which did not move
+		// means that the domain is caught up.
+		if maps.Equal(cursor, next) {
+			break
+		}
+		cursor = next
+		if (pc.MaxPages > 0 && page >= pc.MaxPages) || (pc.MaxIssuances > 0 && total >= pc.MaxIssuances) {
+			_ = log.Warn("pagination budget spent, resuming on next run", map[string]interface{}{
+				"domain":    dc.Name,
+				"pages":     page,
+				"issuances": total,
+			})
+			break
+		}
 	}
-	return os.Rename(tmpFile.Name(), pc.Filename)
+	_ = log.Info("done checking", map[string]interface{}{
+		"domain":    dc.Name,
+		"issuances": total,
+	})
+	return nil
 }
 
-func getMailSenderForDomain(conf *config.Config, dc config.DomainConfig, defaultMailSender mailer.Mailer) mailer.Mailer {
-	if dc.Mailer == "" {
-		return defaultMailSender
-	}
-	domainMailer := conf.GetMailer(dc.Mailer)
-	if err := domainMailer.Init(); err != nil {
-		_ = log.Error("could not initialize domain mailer, using default", map[string]interface{}{
-			"error":  err.Error(),
-			"domain": dc.Name,
-		})
-		return defaultMailSender
+func openPositionStore(conf *config.Config) (position.Store, error) {
+	positions, err := conf.GetPositionStore()
+	if err != nil {
+		return nil, err
 	}
-	return domainMailer
+	_ = log.Info("using position store", map[string]interface{}{
+		"store": conf.PositionConfig.Store,
+		"path":  conf.PositionConfig.Filename,
+	})
+	return positions, nil
 }
 
-func runRoot(_ *cobra.Command, _ []string) error {
+func loadConfig() (*config.Config, error) {
 	_ = log.Info("ct-monitor", map[string]interface{}{
 		"version":  version,
 		"commit":   commit,
@@ -192,30 +264,49 @@ func runRoot(_ *cobra.Command, _ []string) error {
 	})
 	conf, err := config.Load(configFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	_ = log.Info("loaded configuration", map[string]interface{}{
 		"config": configFile,
 	})
-	initPosition(conf.PositionConfig)
-	defaultMailSender := conf.GetMailer(conf.AlertConfig.Mailer)
-	if err := defaultMailSender.Init(); err != nil {
+	return conf, nil
+}
+
+func runRoot(_ *cobra.Command, _ []string) error {
+	conf, err := loadConfig()
+	if err != nil {
 		return err
 	}
-	csp := api.CertspotterClient{
-		Endpoint: conf.Endpoint,
-		Token:    conf.Token,
+	// Checks are interrupted on SIGTERM or SIGINT, keeping the progress made so far.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	ctx, unlock, err := acquireRunLock(ctx, conf)
+	if err != nil {
+		return err
 	}
-	for _, domain := range conf.Domains {
-		domainMailer := getMailSenderForDomain(conf, domain, defaultMailSender)
-		if err := checkIssuances(domain, csp, domainMailer, conf.FilterConfig, conf.MailTemplate); err != nil {
-			_ = log.Error(err.Error(), map[string]interface{}{
-				"domain": domain.Name,
-			})
-		}
+	defer unlock()
+	positions, err := openPositionStore(conf)
+	if err != nil {
+		return err
 	}
-
-	return atomicWritePosition(conf.PositionConfig)
+	defer positions.Close()
+	if err := migratePositions(positions, conf.Domains); err != nil {
+		return err
+	}
+	r, err := newRunner(conf, positions)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	r.checkDomains(ctx, conf.Domains)
+	r.deliverNotifications(ctx, time.Now())
+	if err := positions.Flush(); err != nil {
+		return err
+	}
+	if errors.Is(context.Cause(ctx), position.ErrLockLost) {
+		return position.ErrLockLost
+	}
+	return nil
 }
 
 // Execute runs the root command.
@@ -4,13 +4,22 @@
 package cmd
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/baseline"
 	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
 	"github.com/Hsn723/ct-monitor/mailer"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/cybozu-go/log"
 	smtpmock "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,6 +30,20 @@ func TestGetDomainConfigName(t *testing.T) {
 	assert.Equal(t, expect, actual)
 }
 
+func TestSetLogFormat(t *testing.T) {
+	defer func() {
+		logFormat = "plain"
+		assert.NoError(t, setLogFormat(nil, nil))
+	}()
+	for _, format := range []string{"plain", "logfmt", "json"} {
+		logFormat = format
+		assert.NoError(t, setLogFormat(nil, nil))
+		assert.Equal(t, format, log.DefaultLogger().Formatter().String())
+	}
+	logFormat = "yaml"
+	assert.ErrorIs(t, setLogFormat(nil, nil), ErrUnknownLogFormat)
+}
+
 func TestGetTemplatedMailContent(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -38,6 +61,27 @@ func TestGetTemplatedMailContent(t *testing.T) {
 			},
 			expect: "example.comの証明書発行",
 		},
+		{
+			title: "Annotations",
+			tmpl:  "{{range .Issuances}}{{.ID}}:{{with .Annotations.severity}}{{.}}{{end}} {{end}}",
+			vars: mailTemplateVars{
+				Domain: "example.com",
+				Issuances: []filter.AnnotatedIssuance{
+					{Issuance: api.Issuance{ID: 1}, Annotations: filter.Annotations{"severity": "high"}},
+					{Issuance: api.Issuance{ID: 2}},
+				},
+			},
+			expect: "1:high 2: ",
+		},
+		{
+			title: "Warning",
+			tmpl:  config.DefaultBodyTemplate,
+			vars: mailTemplateVars{
+				Domain:  "example.com",
+				Warning: "filters failed",
+			},
+			expect: "WARNING: filters failed\n\nct-monitor has observed the issuance of the following certificate for the example.com domain:\n",
+		},
 		{
 			title: "InvalidField",
 			tmpl:  "{{.Hoge}}の証明書発行",
@@ -75,7 +119,7 @@ func TestSendMail(t *testing.T) {
 	}
 	tmplVars := mailTemplateVars{
 		Domain: "example.com",
-		Issuances: []api.Issuance{
+		Issuances: filter.Annotate([]api.Issuance{
 			{
 				TBSSHA256: "db7c55f74732269c45fda91264003b2a25adc7ff2df687252f60772850449926",
 				Domains: []string{
@@ -109,13 +153,13 @@ func TestSendMail(t *testing.T) {
 
 				CertSHA256: "20cbc0d1e87ed1d71d3b84533667ef60f22fffee634108711376dec87a38d4e2",
 			},
-		},
+		}),
 	}
 	mt := config.MailTemplate{
 		Subject: config.DefaultSubjectTemplate,
 		Body:    config.DefaultBodyTemplate,
 	}
-	err = sendMail(mailer, tmplVars, mt)
+	err = sendMail(mailer, "test", tmplVars, mt)
 	assert.NoError(t, err)
 	var messageData string
 	assert.Eventually(t, func() bool {
@@ -138,3 +182,374 @@ func TestSendMail(t *testing.T) {
 		assert.Contains(t, messageData, expect)
 	}
 }
+
+func newTestPositionStore(t *testing.T) (*position.TOMLStore, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "positions.toml")
+	positions, err := position.NewTOMLStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { positions.Close() })
+	return positions, filename
+}
+
+func getTestCursor(t *testing.T, positions position.Store, key string) source.Cursor {
+	t.Helper()
+	cursor, err := positions.Get(key)
+	assert.NoError(t, err)
+	return cursor
+}
+
+func newTestRunner(conf *config.Config, positions position.Store) *runner {
+	return &runner{
+		conf:              conf,
+		positions:         positions,
+		history:           history.NoOpDB{},
+		baseline:          &baseline.Baseline{},
+		defaultMailSender: mailer.NoOpMailer{},
+		plugins:           filter.NewPool(),
+	}
+}
+
+func TestFilterPage(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	conf := &config.Config{
+		FilterConfig: config.FilterConfig{
+			Rules: []filter.Rule{{DNSNames: []string{"dev.*"}}},
+		},
+	}
+	r := newTestRunner(conf, positions)
+	issuances := []api.Issuance{
+		{ID: 1, Domains: []string{"www.example.com"}},
+		{ID: 2, Domains: []string{"dev.example.com"}},
+		{ID: 3, Domains: []string{"staging.example.com"}},
+	}
+	domainFilters := config.FilterConfig{
+		Expressions: []filter.CELRule{{Expression: `issuance.dns_names.exists(n, n.startsWith("staging."))`}},
+	}
+	failingPlugin := func(policy filter.FailurePolicy) config.DomainFilterConfig {
+		return config.DomainFilterConfig{FilterConfig: config.FilterConfig{
+			Plugins: []filter.Plugin{{Path: "/nonexistent", OnError: policy}},
+		}}
+	}
+	cases := []struct {
+		title    string
+		dc       config.DomainConfig
+		expected []uint64
+		warning  bool
+		isErr    bool
+	}{
+		{
+			title:    "Global",
+			dc:       config.DomainConfig{Name: "example.com"},
+			expected: []uint64{1, 3},
+		},
+		{
+			title: "Extend",
+			dc: config.DomainConfig{
+				Name:         "extend.example.com",
+				FilterConfig: config.DomainFilterConfig{FilterConfig: domainFilters},
+			},
+			expected: []uint64{1},
+		},
+		{
+			title: "Replace",
+			dc: config.DomainConfig{
+				Name:         "replace.example.com",
+				FilterConfig: config.DomainFilterConfig{FilterConfig: domainFilters, Mode: config.ReplaceFilterMode},
+			},
+			expected: []uint64{1, 2},
+		},
+		{
+			title: "Invalid",
+			dc: config.DomainConfig{
+				Name:         "invalid.example.com",
+				FilterConfig: config.DomainFilterConfig{Mode: "unknown"},
+			},
+			expected: []uint64{1, 2, 3},
+		},
+		{
+			title:    "FailOpen",
+			dc:       config.DomainConfig{Name: "open.example.com", FilterConfig: failingPlugin(filter.FailOpen)},
+			expected: []uint64{1, 3},
+		},
+		{
+			title:    "FailClosed",
+			dc:       config.DomainConfig{Name: "closed.example.com", FilterConfig: failingPlugin(filter.FailClosed)},
+			expected: []uint64{1, 2, 3},
+			warning:  true,
+		},
+		{
+			title: "Abort",
+			dc:    config.DomainConfig{Name: "abort.example.com", FilterConfig: failingPlugin(filter.Abort)},
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			res, warning, err := r.filterPage(tc.dc, issuances)
+			if tc.isErr {
+				assert.ErrorIs(t, err, filter.ErrAborted)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.warning, warning != "")
+			var actual []uint64
+			for _, issuance := range res {
+				actual = append(actual, issuance.ID)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestNewNotifications(t *testing.T) {
+	t.Parallel()
+	conf := &config.Config{
+		AlertConfig: config.AlertConfig{
+			Routes: []config.Route{
+				{Annotations: map[string]string{"severity": "high"}, Mailer: config.SMTPMailer},
+			},
+		},
+	}
+	r := newTestRunner(conf, nil)
+	dc := config.DomainConfig{Name: "example.com", Mailer: config.SendgridMailer}
+	issuances := []filter.AnnotatedIssuance{
+		{Issuance: api.Issuance{ID: 1}},
+		{Issuance: api.Issuance{ID: 2}, Annotations: filter.Annotations{"severity": "high"}},
+		{Issuance: api.Issuance{ID: 3}, Annotations: filter.Annotations{"severity": "low"}},
+	}
+	now := time.Now()
+	actual := r.newNotifications(dc, "key", issuances, "filters failed", now)
+	if !assert.Len(t, actual, 2) {
+		return
+	}
+	assert.Equal(t, string(config.SendgridMailer), actual[0].Mailer)
+	assert.Equal(t, []filter.AnnotatedIssuance{issuances[0], issuances[2]}, actual[0].Issuances)
+	assert.Equal(t, string(config.SMTPMailer), actual[1].Mailer)
+	assert.Equal(t, issuances[1:2], actual[1].Issuances)
+	assert.NotEqual(t, actual[0].ID, actual[1].ID)
+	for _, n := range actual {
+		assert.Equal(t, "filters failed", n.Warning)
+	}
+}
+
+type mockSource struct {
+	issuances []api.Issuance
+	cursor    source.Cursor
+	err       error
+}
+
+func (s mockSource) GetIssuances(_ context.Context, _ source.Query, _ source.Cursor) ([]api.Issuance, source.Cursor, error) {
+	return s.issuances, s.cursor, s.err
+}
+
+// scriptedSource returns the given pages in order, then the last one again.
+type scriptedSource struct {
+	pages []mockSource
+	calls int
+}
+
+func (s *scriptedSource) GetIssuances(ctx context.Context, q source.Query, cursor source.Cursor) ([]api.Issuance, source.Cursor, error) {
+	page := s.pages[min(s.calls, len(s.pages)-1)]
+	s.calls++
+	return page.GetIssuances(ctx, q, cursor)
+}
+
+// pagedSource returns issuances in pages of pageSize, following the cursor.
+// Issuance IDs are expected to start at 1 and be contiguous.
+type pagedSource struct {
+	issuances []api.Issuance
+	pageSize  int
+	calls     int
+}
+
+func (s *pagedSource) GetIssuances(_ context.Context, _ source.Query, cursor source.Cursor) ([]api.Issuance, source.Cursor, error) {
+	s.calls++
+	start := int(cursor[source.DefaultCursorKey])
+	end := min(start+s.pageSize, len(s.issuances))
+	page := s.issuances[start:end]
+	next := cursor.Clone()
+	if len(page) > 0 {
+		next[source.DefaultCursorKey] = page[len(page)-1].ID
+	}
+	return page, next, nil
+}
+
+func TestCheckIssuances(t *testing.T) {
+	cases := []struct {
+		title    string
+		domain   string
+		filters  config.DomainFilterConfig
+		src      source.IssuanceSource
+		expected source.Cursor
+		pending  int
+		isErr    bool
+	}{
+		{
+			title:    "NoIssuances",
+			domain:   "none.example.com",
+			src:      mockSource{cursor: source.Cursor{"log": 10}},
+			expected: source.Cursor{"log": 10},
+		},
+		{
+			title:  "Issuances",
+			domain: "some.example.com",
+			src: mockSource{
+				issuances: []api.Issuance{{ID: 3}, {ID: 4}},
+				cursor:    source.Cursor{source.DefaultCursorKey: 4},
+			},
+			expected: source.Cursor{source.DefaultCursorKey: 4},
+			pending:  1,
+		},
+		{
+			title:    "Error",
+			domain:   "error.example.com",
+			src:      mockSource{err: assert.AnError},
+			expected: source.Cursor{},
+			isErr:    true,
+		},
+		{
+			title:  "FilterAborted",
+			domain: "abort.example.com",
+			filters: config.DomainFilterConfig{FilterConfig: config.FilterConfig{
+				Plugins: []filter.Plugin{{Path: "/nonexistent", OnError: filter.Abort}},
+			}},
+			src: mockSource{
+				issuances: []api.Issuance{{ID: 3}},
+				cursor:    source.Cursor{source.DefaultCursorKey: 3},
+			},
+			expected: source.Cursor{},
+			isErr:    true,
+		},
+	}
+	positions, _ := newTestPositionStore(t)
+	conf := &config.Config{
+		MailTemplate: config.MailTemplate{
+			Subject: config.DefaultSubjectTemplate,
+			Body:    config.DefaultBodyTemplate,
+		},
+	}
+	r := newTestRunner(conf, positions)
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			dc := config.DomainConfig{Name: tc.domain, FilterConfig: tc.filters}
+			err := r.checkIssuances(context.Background(), dc, tc.src)
+			if tc.isErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			key := getPositionKey(dc)
+			assert.Equal(t, tc.expected, getTestCursor(t, positions, key))
+			pending, err := positions.Pending()
+			assert.NoError(t, err)
+			count := 0
+			for _, n := range pending {
+				if n.Key == key {
+					assert.Equal(t, tc.domain, n.Domain)
+					count++
+				}
+			}
+			assert.Equal(t, tc.pending, count)
+		})
+	}
+}
+
+func TestCheckIssuancesEmptyPages(t *testing.T) {
+	t.Parallel()
+	positions, _ := newTestPositionStore(t)
+	conf := &config.Config{
+		MailTemplate: config.MailTemplate{
+			Subject: config.DefaultSubjectTemplate,
+			Body:    config.DefaultBodyTemplate,
+		},
+	}
+	// Empty pages advancing the cursor do not stop paging.
+	src := &scriptedSource{pages: []mockSource{
+		{cursor: source.Cursor{"log": 100}},
+		{issuances: []api.Issuance{{ID: 5, CertSHA256: "05"}}, cursor: source.Cursor{"log": 200}},
+		{cursor: source.Cursor{"log": 200}},
+	}}
+	dc := config.DomainConfig{Name: "empty.example.com"}
+	assert.NoError(t, newTestRunner(conf, positions).checkIssuances(context.Background(), dc, src))
+	assert.Equal(t, 3, src.calls)
+	assert.Equal(t, source.Cursor{"log": 200}, getTestCursor(t, positions, getPositionKey(dc)))
+	pending, err := positions.Pending()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, uint64(5), pending[0].Issuances[0].ID)
+	}
+}
+
+func TestCheckIssuancesPagination(t *testing.T) {
+	var issuances []api.Issuance
+	for i := 1; i <= 10; i++ {
+		issuances = append(issuances, api.Issuance{ID: uint64(i)})
+	}
+	cases := []struct {
+		title          string
+		domain         string
+		pc             config.PaginationConfig
+		expectedCursor uint64
+		expectedCalls  int
+		expectedPages  int
+	}{
+		{
+			title:          "CaughtUp",
+			domain:         "caughtup.pagination.example.com",
+			expectedCursor: 10,
+			expectedCalls:  4,
+			expectedPages:  3,
+		},
+		{
+			title:          "MaxPages",
+			domain:         "maxpages.pagination.example.com",
+			pc:             config.PaginationConfig{MaxPages: 2},
+			expectedCursor: 8,
+			expectedCalls:  2,
+			expectedPages:  2,
+		},
+		{
+			title:          "MaxIssuances",
+			domain:         "maxissuances.pagination.example.com",
+			pc:             config.PaginationConfig{MaxIssuances: 5},
+			expectedCursor: 8,
+			expectedCalls:  2,
+			expectedPages:  2,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			positions, positionFile := newTestPositionStore(t)
+			conf := &config.Config{
+				PaginationConfig: tc.pc,
+				MailTemplate: config.MailTemplate{
+					Subject: config.DefaultSubjectTemplate,
+					Body:    config.DefaultBodyTemplate,
+				},
+			}
+			src := &pagedSource{issuances: issuances, pageSize: 4}
+			dc := config.DomainConfig{Name: tc.domain}
+			err := newTestRunner(conf, positions).checkIssuances(context.Background(), dc, src)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCalls, src.calls)
+			key := getPositionKey(dc)
+			assert.Equal(t, source.Cursor{source.DefaultCursorKey: tc.expectedCursor}, getTestCursor(t, positions, key))
+
+			written := viper.New()
+			written.SetConfigFile(positionFile)
+			assert.NoError(t, written.ReadInConfig())
+			assert.Equal(t, tc.expectedCursor, written.GetUint64(key))
+
+			// Each page with issuances is reported separately.
+			pending, err := positions.Pending()
+			assert.NoError(t, err)
+			assert.Len(t, pending, tc.expectedPages)
+		})
+	}
+}
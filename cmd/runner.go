@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/baseline"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
+	"github.com/Hsn723/ct-monitor/mailer"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/cybozu-go/log"
+)
+
+// runner holds the state shared by domain checks across runs.
+type runner struct {
+	conf              *config.Config
+	positions         position.Store
+	history           history.DB
+	baseline          *baseline.Baseline
+	defaultMailSender mailer.Mailer
+	// newSource instantiates issuance sources. Sources are instantiated once
+	// per run, so that caches of fetched entries are dropped after each run.
+	newSource func(config.Source) (source.IssuanceSource, error)
+	sources   map[config.Source]source.IssuanceSource
+	sourcesMu sync.Mutex
+	// clients holds the HTTP client of each source. Clients are kept for the
+	// lifetime of the runner, so that rate limits and retry budgets are not
+	// reset on each run.
+	clients map[config.Source]api.HTTPClient
+	// filters caches the filter chain of each domain, keyed by position key.
+	filters   map[string]filter.Chain
+	filtersMu sync.Mutex
+	// plugins keeps filter plugins running for the lifetime of the runner.
+	plugins *filter.Pool
+	// run describes the current run to filter plugins. It is set before domains are checked.
+	run filter.Run
+}
+
+func newRunner(conf *config.Config, positions position.Store) (*runner, error) {
+	defaultMailSender := conf.GetMailer(conf.AlertConfig.Mailer)
+	if err := defaultMailSender.Init(); err != nil {
+		return nil, err
+	}
+	expected, err := conf.GetBaseline()
+	if err != nil {
+		return nil, err
+	}
+	r := &runner{
+		conf:              conf,
+		positions:         positions,
+		history:           conf.GetHistoryDB(),
+		baseline:          expected,
+		defaultMailSender: defaultMailSender,
+		clients:           make(map[config.Source]api.HTTPClient),
+		plugins:           filter.NewPool(),
+	}
+	r.newSource = r.newConfiguredSource
+	return r, nil
+}
+
+// newConfiguredSource instantiates the source from the configuration, with
+// the HTTP client kept for the source. It is called with sourcesMu held.
+func (r *runner) newConfiguredSource(name config.Source) (source.IssuanceSource, error) {
+	client, ok := r.clients[name]
+	if !ok {
+		client = r.conf.GetSourceHTTPClient()
+		r.clients[name] = client
+	}
+	return r.conf.GetSource(name, client)
+}
+
+// close stops the filter plugins and closes the history database.
+func (r *runner) close() {
+	r.plugins.Close()
+	r.releaseHistory()
+}
+
+func getMailSenderForDomain(conf *config.Config, dc config.DomainConfig, defaultMailSender mailer.Mailer) mailer.Mailer {
+	if dc.Mailer == "" {
+		return defaultMailSender
+	}
+	domainMailer := conf.GetMailer(dc.Mailer)
+	if err := domainMailer.Init(); err != nil {
+		_ = log.Error("could not initialize domain mailer, using default", map[string]interface{}{
+			"error":  err.Error(),
+			"domain": dc.Name,
+		})
+		return defaultMailSender
+	}
+	return domainMailer
+}
+
+func (r *runner) getSourceName(dc config.DomainConfig) config.Source {
+	if dc.Source == "" {
+		return r.conf.SourceConfig.Source
+	}
+	return dc.Source
+}
+
+func (r *runner) getSourceForDomain(dc config.DomainConfig) (source.IssuanceSource, error) {
+	name := r.getSourceName(dc)
+	r.sourcesMu.Lock()
+	defer r.sourcesMu.Unlock()
+	if src, ok := r.sources[name]; ok {
+		return src, nil
+	}
+	src, err := r.newSource(name)
+	if err != nil {
+		return nil, err
+	}
+	r.sources[name] = src
+	return src, nil
+}
+
+func (r *runner) getFilterChain(dc config.DomainConfig) (filter.Chain, error) {
+	key := getPositionKey(dc)
+	r.filtersMu.Lock()
+	defer r.filtersMu.Unlock()
+	if chain, ok := r.filters[key]; ok {
+		return chain, nil
+	}
+	chain, err := r.conf.GetFilterChain(dc, r.plugins)
+	if err != nil {
+		return nil, err
+	}
+	if r.filters == nil {
+		r.filters = make(map[string]filter.Chain)
+	}
+	r.filters[key] = chain
+	return chain, nil
+}
+
+// getFilterMetadata describes the domain and the current run to filters.
+func (r *runner) getFilterMetadata(dc config.DomainConfig) filter.Metadata {
+	return filter.Metadata{
+		Domain: filter.Domain{
+			Name:              dc.Name,
+			MatchWildcards:    dc.MatchWildcards,
+			IncludeSubdomains: dc.IncludeSubdomains,
+			Source:            string(r.getSourceName(dc)),
+		},
+		Run: r.run,
+	}
+}
+
+// checkDomain checks a single domain for new issuances. Errors are logged,
+// and false is returned if the check failed. Interrupted checks are not failures.
+func (r *runner) checkDomain(ctx context.Context, dc config.DomainConfig) bool {
+	src, err := r.getSourceForDomain(dc)
+	if err != nil {
+		_ = log.Error(err.Error(), map[string]interface{}{
+			"domain": dc.Name,
+		})
+		return false
+	}
+	if err := r.checkIssuances(ctx, dc, src); err != nil {
+		if ctx.Err() != nil {
+			_ = log.Warn("check interrupted, resuming on next run", map[string]interface{}{
+				"domain": dc.Name,
+			})
+			return true
+		}
+		_ = log.Error(err.Error(), map[string]interface{}{
+			"domain": dc.Name,
+		})
+		return false
+	}
+	return true
+}
+
+// reloadBaseline reloads the baseline of expected certificates, so that imports
+// are taken into account without restarting. The current baseline is kept on errors.
+func (r *runner) reloadBaseline() {
+	expected, err := r.conf.GetBaseline()
+	if err != nil {
+		_ = log.Error("failed to reload baseline, using the current one", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	r.baseline = expected
+}
+
+// checkDomains checks domains concurrently, up to the configured concurrency.
+// Domains not yet started when the context is canceled are skipped, and
+// requests of domains being checked are given up. The number of failed checks is returned.
+func (r *runner) checkDomains(ctx context.Context, domains []config.DomainConfig) int {
+	r.reloadBaseline()
+	r.run = filter.Run{
+		StartedAt: time.Now().UTC(),
+		Version:   version,
+	}
+	r.sourcesMu.Lock()
+	r.sources = make(map[config.Source]source.IssuanceSource)
+	r.sourcesMu.Unlock()
+	jobs := make(chan config.DomainConfig)
+	var failed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < max(r.conf.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dc := range jobs {
+				if !r.checkDomain(ctx, dc) {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	for _, dc := range domains {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case jobs <- dc:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return int(failed.Load())
+}
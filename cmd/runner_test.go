@@ -0,0 +1,129 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/stretchr/testify/assert"
+)
+
+type concurrencySource struct {
+	mu       sync.Mutex
+	domains  []string
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func (s *concurrencySource) GetIssuances(_ context.Context, q source.Query, cursor source.Cursor) ([]api.Issuance, source.Cursor, error) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		m := s.maxSeen.Load()
+		if n <= m || s.maxSeen.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	if _, ok := cursor[source.DefaultCursorKey]; ok {
+		return nil, cursor, nil
+	}
+	time.Sleep(50 * time.Millisecond)
+	s.mu.Lock()
+	s.domains = append(s.domains, q.Domain)
+	s.mu.Unlock()
+	return []api.Issuance{{ID: 1}}, source.Cursor{source.DefaultCursorKey: 1}, nil
+}
+
+func TestCheckDomains(t *testing.T) {
+	src := &concurrencySource{}
+	conf := &config.Config{Concurrency: 3}
+	positions, _ := newTestPositionStore(t)
+	var expected []string
+	for i := 0; i < 9; i++ {
+		name := fmt.Sprintf("d%d.concurrency.example.com", i)
+		conf.Domains = append(conf.Domains, config.DomainConfig{Name: name})
+		expected = append(expected, name)
+	}
+	r := newTestRunner(conf, positions)
+	r.newSource = func(config.Source) (source.IssuanceSource, error) {
+		return src, nil
+	}
+	assert.Equal(t, 0, r.checkDomains(context.Background(), conf.Domains))
+	assert.ElementsMatch(t, expected, src.domains)
+	assert.Equal(t, int32(3), src.maxSeen.Load())
+	for _, name := range expected {
+		assert.Equal(t, source.Cursor{source.DefaultCursorKey: 1}, getTestCursor(t, positions, getPositionKey(config.DomainConfig{Name: name})))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src.domains = nil
+	assert.Equal(t, 0, r.checkDomains(ctx, conf.Domains))
+	assert.Empty(t, src.domains)
+
+	r.newSource = func(config.Source) (source.IssuanceSource, error) {
+		return nil, config.ErrUnknownSource
+	}
+	assert.Equal(t, len(conf.Domains), r.checkDomains(context.Background(), conf.Domains))
+}
+
+func TestGetFilterMetadata(t *testing.T) {
+	t.Parallel()
+	conf := &config.Config{SourceConfig: config.SourceConfig{Source: config.CertspotterSource}}
+	r := newTestRunner(conf, nil)
+	r.run = filter.Run{StartedAt: time.Now(), Version: "1.2.3"}
+	cases := []struct {
+		title    string
+		dc       config.DomainConfig
+		expected filter.Domain
+	}{
+		{
+			title:    "DefaultSource",
+			dc:       config.DomainConfig{Name: "example.com", MatchWildcards: true},
+			expected: filter.Domain{Name: "example.com", MatchWildcards: true, Source: "certspotter"},
+		},
+		{
+			title:    "DomainSource",
+			dc:       config.DomainConfig{Name: "example.jp", IncludeSubdomains: true, Source: config.CrtshSource},
+			expected: filter.Domain{Name: "example.jp", IncludeSubdomains: true, Source: "crtsh"},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual := r.getFilterMetadata(tc.dc)
+			assert.Equal(t, filter.Metadata{Domain: tc.expected, Run: r.run}, actual)
+		})
+	}
+}
+
+func TestNewConfiguredSource(t *testing.T) {
+	t.Parallel()
+	conf := &config.Config{
+		SourceConfig: config.SourceConfig{RateLimit: config.RateLimit{Rate: 1, Burst: 1}},
+	}
+	positions, _ := newTestPositionStore(t)
+	r := newTestRunner(conf, positions)
+	r.clients = make(map[config.Source]api.HTTPClient)
+	first, err := r.newConfiguredSource(config.CertspotterSource)
+	assert.NoError(t, err)
+	second, err := r.newConfiguredSource(config.CertspotterSource)
+	assert.NoError(t, err)
+	// The rate limiter of a source is kept across runs.
+	assert.NotSame(t, first, second)
+	assert.Same(t, first.(*source.CertspotterSource).Client.Client, second.(*source.CertspotterSource).Client.Client)
+	other, err := r.newConfiguredSource(config.CrtshSource)
+	assert.NoError(t, err)
+	assert.NotSame(t, first.(*source.CertspotterSource).Client.Client, other.(*source.CrtshSource).Client)
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/cybozu-go/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	healthPath      = "/healthz"
+	shutdownTimeout = 10 * time.Second
+)
+
+// ErrChecksFailed is reported by the health check endpoint when every domain
+// checked in the last round failed.
+var ErrChecksFailed = errors.New("every domain check failed")
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "run ct-monitor as a daemon, periodically querying for new certificate issuances",
+	RunE:  runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+// schedule keeps track of when each domain is next due for a check.
+type schedule struct {
+	intervals []time.Duration
+	next      []time.Time
+}
+
+func newSchedule(conf *config.Config, now time.Time) *schedule {
+	s := &schedule{
+		intervals: make([]time.Duration, len(conf.Domains)),
+		next:      make([]time.Time, len(conf.Domains)),
+	}
+	for i, dc := range conf.Domains {
+		s.intervals[i] = conf.GetInterval(dc)
+		s.next[i] = now
+	}
+	return s
+}
+
+// due returns the indexes of the domains due for a check and reschedules them.
+func (s *schedule) due(now time.Time) []int {
+	var res []int
+	for i, next := range s.next {
+		if now.Before(next) {
+			continue
+		}
+		res = append(res, i)
+		s.next[i] = now.Add(s.intervals[i])
+	}
+	return res
+}
+
+// wait returns the duration until the next domain is due for a check.
+func (s *schedule) wait(now time.Time) time.Duration {
+	var res time.Duration = -1
+	for _, next := range s.next {
+		if d := next.Sub(now); res < 0 || d < res {
+			res = d
+		}
+	}
+	return max(res, 0)
+}
+
+// healthStatus reports the state of the daemon on the health check endpoint.
+// The daemon is unhealthy if the run lock was lost, or if the last round of
+// checks failed, in which case 503 is returned so that it can be restarted.
+type healthStatus struct {
+	mu      sync.Mutex
+	started time.Time
+	lastRun time.Time
+	lastErr error
+	// ctx is the context of the daemon, canceled with ErrLockLost if the run lock is lost.
+	ctx context.Context
+}
+
+func (h *healthStatus) setLastRun(t time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastRun = t
+	h.lastErr = err
+}
+
+func (h *healthStatus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := map[string]interface{}{
+		"status":  "ok",
+		"started": h.started,
+	}
+	if !h.lastRun.IsZero() {
+		res["last_run"] = h.lastRun
+	}
+	err := h.lastErr
+	if h.ctx != nil && errors.Is(context.Cause(h.ctx), position.ErrLockLost) {
+		err = position.ErrLockLost
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		res["status"] = "error"
+		res["error"] = err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func startHealthServer(addr string, h *healthStatus) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(healthPath, h)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = log.Error("health check server stopped", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+	return server
+}
+
+// serve checks domains as they become due until the context is canceled.
+func serve(ctx context.Context, r *runner, conf *config.Config, h *healthStatus) error {
+	s := newSchedule(conf, time.Now())
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = log.Info("shutting down", nil)
+			if err := r.positions.Flush(); err != nil {
+				return err
+			}
+			if errors.Is(context.Cause(ctx), position.ErrLockLost) {
+				return position.ErrLockLost
+			}
+			return nil
+		case <-timer.C:
+		}
+		now := time.Now()
+		var due []config.DomainConfig
+		for _, i := range s.due(now) {
+			due = append(due, conf.Domains[i])
+		}
+		var tickErr error
+		if failed := r.checkDomains(ctx, due); failed > 0 && failed == len(due) {
+			tickErr = ErrChecksFailed
+		}
+		r.deliverNotifications(ctx, time.Now())
+		r.releaseHistory()
+		if err := r.positions.Flush(); err != nil {
+			_ = log.Error("failed to write positions", map[string]interface{}{
+				"error": err.Error(),
+			})
+			tickErr = err
+		}
+		h.setLastRun(now, tickErr)
+		timer.Reset(s.wait(time.Now()))
+	}
+}
+
+func runServe(_ *cobra.Command, _ []string) error {
+	conf, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	// The run lock is held for as long as the daemon runs, which stops if it is lost.
+	ctx, unlock, err := acquireRunLock(ctx, conf)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	positions, err := openPositionStore(conf)
+	if err != nil {
+		return err
+	}
+	defer positions.Close()
+	if err := migratePositions(positions, conf.Domains); err != nil {
+		return err
+	}
+	r, err := newRunner(conf, positions)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	h := &healthStatus{started: time.Now(), ctx: ctx}
+	if conf.ServeConfig.HealthAddress != "" {
+		server := startHealthServer(conf.ServeConfig.HealthAddress, h)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+	}
+	return serve(ctx, r, conf, h)
+}
@@ -0,0 +1,107 @@
+//go:build test
+// +build test
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/config"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	t.Parallel()
+	conf := &config.Config{
+		Domains: []config.DomainConfig{
+			{Name: "example.com"},
+			{Name: "example.jp", Interval: 10 * time.Minute},
+		},
+		ServeConfig: config.ServeConfig{Interval: time.Hour},
+	}
+	now := time.Now()
+	s := newSchedule(conf, now)
+	assert.Equal(t, []int{0, 1}, s.due(now))
+	assert.Equal(t, 10*time.Minute, s.wait(now))
+	assert.Empty(t, s.due(now.Add(5*time.Minute)))
+	assert.Equal(t, []int{1}, s.due(now.Add(10*time.Minute)))
+	assert.Equal(t, 5*time.Minute, s.wait(now.Add(15*time.Minute)))
+	assert.Equal(t, []int{0, 1}, s.due(now.Add(time.Hour)))
+	assert.Equal(t, time.Duration(0), s.wait(now.Add(2*time.Hour)))
+}
+
+func TestHealthStatus(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	h := &healthStatus{started: time.Now(), ctx: ctx}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "last_run")
+
+	h.setLastRun(time.Now(), nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "last_run")
+
+	h.setLastRun(time.Now(), ErrChecksFailed)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrChecksFailed.Error())
+
+	h.setLastRun(time.Now(), nil)
+	cancel(position.ErrLockLost)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), position.ErrLockLost.Error())
+}
+
+type countingSource struct {
+	calls chan string
+}
+
+func (s countingSource) GetIssuances(_ context.Context, q source.Query, cursor source.Cursor) ([]api.Issuance, source.Cursor, error) {
+	s.calls <- q.Domain
+	return nil, cursor, nil
+}
+
+func TestServe(t *testing.T) {
+	src := countingSource{calls: make(chan string, 10)}
+	conf := &config.Config{
+		Domains: []config.DomainConfig{
+			{Name: "serve.example.com"},
+		},
+		ServeConfig: config.ServeConfig{Interval: time.Hour},
+	}
+	positions, _ := newTestPositionStore(t)
+	r := newTestRunner(conf, positions)
+	r.newSource = func(config.Source) (source.IssuanceSource, error) {
+		return src, nil
+	}
+	h := &healthStatus{started: time.Now()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- serve(ctx, r, conf, h)
+	}()
+	assert.Equal(t, "serve.example.com", <-src.calls)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not return after cancellation")
+	}
+	assert.Empty(t, src.calls)
+}
@@ -1,21 +1,55 @@
 package config
 
 import (
+	"fmt"
+	"net/http"
+	"os"
 	"reflect"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/baseline"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
 	"github.com/Hsn723/ct-monitor/mailer"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/cybozu-go/log"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
-	DefaultConfigFile          = "/etc/ct-monitor/config.toml"
-	defaultPositionFile        = "/var/log/ct-monitor/positions.toml"
-	defaultMailer              = NoOpMailer
-	defaultCertspotterEndpoint = "https://api.certspotter.com/v1/issuances"
-	certspotterTokenEnv        = "CERTSPOTTER_TOKEN"
-	DefaultSubjectTemplate     = "Certificate Transparency Notification for {{.Domain}}"
-	DefaultBodyTemplate        = `ct-monitor has observed the issuance of the following certificate{{ if gt (len .Issuances) 1}}s{{end}} for the {{.Domain}} domain:
+	DefaultConfigFile           = "/etc/ct-monitor/config.toml"
+	defaultPositionFile         = "/var/log/ct-monitor/positions.toml"
+	defaultHistoryFile          = "/var/log/ct-monitor/history.db"
+	defaultBaselineFile         = "/var/log/ct-monitor/baseline.json"
+	defaultMailer               = NoOpMailer
+	defaultPositionStore        = TOMLPositionStore
+	defaultPositionConfigMap    = "ct-monitor-positions"
+	defaultLockPolicy           = FailLockPolicy
+	defaultLockTimeout          = 10 * time.Minute
+	defaultLockLeaseDuration    = time.Minute
+	defaultSource               = CertspotterSource
+	defaultInterval             = time.Hour
+	defaultHealthAddress        = ":8080"
+	defaultConcurrency          = 1
+	defaultRetryMaxAttempts     = 5
+	defaultRetryInitialBackoff  = time.Second
+	defaultRetryMaxBackoff      = time.Minute
+	defaultRetryBudget          = 10 * time.Minute
+	defaultMaxPages             = 10
+	defaultOutboxInitialBackoff = time.Minute
+	defaultOutboxMaxBackoff     = time.Hour
+	defaultCertspotterEndpoint  = "https://api.certspotter.com/v1/issuances"
+	certspotterTokenEnv         = "CERTSPOTTER_TOKEN"
+	DefaultSubjectTemplate      = "Certificate Transparency Notification for {{.Domain}}"
+	DefaultBodyTemplate         = `{{with .Warning}}WARNING: {{.}}
+
+{{end}}ct-monitor has observed the issuance of the following certificate{{ if gt (len .Issuances) 1}}s{{end}} for the {{.Domain}} domain:
 {{range .Issuances}}
 Issuer Friendly Name: {{.Issuer.FriendlyName}}
 Issuer Distinguished Name: {{.Issuer.Name}}
@@ -38,20 +72,43 @@ type Config struct {
 	// Token is the token used for interacting with the CertSpotter API.
 	// This can also be provided via the CERTSPOTTER_TOKEN environment variable.
 	Token string `mapstructure:"certspotter_token"`
+	// Concurrency is the maximum number of domains checked concurrently.
+	// This defaults to 1.
+	Concurrency int `mapstructure:"concurrency"`
+	// SourceConfig represents the configuration for issuance sources.
+	SourceConfig SourceConfig `mapstructure:"source_config"`
+	// RetryConfig represents the retry policy for source requests.
+	RetryConfig RetryConfig `mapstructure:"retry_config"`
+	// PaginationConfig represents the per-domain budget for catching up on backlogs.
+	PaginationConfig PaginationConfig `mapstructure:"pagination_config"`
+	// CTLog represents the source configuration for tailing RFC 6962 CT logs directly.
+	CTLog source.CTLogSource `mapstructure:"ctlog"`
+	// StaticCT represents the source configuration for tailing Static CT API logs directly.
+	StaticCT source.StaticCTSource `mapstructure:"staticct"`
+	// Crtsh represents the source configuration for querying a crt.sh-compatible endpoint.
+	Crtsh source.CrtshSource `mapstructure:"crtsh"`
 	// AlertConfig represents the configuration for alert mails.
 	AlertConfig AlertConfig `mapstructure:"alert_config"`
+	// OutboxConfig represents the retry policy for delivering alert mails.
+	OutboxConfig OutboxConfig `mapstructure:"outbox_config"`
 	// PositionConfig represents the configuration for recording log position.
 	PositionConfig PositionConfig `mapstructure:"position_config"`
+	// HistoryConfig represents the configuration for the issuance history database.
+	HistoryConfig HistoryConfig `mapstructure:"history_config"`
+	// BaselineConfig represents the configuration for the baseline of expected certificates.
+	BaselineConfig BaselineConfig `mapstructure:"baseline_config"`
 	// AmazonSES represents the mailer configuration for using Amazon Simple Email Service.
 	AmazonSES mailer.AmazonSESMailer `mapstructure:"amazonses"`
 	// Sendgrid represents the mailer configuration for using Sendgrid.
 	Sendgrid mailer.SendgridMailer `mapstructure:"sendgrid"`
 	// SMTP represents the mailer configuration for using plain SMTP.
 	SMTP mailer.SMTPMailer `mapstructure:"smtp"`
-	// FilterConfig represent filter plugin configuration.
+	// FilterConfig represents the global configuration of filters.
 	FilterConfig FilterConfig `mapstructure:"filter_config"`
 	// MailTemplate represents template strings for emails being sent out.
 	MailTemplate MailTemplate `mapstructure:"mail_template"`
+	// ServeConfig represents the configuration for running as a daemon.
+	ServeConfig ServeConfig `mapstructure:"serve_config"`
 }
 
 // DomainConfig contains domain configurations.
@@ -65,6 +122,66 @@ type DomainConfig struct {
 	// Mailer is the name of the mail provider to use for this domain.
 	// If not provided, the global configuration in alert_config is used.
 	Mailer Mailer `mapstructure:"mailer_config"`
+	// Source is the name of the issuance source to query for this domain.
+	// If not provided, the global configuration in source_config is used.
+	Source Source `mapstructure:"source"`
+	// Interval is the interval between checks for this domain when running as a daemon.
+	// If not provided, the global configuration in serve_config is used.
+	Interval time.Duration `mapstructure:"interval"`
+	// FilterConfig represents the filters for this domain, which extend or replace
+	// the global configuration in filter_config.
+	FilterConfig DomainFilterConfig `mapstructure:"filter_config"`
+}
+
+// SourceConfig contains issuance source configuration.
+type SourceConfig struct {
+	// Source is the name of the issuance source to use.
+	// This defaults to "certspotter".
+	Source Source `mapstructure:"source"`
+	// RateLimit is the request rate limit applied to each source.
+	// The limit is shared by all domains querying the same source.
+	RateLimit RateLimit `mapstructure:"rate_limit"`
+}
+
+// RateLimit represents a request rate limit.
+type RateLimit struct {
+	// Rate is the number of requests allowed per second.
+	// Rate limiting is disabled if unset.
+	Rate float64 `mapstructure:"rate"`
+	// Burst is the maximum number of requests allowed at once.
+	// This defaults to 1.
+	Burst int `mapstructure:"burst"`
+}
+
+// RetryConfig represents the retry policy for source requests failing with
+// a transport error, a 429 or a 5xx status code.
+// Retry-After headers sent by the source are honored.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts per request, including the first one.
+	// Set to 1 to disable retries. This defaults to 5.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialBackoff is the delay before the first retry, which doubles on each retry.
+	// This defaults to 1s.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	// MaxBackoff is the maximum delay between retries.
+	// This defaults to 1m.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// Budget is the total time that may be spent waiting between retries on each run,
+	// or on each serve interval when running as a daemon. This defaults to 10m.
+	Budget time.Duration `mapstructure:"budget"`
+}
+
+// PaginationConfig represents the budget for catching up on a domain's backlog
+// on each run. Issuances are fetched page by page until the domain is caught up
+// or the budget is spent, in which case checks resume from there on the next run.
+type PaginationConfig struct {
+	// MaxPages is the maximum number of pages fetched per domain on each run.
+	// Set to 0 for no limit. This defaults to 10.
+	MaxPages int `mapstructure:"max_pages"`
+	// MaxIssuances is the maximum number of issuances fetched per domain on each run.
+	// The page reaching this limit is processed in full.
+	// Set to 0 for no limit. This defaults to 0.
+	MaxIssuances int `mapstructure:"max_issuances"`
 }
 
 // AlertConfig contains alert configuration.
@@ -73,22 +190,135 @@ type AlertConfig struct {
 	// If the provider doesn't exist or isn't configured,
 	// the no-op mailer will be used.
 	Mailer Mailer `mapstructure:"mailer_config"`
+	// Routes select the mailer of reported issuances from their annotations.
+	// The first matching route applies. Issuances matching no route are sent
+	// with the mailer of their domain.
+	Routes []Route `mapstructure:"routes"`
+}
+
+// Route sends issuances annotated with all the given labels with a specific mailer.
+type Route struct {
+	Annotations map[string]string `mapstructure:"annotations"`
+	Mailer      Mailer            `mapstructure:"mailer"`
+}
+
+// OutboxConfig represents the retry policy for notifications in the outbox.
+// Notifications are committed to the outbox along with the position, and retried
+// on each run until delivered.
+type OutboxConfig struct {
+	// InitialBackoff is the delay before retrying a failed delivery, which doubles on each retry.
+	// This defaults to 1m.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	// MaxBackoff is the maximum delay between retries.
+	// This defaults to 1h.
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
 }
 
 // PositionConfig represents a position file config.
 type PositionConfig struct {
+	// Store is the name of the backend used to store positions.
+	// This defaults to "toml".
+	Store PositionStore `mapstructure:"store"`
+	// Filename is the path to the file positions are stored in.
+	// This defaults to "/var/log/ct-monitor/positions.toml".
 	Filename string `mapstructure:"filename"`
+	// ConfigMap is the name of the ConfigMap positions are stored in with the configmap store.
+	// This defaults to "ct-monitor-positions".
+	ConfigMap string `mapstructure:"configmap"`
+	// Namespace is the namespace of the ConfigMap.
+	// This defaults to the namespace ct-monitor runs in, or the one of the current kubeconfig context.
+	Namespace string `mapstructure:"namespace"`
+	// Lock represents the configuration of the run lock guarding the store.
+	Lock LockConfig `mapstructure:"lock"`
+}
+
+// LockConfig represents the configuration of the run lock, which prevents
+// concurrent runs from using the same position store. File-based stores are
+// locked with an advisory lock on "<filename>.lock", while the configmap store
+// is locked with a Lease of the same name as the ConfigMap.
+type LockConfig struct {
+	// Policy is what to do when the lock is held by another run.
+	// This defaults to "fail".
+	Policy LockPolicy `mapstructure:"policy"`
+	// Timeout is the maximum time to wait for the lock with the "wait" policy.
+	// Set to 0 to wait indefinitely. This defaults to 10m.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// LeaseDuration is the duration after which a Lease which is not renewed,
+	// for instance because its holder was killed, is considered stale and taken over.
+	// This defaults to 1m.
+	LeaseDuration time.Duration `mapstructure:"lease_duration"`
 }
 
+// HistoryConfig represents the configuration for the issuance history database,
+// which records every observed issuance along with the verdict of filters and
+// the status of notifications.
+type HistoryConfig struct {
+	// Enabled should be set to true to record observed issuances.
+	Enabled bool `mapstructure:"enabled"`
+	// Filename is the path to the history database.
+	// This defaults to "/var/log/ct-monitor/history.db".
+	Filename string `mapstructure:"filename"`
+}
+
+// BaselineConfig represents the configuration for the baseline of expected certificates.
+// Issuances matching the baseline are not reported.
+type BaselineConfig struct {
+	// Filename is the path to the baseline, as written by "ct-monitor baseline import".
+	// This defaults to "/var/log/ct-monitor/baseline.json".
+	Filename string `mapstructure:"filename"`
+}
+
+// ServeConfig represents the configuration for running as a daemon.
+type ServeConfig struct {
+	// Interval is the default interval between checks.
+	// This defaults to 1h.
+	Interval time.Duration `mapstructure:"interval"`
+	// HealthAddress is the listen address for the health check endpoint.
+	// This defaults to ":8080".
+	HealthAddress string `mapstructure:"health_address"`
+}
+
+// FilterConfig represents the configuration of filters.
+// Built-in rules are applied first, then CEL expressions, then plugins.
 type FilterConfig struct {
+	// Rules are built-in filter rules.
+	Rules []filter.Rule `mapstructure:"rules"`
+	// Expressions are filter rules written as CEL expressions.
+	Expressions []filter.CELRule `mapstructure:"expressions"`
+	// Filters are paths to filter plugins.
 	Filters []string `mapstructure:"filters"`
+	// Plugins are filter plugins along with their configuration, run after Filters.
+	Plugins []filter.Plugin `mapstructure:"plugins"`
+}
+
+// DomainFilterConfig represents the configuration of filters for a domain.
+type DomainFilterConfig struct {
+	FilterConfig `mapstructure:",squash"`
+	// Mode is either "extend" to apply each stage of the domain's filters after the global one,
+	// or "replace" to only apply the domain's filters. This defaults to "extend".
+	Mode FilterMode `mapstructure:"mode"`
+}
+
+// plugins returns the plugins listed in Filters, followed by Plugins.
+func (fc FilterConfig) plugins() []filter.Plugin {
+	plugins := make([]filter.Plugin, 0, len(fc.Filters)+len(fc.Plugins))
+	for _, path := range fc.Filters {
+		plugins = append(plugins, filter.Plugin{Path: path})
+	}
+	return append(plugins, fc.Plugins...)
+}
+
+func (fc FilterConfig) chain(pool *filter.Pool) (filter.Chain, error) {
+	return filter.NewChain(fc.Rules, fc.Expressions, fc.plugins(), pool)
 }
 
 // MailTemplate represents template strings for emails being sent out.
 // The following variables are made available for templating.
 //
 //	Domain: the configured domain name which was queried.
-//	Issuances: the Issuance object returned by the certspotter API.
+//	Issuances: the Issuance object returned by the certspotter API, along with
+//	Annotations set by filters.
+//	Warning: set when issuances are reported unfiltered because a filter failed.
 type MailTemplate struct {
 	Subject string `mapstructure:"subject"`
 	Body    string `mapstructure:"body"`
@@ -104,6 +334,56 @@ const (
 	NoOpMailer      Mailer = "none"
 )
 
+// Source represents an issuance source name.
+type Source string
+
+const (
+	CertspotterSource Source = "certspotter"
+	CTLogSource       Source = "ctlog"
+	StaticCTSource    Source = "staticct"
+	CrtshSource       Source = "crtsh"
+)
+
+// PositionStore represents a position store name.
+type PositionStore string
+
+const (
+	TOMLPositionStore      PositionStore = "toml"
+	BoltPositionStore      PositionStore = "bolt"
+	ConfigMapPositionStore PositionStore = "configmap"
+)
+
+// FilterMode represents how the filters of a domain are combined with the global ones.
+type FilterMode string
+
+const (
+	ExtendFilterMode  FilterMode = "extend"
+	ReplaceFilterMode FilterMode = "replace"
+)
+
+// LockPolicy represents the policy applied when the run lock is held by another run.
+type LockPolicy string
+
+const (
+	// FailLockPolicy fails immediately.
+	FailLockPolicy LockPolicy = "fail"
+	// WaitLockPolicy waits for the lock to be released, up to a timeout.
+	WaitLockPolicy LockPolicy = "wait"
+	// NoLockPolicy disables the run lock.
+	NoLockPolicy LockPolicy = "none"
+)
+
+var (
+	// ErrUnknownSource is returned when an issuance source is not supported.
+	ErrUnknownSource = fmt.Errorf("unknown issuance source")
+	// ErrUnknownPositionStore is returned when a position store is not supported.
+	ErrUnknownPositionStore = fmt.Errorf("unknown position store")
+	// ErrUnknownLockPolicy is returned when a lock policy is not supported.
+	ErrUnknownLockPolicy = fmt.Errorf("unknown lock policy")
+	// ErrUnknownFilterMode is returned when a filter mode is not supported.
+	ErrUnknownFilterMode = fmt.Errorf("unknown filter mode")
+)
+
 // Load loads the configuration from file.
 func Load(confFile string) (conf *Config, err error) {
 	viper.SetConfigFile(confFile)
@@ -112,17 +392,51 @@ func Load(confFile string) (conf *Config, err error) {
 		return nil, err
 	}
 	conf = &Config{
-		Endpoint: defaultCertspotterEndpoint,
+		Endpoint:    defaultCertspotterEndpoint,
+		Concurrency: defaultConcurrency,
+		SourceConfig: SourceConfig{
+			Source: defaultSource,
+		},
+		RetryConfig: RetryConfig{
+			MaxAttempts:    defaultRetryMaxAttempts,
+			InitialBackoff: defaultRetryInitialBackoff,
+			MaxBackoff:     defaultRetryMaxBackoff,
+			Budget:         defaultRetryBudget,
+		},
+		PaginationConfig: PaginationConfig{
+			MaxPages: defaultMaxPages,
+		},
 		AlertConfig: AlertConfig{
 			Mailer: defaultMailer,
 		},
+		OutboxConfig: OutboxConfig{
+			InitialBackoff: defaultOutboxInitialBackoff,
+			MaxBackoff:     defaultOutboxMaxBackoff,
+		},
 		PositionConfig: PositionConfig{
-			Filename: defaultPositionFile,
+			Store:     defaultPositionStore,
+			Filename:  defaultPositionFile,
+			ConfigMap: defaultPositionConfigMap,
+			Lock: LockConfig{
+				Policy:        defaultLockPolicy,
+				Timeout:       defaultLockTimeout,
+				LeaseDuration: defaultLockLeaseDuration,
+			},
+		},
+		HistoryConfig: HistoryConfig{
+			Filename: defaultHistoryFile,
+		},
+		BaselineConfig: BaselineConfig{
+			Filename: defaultBaselineFile,
 		},
 		MailTemplate: MailTemplate{
 			Subject: DefaultSubjectTemplate,
 			Body:    DefaultBodyTemplate,
 		},
+		ServeConfig: ServeConfig{
+			Interval:      defaultInterval,
+			HealthAddress: defaultHealthAddress,
+		},
 	}
 	if err := viper.Unmarshal(&conf); err != nil {
 		return nil, err
@@ -130,9 +444,56 @@ func Load(confFile string) (conf *Config, err error) {
 	if conf.Token == "" {
 		conf.Token = viper.GetString(certspotterTokenEnv)
 	}
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
 	return conf, nil
 }
 
+// validate checks that filters compile, so that errors surface when loading the configuration.
+func (c *Config) validate() error {
+	if _, err := c.FilterConfig.chain(nil); err != nil {
+		return fmt.Errorf("filter_config: %w", err)
+	}
+	for _, dc := range c.Domains {
+		if _, err := c.GetFilterChain(dc, nil); err != nil {
+			return fmt.Errorf("domain %s: filter_config: %w", dc.Name, err)
+		}
+	}
+	if c.usesSource(CrtshSource) && slices.ContainsFunc(c.rules(), func(r filter.Rule) bool { return len(r.IssuerPubKeySHA256) > 0 }) {
+		_ = log.Warn("issuer_pubkey_sha256 rules never match issuances from crt.sh, which does not provide the issuer's public key", nil)
+	}
+	return nil
+}
+
+// usesSource returns true if any domain queries the source.
+func (c *Config) usesSource(name Source) bool {
+	for _, dc := range c.Domains {
+		if dc.Source == name || (dc.Source == "" && c.SourceConfig.Source == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rules returns the built-in filter rules of every domain, along with the global ones.
+func (c *Config) rules() []filter.Rule {
+	rules := slices.Clone(c.FilterConfig.Rules)
+	for _, dc := range c.Domains {
+		rules = append(rules, dc.FilterConfig.Rules...)
+	}
+	return rules
+}
+
+// needsCertificateHashes returns true if the baseline or built-in filter rules
+// match issuances by hashes which crt.sh only provides by downloading certificates.
+func (c *Config) needsCertificateHashes() bool {
+	if _, err := os.Stat(c.BaselineConfig.Filename); err == nil {
+		return true
+	}
+	return slices.ContainsFunc(c.rules(), func(r filter.Rule) bool { return len(r.PubKeySHA256) > 0 })
+}
+
 // GetMailer retrieves a Mailer instance from the configuration.
 func (c *Config) GetMailer(name Mailer) (m mailer.Mailer) {
 	defer func() {
@@ -148,3 +509,184 @@ func (c *Config) GetMailer(name Mailer) (m mailer.Mailer) {
 	m = f.Interface().(mailer.Mailer)
 	return m
 }
+
+// GetInterval returns the interval between checks for the domain.
+func (c *Config) GetInterval(dc DomainConfig) time.Duration {
+	if dc.Interval > 0 {
+		return dc.Interval
+	}
+	return c.ServeConfig.Interval
+}
+
+// GetSource retrieves an IssuanceSource instance from the configuration,
+// sending requests with the given client, as returned by GetSourceHTTPClient.
+// For CT log sources, a new cache of fetched entries is allocated on each call.
+// The crtsh source downloads certificates when the baseline or filter rules
+// need their hashes.
+func (c *Config) GetSource(name Source, client api.HTTPClient) (source.IssuanceSource, error) {
+	switch name {
+	case CertspotterSource:
+		return &source.CertspotterSource{
+			Client: api.CertspotterClient{
+				Endpoint: c.Endpoint,
+				Token:    c.Token,
+				Client:   client,
+			},
+		}, nil
+	case CTLogSource:
+		return c.CTLog.WithClient(client), nil
+	case StaticCTSource:
+		return c.StaticCT.WithClient(client), nil
+	case CrtshSource:
+		src := c.Crtsh
+		src.Client = client
+		src.FetchCertificates = src.FetchCertificates || c.needsCertificateHashes()
+		return &src, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+}
+
+// GetPositionStore opens the position store from the configuration.
+func (c *Config) GetPositionStore() (position.Store, error) {
+	switch c.PositionConfig.Store {
+	case TOMLPositionStore:
+		return position.NewTOMLStore(c.PositionConfig.Filename)
+	case BoltPositionStore:
+		return position.NewBoltStore(c.PositionConfig.Filename)
+	case ConfigMapPositionStore:
+		return c.getConfigMapPositionStore()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPositionStore, c.PositionConfig.Store)
+	}
+}
+
+// GetHistoryDB returns the issuance history database.
+// The no-op database is returned if history is disabled.
+func (c *Config) GetHistoryDB() history.DB {
+	if !c.HistoryConfig.Enabled {
+		return history.NoOpDB{}
+	}
+	return history.NewBoltDB(c.HistoryConfig.Filename)
+}
+
+// GetRouteMailer returns the name of the mailer issuances with the given annotations
+// are sent with. An empty name stands for the default mailer.
+func (c *Config) GetRouteMailer(dc DomainConfig, annotations filter.Annotations) Mailer {
+	for _, route := range c.AlertConfig.Routes {
+		if annotations.Match(route.Annotations) {
+			return route.Mailer
+		}
+	}
+	return dc.Mailer
+}
+
+// GetFilterChain compiles the chain of filters applied to the domain.
+// Plugins are run from the pool if set, and started for each call otherwise.
+// When extending the global filters, each stage of the domain runs after the
+// same stage of the global filters: rules, then expressions, then plugins.
+// Rules and expressions of the domain are kept apart from the global ones,
+// so that match rules of both apply.
+func (c *Config) GetFilterChain(dc DomainConfig, pool *filter.Pool) (filter.Chain, error) {
+	switch dc.FilterConfig.Mode {
+	case ExtendFilterMode, "":
+		global, domain := c.FilterConfig, dc.FilterConfig.FilterConfig
+		stages := []FilterConfig{
+			{Rules: global.Rules},
+			{Rules: domain.Rules},
+			{Expressions: global.Expressions},
+			{Expressions: domain.Expressions},
+			{Plugins: append(global.plugins(), domain.plugins()...)},
+		}
+		var chain filter.Chain
+		for _, stage := range stages {
+			sc, err := stage.chain(pool)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, sc...)
+		}
+		return chain, nil
+	case ReplaceFilterMode:
+		return dc.FilterConfig.chain(pool)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFilterMode, dc.FilterConfig.Mode)
+	}
+}
+
+// GetBaseline loads the baseline of expected certificates.
+// The baseline is empty if the file does not exist.
+func (c *Config) GetBaseline() (*baseline.Baseline, error) {
+	return baseline.Load(c.BaselineConfig.Filename)
+}
+
+// GetRunLock returns the run lock guarding the position store.
+func (c *Config) GetRunLock() (position.Lock, error) {
+	switch c.PositionConfig.Store {
+	case TOMLPositionStore, BoltPositionStore:
+		return position.NewFileLock(c.PositionConfig.Filename + ".lock"), nil
+	case ConfigMapPositionStore:
+		client, namespace, err := c.getKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		return position.NewLeaseLock(client, namespace, c.PositionConfig.ConfigMap, c.PositionConfig.Lock.LeaseDuration), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPositionStore, c.PositionConfig.Store)
+	}
+}
+
+func (c *Config) getConfigMapPositionStore() (position.Store, error) {
+	client, namespace, err := c.getKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	return position.NewConfigMapStore(client, namespace, c.PositionConfig.ConfigMap), nil
+}
+
+// getKubernetesClient connects to the Kubernetes API server using the in-cluster
+// configuration, or the current kubeconfig context when running outside a cluster.
+// It also returns the namespace positions are stored in.
+func (c *Config) getKubernetesClient() (kubernetes.Interface, string, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	namespace := c.PositionConfig.Namespace
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+	return client, namespace, nil
+}
+
+// GetSourceHTTPClient returns an HTTP client for a source, rate limited
+// according to source_config and retrying failed requests according to
+// retry_config. The client should be kept for as long as ct-monitor runs,
+// so that the rate limit and retry budget are not reset on each run.
+// The retry budget is renewed every serve interval.
+func (c *Config) GetSourceHTTPClient() api.HTTPClient {
+	var client api.HTTPClient = http.DefaultClient
+	if rl := c.SourceConfig.RateLimit; rl.Rate > 0 {
+		client = source.NewRateLimitedClient(client, rl.Rate, rl.Burst)
+	}
+	if rc := c.RetryConfig; rc.MaxAttempts > 1 {
+		client = source.NewRetryingClient(client, source.RetryPolicy{
+			MaxAttempts:    rc.MaxAttempts,
+			InitialBackoff: rc.InitialBackoff,
+			MaxBackoff:     rc.MaxBackoff,
+			Budget:         rc.Budget,
+			BudgetPeriod:   c.ServeConfig.Interval,
+		})
+	}
+	return client
+}
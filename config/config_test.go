@@ -4,13 +4,34 @@
 package config
 
 import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/history"
 	"github.com/Hsn723/ct-monitor/mailer"
+	"github.com/Hsn723/ct-monitor/position"
+	"github.com/Hsn723/ct-monitor/source"
 	"github.com/stretchr/testify/assert"
 )
 
+var defaultPositionConfig = PositionConfig{
+	Store:     TOMLPositionStore,
+	Filename:  defaultPositionFile,
+	ConfigMap: defaultPositionConfigMap,
+	Lock: LockConfig{
+		Policy:        defaultLockPolicy,
+		Timeout:       defaultLockTimeout,
+		LeaseDuration: defaultLockLeaseDuration,
+	},
+}
+
 func testLoad(t *testing.T, confFile string, expectedConfig *Config, isErrorExpected bool) {
 	t.Helper()
 	actualConfig, err := Load(confFile)
@@ -25,6 +46,7 @@ func testLoad(t *testing.T, confFile string, expectedConfig *Config, isErrorExpe
 }
 
 func TestLoad(t *testing.T) {
+	noWildcard := false
 	cases := []struct {
 		title           string
 		file            string
@@ -43,12 +65,77 @@ func TestLoad(t *testing.T) {
 					{
 						Name:              "example.jp",
 						IncludeSubdomains: true,
+						Source:            CertspotterSource,
+						Interval:          15 * time.Minute,
+						FilterConfig: DomainFilterConfig{
+							FilterConfig: FilterConfig{
+								Rules:   []filter.Rule{{DNSNameRegexps: []string{`^test\.`}}},
+								Filters: []string{"/usr/local/bin/jp-filter"},
+								Plugins: []filter.Plugin{
+									{
+										Path: "/usr/local/bin/owner-filter",
+										Config: map[string]interface{}{
+											"team":            "security",
+											"min_names":       int64(2),
+											"excluded_owners": []interface{}{"ops"},
+										},
+										OnError: filter.Abort,
+										Timeout: 30 * time.Second,
+										SHA256:  "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+									},
+								},
+							},
+							Mode: ReplaceFilterMode,
+						},
+					},
+				},
+				Endpoint:    "dummy.endpoint",
+				Token:       "dummy",
+				Concurrency: 4,
+				PositionConfig: PositionConfig{
+					Store:     BoltPositionStore,
+					Filename:  "positions.db",
+					ConfigMap: "positions",
+					Namespace: "monitoring",
+					Lock: LockConfig{
+						Policy:        WaitLockPolicy,
+						Timeout:       5 * time.Minute,
+						LeaseDuration: defaultLockLeaseDuration,
+					},
+				},
+				RetryConfig: RetryConfig{
+					MaxAttempts:    3,
+					InitialBackoff: 500 * time.Millisecond,
+					MaxBackoff:     defaultRetryMaxBackoff,
+					Budget:         2 * time.Minute,
+				},
+				PaginationConfig: PaginationConfig{
+					MaxPages:     0,
+					MaxIssuances: 1000,
+				},
+				SourceConfig: SourceConfig{
+					Source:    CertspotterSource,
+					RateLimit: RateLimit{Rate: 0.5, Burst: 2},
+				},
+				CTLog: source.CTLogSource{
+					Logs:      []source.CTLog{{URL: "https://ct.example.com/log/"}},
+					BatchSize: 128,
+				},
+				AlertConfig: AlertConfig{
+					Mailer: SendgridMailer,
+					Routes: []Route{
+						{Annotations: map[string]string{"severity": "high"}, Mailer: SMTPMailer},
 					},
 				},
-				Endpoint:       "dummy.endpoint",
-				Token:          "dummy",
-				PositionConfig: PositionConfig{Filename: "positions.toml"},
-				AlertConfig:    AlertConfig{Mailer: SendgridMailer},
+				OutboxConfig: OutboxConfig{
+					InitialBackoff: 30 * time.Second,
+					MaxBackoff:     defaultOutboxMaxBackoff,
+				},
+				HistoryConfig: HistoryConfig{
+					Enabled:  true,
+					Filename: "history.db",
+				},
+				BaselineConfig: BaselineConfig{Filename: "baseline.json"},
 				SMTP: mailer.SMTPMailer{
 					From:   "from@example.com",
 					To:     "to@example.com",
@@ -60,7 +147,21 @@ func TestLoad(t *testing.T) {
 					To:     "to@example.com",
 					APIKey: "hoge",
 				},
-				FilterConfig: FilterConfig{Filters: []string{}},
+				FilterConfig: FilterConfig{
+					Rules: []filter.Rule{
+						{DNSNames: []string{"*.dev.example.com"}},
+						{
+							Action:      filter.MatchAction,
+							IssuerNames: []string{"*Let's Encrypt*"},
+							MaxValidity: 2160 * time.Hour,
+							Wildcard:    &noWildcard,
+						},
+					},
+					Expressions: []filter.CELRule{
+						{Expression: `issuance.dns_names.exists(n, n.endsWith(".staging.example.com"))`},
+					},
+					Filters: []string{},
+				},
 				MailTemplate: MailTemplate{
 					Subject: "{{.Domain}}の証明書発行を検知しました",
 					Body: `ct-monitorが{{.Domain}}の以下の証明書の発行を検知しました
@@ -68,6 +169,10 @@ func TestLoad(t *testing.T) {
 SHA256: {{.CertSHA256}}
 {{end}}`,
 				},
+				ServeConfig: ServeConfig{
+					Interval:      30 * time.Minute,
+					HealthAddress: "127.0.0.1:9090",
+				},
 			},
 		},
 		{
@@ -84,10 +189,22 @@ SHA256: {{.CertSHA256}}
 						IncludeSubdomains: true,
 					},
 				},
-				Endpoint:       defaultCertspotterEndpoint,
-				Token:          "",
-				PositionConfig: PositionConfig{Filename: defaultPositionFile},
-				AlertConfig:    AlertConfig{Mailer: NoOpMailer},
+				Endpoint:    defaultCertspotterEndpoint,
+				Token:       "",
+				Concurrency: defaultConcurrency,
+				RetryConfig: RetryConfig{
+					MaxAttempts:    defaultRetryMaxAttempts,
+					InitialBackoff: defaultRetryInitialBackoff,
+					MaxBackoff:     defaultRetryMaxBackoff,
+					Budget:         defaultRetryBudget,
+				},
+				PaginationConfig: PaginationConfig{MaxPages: defaultMaxPages},
+				PositionConfig:   defaultPositionConfig,
+				SourceConfig:     SourceConfig{Source: CertspotterSource},
+				AlertConfig:      AlertConfig{Mailer: NoOpMailer},
+				OutboxConfig:     OutboxConfig{InitialBackoff: defaultOutboxInitialBackoff, MaxBackoff: defaultOutboxMaxBackoff},
+				HistoryConfig:    HistoryConfig{Filename: defaultHistoryFile},
+				BaselineConfig:   BaselineConfig{Filename: defaultBaselineFile},
 				SMTP: mailer.SMTPMailer{
 					From:   "from@example.com",
 					To:     "to@example.com",
@@ -103,8 +220,18 @@ SHA256: {{.CertSHA256}}
 					Subject: DefaultSubjectTemplate,
 					Body:    DefaultBodyTemplate,
 				},
+				ServeConfig: ServeConfig{
+					Interval:      defaultInterval,
+					HealthAddress: defaultHealthAddress,
+				},
 			},
 		},
+		{
+			title:           "InvalidExpression",
+			file:            "t/invalid_expression.toml",
+			expected:        nil,
+			isErrorExpected: true,
+		},
 		{
 			title:           "NoFile",
 			file:            "t/dummy.toml",
@@ -132,10 +259,22 @@ func TestLoadEnv(t *testing.T) {
 				IncludeSubdomains: true,
 			},
 		},
-		Endpoint:       defaultCertspotterEndpoint,
-		Token:          "dummy-from-env",
-		PositionConfig: PositionConfig{Filename: defaultPositionFile},
-		AlertConfig:    AlertConfig{Mailer: NoOpMailer},
+		Endpoint:    defaultCertspotterEndpoint,
+		Token:       "dummy-from-env",
+		Concurrency: defaultConcurrency,
+		RetryConfig: RetryConfig{
+			MaxAttempts:    defaultRetryMaxAttempts,
+			InitialBackoff: defaultRetryInitialBackoff,
+			MaxBackoff:     defaultRetryMaxBackoff,
+			Budget:         defaultRetryBudget,
+		},
+		PaginationConfig: PaginationConfig{MaxPages: defaultMaxPages},
+		PositionConfig:   defaultPositionConfig,
+		SourceConfig:     SourceConfig{Source: CertspotterSource},
+		AlertConfig:      AlertConfig{Mailer: NoOpMailer},
+		OutboxConfig:     OutboxConfig{InitialBackoff: defaultOutboxInitialBackoff, MaxBackoff: defaultOutboxMaxBackoff},
+		HistoryConfig:    HistoryConfig{Filename: defaultHistoryFile},
+		BaselineConfig:   BaselineConfig{Filename: defaultBaselineFile},
 		SMTP: mailer.SMTPMailer{
 			From:   "from@example.com",
 			To:     "to@example.com",
@@ -151,6 +290,10 @@ func TestLoadEnv(t *testing.T) {
 			Subject: DefaultSubjectTemplate,
 			Body:    DefaultBodyTemplate,
 		},
+		ServeConfig: ServeConfig{
+			Interval:      defaultInterval,
+			HealthAddress: defaultHealthAddress,
+		},
 	}
 	testLoad(t, "t/defaults.toml", expected, false)
 }
@@ -203,3 +346,413 @@ func TestGetMailer(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRouteMailer(t *testing.T) {
+	t.Parallel()
+	conf := Config{
+		AlertConfig: AlertConfig{
+			Mailer: SendgridMailer,
+			Routes: []Route{
+				{Annotations: map[string]string{"severity": "high", "owner": "payments"}, Mailer: SendgridMailer},
+				{Annotations: map[string]string{"severity": "high"}, Mailer: SMTPMailer},
+			},
+		},
+	}
+	dc := DomainConfig{Name: "example.com", Mailer: NoOpMailer}
+	cases := []struct {
+		title       string
+		annotations filter.Annotations
+		expected    Mailer
+	}{
+		{title: "NoAnnotations", expected: NoOpMailer},
+		{title: "NoMatch", annotations: filter.Annotations{"severity": "low"}, expected: NoOpMailer},
+		{title: "Match", annotations: filter.Annotations{"severity": "high"}, expected: SMTPMailer},
+		{title: "FirstMatch", annotations: filter.Annotations{"severity": "high", "owner": "payments"}, expected: SendgridMailer},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, conf.GetRouteMailer(dc, tc.annotations))
+		})
+	}
+}
+
+func TestGetSource(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		name     Source
+		expected source.IssuanceSource
+		isErr    bool
+	}{
+		{
+			title: "Certspotter",
+			name:  CertspotterSource,
+			expected: &source.CertspotterSource{
+				Client: api.CertspotterClient{
+					Endpoint: "dummy.endpoint",
+					Token:    "dummy",
+					Client:   http.DefaultClient,
+				},
+			},
+		},
+		{
+			title: "CTLog",
+			name:  CTLogSource,
+			expected: (&source.CTLogSource{
+				Logs: []source.CTLog{{URL: "https://ct.example.com/log/"}},
+			}).WithClient(http.DefaultClient),
+		},
+		{
+			title:    "StaticCT",
+			name:     StaticCTSource,
+			expected: (&source.StaticCTSource{}).WithClient(http.DefaultClient),
+		},
+		{
+			title:    "Crtsh",
+			name:     CrtshSource,
+			expected: &source.CrtshSource{Client: http.DefaultClient},
+		},
+		{
+			title: "Unknown",
+			name:  "hoge",
+			isErr: true,
+		},
+	}
+	conf := Config{
+		Endpoint: "dummy.endpoint",
+		Token:    "dummy",
+		CTLog: source.CTLogSource{
+			Logs: []source.CTLog{{URL: "https://ct.example.com/log/"}},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual, err := conf.GetSource(tc.name, http.DefaultClient)
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrUnknownSource)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestGetSourceCrtshFetchCertificates(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "baseline.json")
+	if err := os.WriteFile(existing, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+	cases := []struct {
+		title    string
+		conf     Config
+		expected bool
+	}{
+		{
+			title:    "None",
+			conf:     Config{BaselineConfig: BaselineConfig{Filename: missing}},
+			expected: false,
+		},
+		{
+			title:    "Configured",
+			conf:     Config{BaselineConfig: BaselineConfig{Filename: missing}, Crtsh: source.CrtshSource{FetchCertificates: true}},
+			expected: true,
+		},
+		{
+			title:    "Baseline",
+			conf:     Config{BaselineConfig: BaselineConfig{Filename: existing}},
+			expected: true,
+		},
+		{
+			title: "GlobalRule",
+			conf: Config{
+				BaselineConfig: BaselineConfig{Filename: missing},
+				FilterConfig:   FilterConfig{Rules: []filter.Rule{{PubKeySHA256: []string{"aa"}}}},
+			},
+			expected: true,
+		},
+		{
+			title: "DomainRule",
+			conf: Config{
+				BaselineConfig: BaselineConfig{Filename: missing},
+				Domains: []DomainConfig{{
+					Name:         "example.com",
+					FilterConfig: DomainFilterConfig{FilterConfig: FilterConfig{Rules: []filter.Rule{{PubKeySHA256: []string{"aa"}}}}},
+				}},
+			},
+			expected: true,
+		},
+		{
+			title: "IssuerRule",
+			conf: Config{
+				BaselineConfig: BaselineConfig{Filename: missing},
+				FilterConfig:   FilterConfig{Rules: []filter.Rule{{IssuerPubKeySHA256: []string{"aa"}}}},
+			},
+			expected: false,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			src, err := tc.conf.GetSource(CrtshSource, http.DefaultClient)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.expected, src.(*source.CrtshSource).FetchCertificates)
+		})
+	}
+}
+
+func TestGetSourceHTTPClient(t *testing.T) {
+	t.Parallel()
+	conf := Config{
+		SourceConfig: SourceConfig{
+			RateLimit: RateLimit{Rate: 2, Burst: 3},
+		},
+		RetryConfig: RetryConfig{
+			MaxAttempts: 3,
+			Budget:      time.Minute,
+		},
+		ServeConfig: ServeConfig{Interval: time.Hour},
+	}
+	retrying, ok := conf.GetSourceHTTPClient().(*source.RetryingClient)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, source.RetryPolicy{MaxAttempts: 3, Budget: time.Minute, BudgetPeriod: time.Hour}, retrying.Policy)
+	limited, ok := retrying.Client.(*source.RateLimitedClient)
+	if assert.True(t, ok) {
+		assert.Equal(t, 2.0, float64(limited.Limiter.Limit()))
+		assert.Equal(t, 3, limited.Limiter.Burst())
+	}
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    namespace: ct-monitor
+current-context: test
+`
+
+func TestGetPositionStore(t *testing.T) {
+	cases := []struct {
+		title    string
+		store    PositionStore
+		expected position.Store
+		isErr    bool
+	}{
+		{
+			title:    "TOML",
+			store:    TOMLPositionStore,
+			expected: &position.TOMLStore{},
+		},
+		{
+			title:    "Bolt",
+			store:    BoltPositionStore,
+			expected: &position.BoltStore{},
+		},
+		{
+			title:    "ConfigMap",
+			store:    ConfigMapPositionStore,
+			expected: &position.ConfigMapStore{},
+		},
+		{
+			title: "Unknown",
+			store: "hoge",
+			isErr: true,
+		},
+	}
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			conf := Config{
+				PositionConfig: PositionConfig{
+					Store:     tc.store,
+					Filename:  filepath.Join(t.TempDir(), "positions"),
+					ConfigMap: defaultPositionConfigMap,
+				},
+			}
+			actual, err := conf.GetPositionStore()
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrUnknownPositionStore)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.IsType(t, tc.expected, actual)
+				assert.NoError(t, actual.Close())
+			}
+		})
+	}
+}
+
+func TestGetFilterChain(t *testing.T) {
+	t.Parallel()
+	global := FilterConfig{
+		Rules:   []filter.Rule{{DNSNames: []string{"dev.example.com"}}},
+		Filters: []string{"/usr/local/bin/filter"},
+	}
+	domain := FilterConfig{
+		Expressions: []filter.CELRule{{Expression: "issuance.id == 1u"}},
+	}
+	cases := []struct {
+		title    string
+		dc       DomainConfig
+		expected []string
+		isErr    bool
+	}{
+		{
+			title:    "Global",
+			dc:       DomainConfig{Name: "example.com"},
+			expected: []string{"*filter.RuleFilter", "filter.PluginFilter"},
+		},
+		{
+			title:    "Extend",
+			dc:       DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: domain, Mode: ExtendFilterMode}},
+			expected: []string{"*filter.RuleFilter", "*filter.CELFilter", "filter.PluginFilter"},
+		},
+		{
+			title: "ExtendAllStages",
+			dc: DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: FilterConfig{
+				Rules:       []filter.Rule{{DNSNames: []string{"staging.example.com"}}},
+				Expressions: domain.Expressions,
+				Filters:     []string{"/usr/local/bin/domain-filter"},
+			}}},
+			expected: []string{"*filter.RuleFilter", "*filter.RuleFilter", "*filter.CELFilter", "filter.PluginFilter"},
+		},
+		{
+			title:    "Replace",
+			dc:       DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: domain, Mode: ReplaceFilterMode}},
+			expected: []string{"*filter.CELFilter"},
+		},
+		{
+			title: "UnknownMode",
+			dc:    DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{Mode: "merge"}},
+			isErr: true,
+		},
+		{
+			title: "InvalidPluginConfig",
+			dc: DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: FilterConfig{
+				Plugins: []filter.Plugin{{Path: "/usr/local/bin/filter", Config: map[string]interface{}{"since": time.Now()}}},
+			}}},
+			isErr: true,
+		},
+		{
+			title: "InvalidRule",
+			dc: DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: FilterConfig{
+				Rules: []filter.Rule{{Action: "drop"}},
+			}}},
+			isErr: true,
+		},
+	}
+	conf := Config{FilterConfig: global}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			chain, err := conf.GetFilterChain(tc.dc, nil)
+			if tc.isErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var actual []string
+			for _, f := range chain {
+				actual = append(actual, fmt.Sprintf("%T", f))
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	// Plugins of the domain run after the global ones.
+	chain, err := conf.GetFilterChain(DomainConfig{Name: "example.com", FilterConfig: DomainFilterConfig{FilterConfig: FilterConfig{
+		Filters: []string{"/usr/local/bin/domain-filter"},
+	}}}, nil)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, chain) {
+		assert.Equal(t, []filter.Plugin{{Path: "/usr/local/bin/filter"}, {Path: "/usr/local/bin/domain-filter"}}, chain[len(chain)-1].(filter.PluginFilter).Plugins)
+	}
+}
+
+func TestGetHistoryDB(t *testing.T) {
+	t.Parallel()
+	conf := Config{HistoryConfig: HistoryConfig{Filename: "history.db"}}
+	assert.Equal(t, history.NoOpDB{}, conf.GetHistoryDB())
+	conf.HistoryConfig.Enabled = true
+	assert.Equal(t, history.NewBoltDB("history.db"), conf.GetHistoryDB())
+}
+
+func TestGetRunLock(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+	cases := []struct {
+		title    string
+		store    PositionStore
+		expected position.Lock
+		isErr    bool
+	}{
+		{
+			title:    "TOML",
+			store:    TOMLPositionStore,
+			expected: position.NewFileLock("positions.toml.lock"),
+		},
+		{
+			title:    "Bolt",
+			store:    BoltPositionStore,
+			expected: position.NewFileLock("positions.toml.lock"),
+		},
+		{
+			title:    "ConfigMap",
+			store:    ConfigMapPositionStore,
+			expected: &position.LeaseLock{},
+		},
+		{
+			title: "Unknown",
+			store: "hoge",
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			conf := Config{
+				PositionConfig: PositionConfig{
+					Store:     tc.store,
+					Filename:  "positions.toml",
+					ConfigMap: defaultPositionConfigMap,
+				},
+			}
+			actual, err := conf.GetRunLock()
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrUnknownPositionStore)
+				return
+			}
+			assert.NoError(t, err)
+			if fl, ok := tc.expected.(*position.FileLock); ok {
+				assert.Equal(t, fl, actual)
+			} else {
+				assert.IsType(t, tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"maps"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// Annotations are labels attached to issuances by filters, such as severity=high.
+type Annotations map[string]string
+
+// Match returns whether all the given labels are set to the same values.
+func (a Annotations) Match(labels map[string]string) bool {
+	for k, v := range labels {
+		if value, ok := a[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// merge returns the annotations updated with the given labels, which take precedence.
+// The annotations are copied, so that issuances do not share them.
+func (a Annotations) merge(labels map[string]string) Annotations {
+	if len(labels) == 0 {
+		return a
+	}
+	res := make(Annotations, len(a)+len(labels))
+	maps.Copy(res, a)
+	maps.Copy(res, labels)
+	return res
+}
+
+// AnnotatedIssuance is an issuance along with its annotations.
+// Fields of the issuance are promoted, so that templates written for
+// api.Issuance keep working.
+type AnnotatedIssuance struct {
+	api.Issuance
+	Annotations Annotations `json:"annotations,omitempty"`
+}
+
+// Annotate returns the issuances without any annotations.
+func Annotate(is []api.Issuance) []AnnotatedIssuance {
+	if is == nil {
+		return nil
+	}
+	res := make([]AnnotatedIssuance, len(is))
+	for i, issuance := range is {
+		res[i] = AnnotatedIssuance{Issuance: issuance}
+	}
+	return res
+}
+
+// Issuances returns the issuances stripped of their annotations.
+func Issuances(is []AnnotatedIssuance) []api.Issuance {
+	if is == nil {
+		return nil
+	}
+	res := make([]api.Issuance, len(is))
+	for i, issuance := range is {
+		res[i] = issuance.Issuance
+	}
+	return res
+}
+
+type issuanceKey struct {
+	id     uint64
+	sha256 string
+}
+
+func keyOf(issuance api.Issuance) issuanceKey {
+	return issuanceKey{id: issuance.ID, sha256: issuance.CertSHA256}
+}
+
+// keepAnnotations annotates the issuances returned by a filter which does not
+// support annotations with the annotations they were passed in with.
+func keepAnnotations(in []AnnotatedIssuance, out []api.Issuance) []AnnotatedIssuance {
+	annotations := make(map[issuanceKey]Annotations, len(in))
+	for _, issuance := range in {
+		annotations[keyOf(issuance.Issuance)] = issuance.Annotations
+	}
+	res := Annotate(out)
+	for i := range res {
+		res[i].Annotations = annotations[keyOf(res[i].Issuance)]
+	}
+	return res
+}
+
+// AnnotatingFilter is implemented by filters annotating issuances.
+type AnnotatingFilter interface {
+	FilterAnnotated(md Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error)
+}
+
+// FilterAnnotated filters annotated issuances. Filters which do not annotate
+// issuances are passed the metadata if they support it, and annotations of the
+// issuances they keep are preserved.
+func FilterAnnotated(f IssuanceFilter, md Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error) {
+	if af, ok := f.(AnnotatingFilter); ok {
+		return af.FilterAnnotated(md, is)
+	}
+	res, err := FilterWithMetadata(f, md, Issuances(is))
+	return keepAnnotations(is, res), err
+}
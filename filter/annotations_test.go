@@ -0,0 +1,81 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationsMatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title       string
+		annotations Annotations
+		labels      map[string]string
+		expected    bool
+	}{
+		{
+			title:       "NoLabels",
+			annotations: nil,
+			expected:    true,
+		},
+		{
+			title:       "Match",
+			annotations: Annotations{"severity": "high", "owner": "payments"},
+			labels:      map[string]string{"severity": "high"},
+			expected:    true,
+		},
+		{
+			title:       "Value",
+			annotations: Annotations{"severity": "low"},
+			labels:      map[string]string{"severity": "high"},
+		},
+		{
+			title:       "Missing",
+			annotations: Annotations{"owner": "payments"},
+			labels:      map[string]string{"severity": ""},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, tc.annotations.Match(tc.labels))
+		})
+	}
+}
+
+func TestFilterAnnotated(t *testing.T) {
+	t.Parallel()
+	md := Metadata{Domain: Domain{Name: "example.com"}}
+	issuances := []AnnotatedIssuance{
+		{Issuance: api.Issuance{ID: 1, Domains: []string{"example.com"}}, Annotations: Annotations{"owner": "web"}},
+		{Issuance: api.Issuance{ID: 2, Domains: []string{"example.com"}}},
+		{Issuance: api.Issuance{ID: 3, Domains: []string{"www.example.com"}}},
+	}
+	rules, err := NewRuleFilter([]Rule{{Action: AnnotateAction, DNSNames: []string{"www.*"}, Annotations: map[string]string{"owner": "www"}}})
+	assert.NoError(t, err)
+	plugins, err := NewPluginFilter([]Plugin{
+		{Path: testFilterV2Bin, Config: map[string]interface{}{"severity": "high"}},
+		{Path: testFilterBin},
+	}, nil)
+	assert.NoError(t, err)
+	// Non-annotating filters keep annotations.
+	chain := Chain{truncateFilter{}, rules, plugins}
+	actual, err := chain.FilterAnnotated(md, issuances)
+	assert.NoError(t, err)
+	assert.Equal(t, []AnnotatedIssuance{
+		{Issuance: issuances[0].Issuance, Annotations: Annotations{"owner": "web", "severity": "high"}},
+	}, actual)
+
+	chain = Chain{rules, plugins}
+	actual, err = chain.FilterAnnotated(Metadata{}, issuances[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, []AnnotatedIssuance{
+		{Issuance: issuances[1].Issuance, Annotations: Annotations{"severity": "high"}},
+	}, actual)
+}
@@ -0,0 +1,223 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cel.dev/cel-go/cel"
+	"cel.dev/cel-go/ext"
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+const (
+	// celCostLimit bounds the cost of evaluating an expression against a single issuance.
+	celCostLimit = 1000000
+)
+
+var (
+	// ErrNotBoolean is returned when an expression does not evaluate to a boolean.
+	ErrNotBoolean = errors.New("expression does not evaluate to a boolean")
+)
+
+// CELIssuance is the representation of an issuance in CEL expressions,
+// available as the issuance variable.
+type CELIssuance struct {
+	ID        uint64    `cel:"id"`
+	DNSNames  []string  `cel:"dns_names"`
+	Issuer    CELIssuer `cel:"issuer"`
+	NotBefore time.Time `cel:"not_before"`
+	NotAfter  time.Time `cel:"not_after"`
+	// Validity is the duration of the validity period of the certificate.
+	Validity     time.Duration `cel:"validity"`
+	CertType     string        `cel:"cert_type"`
+	CertSHA256   string        `cel:"cert_sha256"`
+	TBSSHA256    string        `cel:"tbs_sha256"`
+	PubKeySHA256 string        `cel:"pubkey_sha256"`
+	// Annotations are those attached by earlier filters.
+	Annotations map[string]string `cel:"annotations"`
+}
+
+// CELIssuer is the representation of an issuer in CEL expressions.
+type CELIssuer struct {
+	Name         string   `cel:"name"`
+	FriendlyName string   `cel:"friendly_name"`
+	PubKeySHA256 string   `cel:"pubkey_sha256"`
+	Website      string   `cel:"website"`
+	CAADomains   []string `cel:"caa_domains"`
+	OperatorName string   `cel:"operator_name"`
+}
+
+// NewCELIssuance returns the representation of an issuance in CEL expressions.
+// Validity timestamps which fail to parse are left unset.
+func NewCELIssuance(issuance api.Issuance) CELIssuance {
+	notBefore, _ := time.Parse(time.RFC3339, issuance.NotBefore)
+	notAfter, _ := time.Parse(time.RFC3339, issuance.NotAfter)
+	var validity time.Duration
+	if !notBefore.IsZero() && !notAfter.IsZero() {
+		validity = notAfter.Sub(notBefore)
+	}
+	return CELIssuance{
+		ID:       issuance.ID,
+		DNSNames: issuance.Domains,
+		Issuer: CELIssuer{
+			Name:         issuance.Issuer.Name,
+			FriendlyName: issuance.Issuer.FriendlyName,
+			PubKeySHA256: issuance.Issuer.PubKeySHA256,
+			Website:      issuance.Issuer.Website,
+			CAADomains:   issuance.Issuer.CAADomains,
+			OperatorName: issuance.Issuer.Operator.Name,
+		},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		Validity:     validity,
+		CertType:     issuance.Cert.Type,
+		CertSHA256:   issuance.CertSHA256,
+		TBSSHA256:    issuance.TBSSHA256,
+		PubKeySHA256: issuance.PubKeySHA256,
+	}
+}
+
+// CELRule is a filter rule written as a CEL expression evaluating to a boolean,
+// which tells whether the issuance matches the rule.
+type CELRule struct {
+	// Action is either "exclude", "match" or "annotate". This defaults to "exclude".
+	Action Action `mapstructure:"action"`
+	// Expression is the CEL expression.
+	Expression string `mapstructure:"expression"`
+	// Annotations are attached to issuances matching annotate rules.
+	Annotations map[string]string `mapstructure:"annotations"`
+}
+
+type compiledCELRule struct {
+	expression  string
+	program     cel.Program
+	annotations map[string]string
+}
+
+// CELFilter is an IssuanceFilter evaluating CEL expressions against each issuance,
+// with the same semantics as RuleFilter.
+type CELFilter struct {
+	match    []compiledCELRule
+	exclude  []compiledCELRule
+	annotate []compiledCELRule
+}
+
+func newCELEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		ext.NativeTypes(reflect.TypeOf(CELIssuance{}), ext.ParseStructTags(true)),
+		ext.Strings(),
+		cel.Variable("issuance", cel.ObjectType("filter.CELIssuance")),
+	)
+}
+
+// NewCELFilter compiles rules into a CELFilter.
+func NewCELFilter(rules []CELRule) (*CELFilter, error) {
+	f := &CELFilter{}
+	if len(rules) == 0 {
+		return f, nil
+	}
+	env, err := newCELEnv()
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range rules {
+		ast, issues := env.Compile(r.Expression)
+		if issues.Err() != nil {
+			return nil, fmt.Errorf("expression %d: %w", i, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("expression %d: %w: %s", i, ErrNotBoolean, ast.OutputType())
+		}
+		program, err := env.Program(ast, cel.CostLimit(celCostLimit))
+		if err != nil {
+			return nil, fmt.Errorf("expression %d: %w", i, err)
+		}
+		c := compiledCELRule{expression: r.Expression, program: program, annotations: r.Annotations}
+		switch r.Action {
+		case ExcludeAction, "":
+			f.exclude = append(f.exclude, c)
+		case MatchAction:
+			f.match = append(f.match, c)
+		case AnnotateAction:
+			if len(r.Annotations) == 0 {
+				return nil, fmt.Errorf("expression %d: %w", i, ErrMissingAnnotations)
+			}
+			f.annotate = append(f.annotate, c)
+		default:
+			return nil, fmt.Errorf("expression %d: %w: %s", i, ErrUnknownAction, r.Action)
+		}
+	}
+	return f, nil
+}
+
+// Filter implements IssuanceFilter.
+func (f *CELFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	res, err := f.FilterAnnotated(Metadata{}, Annotate(is))
+	return Issuances(res), err
+}
+
+// FilterAnnotated implements AnnotatingFilter. Issuances for which an expression
+// fails to evaluate are kept, so that errors do not hide issuances, and the
+// errors are returned along with the result.
+func (f *CELFilter) FilterAnnotated(_ Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error) {
+	if len(f.match) == 0 && len(f.exclude) == 0 && len(f.annotate) == 0 {
+		return is, nil
+	}
+	res := make([]AnnotatedIssuance, 0, len(is))
+	var errs []error
+	for _, issuance := range is {
+		ci := NewCELIssuance(issuance.Issuance)
+		ci.Annotations = issuance.Annotations
+		if ci.Annotations == nil {
+			ci.Annotations = map[string]string{}
+		}
+		vars := map[string]interface{}{
+			"issuance": ci,
+		}
+		keep, err := f.keep(vars)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("issuance %d: %w", issuance.ID, err))
+			keep = true
+		}
+		if !keep {
+			continue
+		}
+		for _, r := range f.annotate {
+			matched, err := anyCELRuleMatches([]compiledCELRule{r}, vars)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("issuance %d: %w", issuance.ID, err))
+			}
+			if matched {
+				issuance.Annotations = issuance.Annotations.merge(r.annotations)
+			}
+		}
+		res = append(res, issuance)
+	}
+	return res, errors.Join(errs...)
+}
+
+func (f *CELFilter) keep(vars map[string]interface{}) (bool, error) {
+	if len(f.match) > 0 {
+		matched, err := anyCELRuleMatches(f.match, vars)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	excluded, err := anyCELRuleMatches(f.exclude, vars)
+	return !excluded, err
+}
+
+func anyCELRuleMatches(rules []compiledCELRule, vars map[string]interface{}) (bool, error) {
+	for _, r := range rules {
+		out, _, err := r.program.Eval(vars)
+		if err != nil {
+			return false, fmt.Errorf("%q: %w", r.expression, err)
+		}
+		if matched, ok := out.Value().(bool); ok && matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,189 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCELFilter(t *testing.T) {
+	t.Parallel()
+	issuances := []api.Issuance{
+		{
+			ID:        1,
+			Domains:   []string{"www.example.com"},
+			Issuer:    api.Issuer{Name: "C=US, O=Let's Encrypt, CN=R3", FriendlyName: "Let's Encrypt"},
+			NotBefore: "2026-01-01T00:00:00Z",
+			NotAfter:  "2026-04-01T00:00:00Z",
+			Cert:      api.Certificate{Type: "precert"},
+		},
+		{
+			ID:        2,
+			Domains:   []string{"api.dev.example.com"},
+			Issuer:    api.Issuer{Name: "C=US, O=Let's Encrypt, CN=R3", FriendlyName: "Let's Encrypt"},
+			NotBefore: "2026-01-01T00:00:00Z",
+			NotAfter:  "2026-04-01T00:00:00Z",
+		},
+		{
+			ID:        3,
+			Domains:   []string{"*.example.com"},
+			Issuer:    api.Issuer{Name: "C=GB, O=Sectigo Limited", FriendlyName: "Sectigo", Operator: api.Operator{Name: "Sectigo"}},
+			NotBefore: "2026-01-01T00:00:00Z",
+			NotAfter:  "2027-01-01T00:00:00Z",
+		},
+	}
+	cases := []struct {
+		title    string
+		rules    []CELRule
+		expected []uint64
+		isErr    bool
+	}{
+		{
+			title:    "NoRules",
+			expected: []uint64{1, 2, 3},
+		},
+		{
+			title: "Exclude",
+			rules: []CELRule{{
+				Expression: `issuance.issuer.name.contains("Let's Encrypt") && !issuance.dns_names.exists(n, n.endsWith(".dev.example.com"))`,
+			}},
+			expected: []uint64{2, 3},
+		},
+		{
+			title: "Match",
+			rules: []CELRule{
+				{Action: MatchAction, Expression: `issuance.validity > duration("2160h")`},
+				{Action: MatchAction, Expression: `issuance.cert_type == "precert"`},
+			},
+			expected: []uint64{1, 3},
+		},
+		{
+			title: "MatchAndExclude",
+			rules: []CELRule{
+				{Action: MatchAction, Expression: `issuance.issuer.operator_name == "Sectigo" || issuance.id == 2u`},
+				{Action: ExcludeAction, Expression: `issuance.not_after > timestamp("2026-12-31T00:00:00Z")`},
+			},
+			expected: []uint64{2},
+		},
+		{
+			title: "StringExtensions",
+			rules: []CELRule{{
+				Expression: `issuance.issuer.friendly_name.lowerAscii() == "sectigo"`,
+			}},
+			expected: []uint64{1, 2},
+		},
+		{
+			title: "SyntaxError",
+			rules: []CELRule{{Expression: `issuance.issuer.name.contains(`}},
+			isErr: true,
+		},
+		{
+			title: "UnknownField",
+			rules: []CELRule{{Expression: `issuance.subject == "example.com"`}},
+			isErr: true,
+		},
+		{
+			title: "NotBoolean",
+			rules: []CELRule{{Expression: `issuance.dns_names`}},
+			isErr: true,
+		},
+		{
+			title: "UnknownAction",
+			rules: []CELRule{{Action: "drop", Expression: `true`}},
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			f, err := NewCELFilter(tc.rules)
+			if tc.isErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			res, err := f.Filter(issuances)
+			assert.NoError(t, err)
+			var actual []uint64
+			for _, issuance := range res {
+				actual = append(actual, issuance.ID)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCELFilterEvalError(t *testing.T) {
+	t.Parallel()
+	f, err := NewCELFilter([]CELRule{{Expression: `issuance.dns_names[1] == "example.com"`}})
+	assert.NoError(t, err)
+	issuances := []api.Issuance{{ID: 1, Domains: []string{"www.example.com"}}}
+	// Issuances are kept when expressions fail to evaluate.
+	res, err := f.Filter(issuances)
+	assert.Error(t, err)
+	assert.Equal(t, issuances, res)
+}
+
+func TestCELFilterAnnotations(t *testing.T) {
+	t.Parallel()
+	issuances := []AnnotatedIssuance{
+		{Issuance: api.Issuance{ID: 1, Domains: []string{"www.example.com"}}},
+		{Issuance: api.Issuance{ID: 2, Domains: []string{"pay.example.com"}}, Annotations: Annotations{"owner": "payments"}},
+	}
+	cases := []struct {
+		title    string
+		rules    []CELRule
+		expected map[uint64]Annotations
+		isErr    bool
+	}{
+		{
+			title: "Annotate",
+			rules: []CELRule{
+				{Action: AnnotateAction, Expression: `issuance.dns_names.exists(n, n.startsWith("pay."))`, Annotations: map[string]string{"severity": "high"}},
+			},
+			expected: map[uint64]Annotations{
+				1: nil,
+				2: {"owner": "payments", "severity": "high"},
+			},
+		},
+		{
+			title: "ExistingAnnotations",
+			rules: []CELRule{
+				{Action: AnnotateAction, Expression: `issuance.annotations["owner"] == "payments"`, Annotations: map[string]string{"team": "fin"}},
+				{Expression: `!("owner" in issuance.annotations)`},
+			},
+			expected: map[uint64]Annotations{
+				2: {"owner": "payments", "team": "fin"},
+			},
+		},
+		{
+			title: "MissingAnnotations",
+			rules: []CELRule{{Action: AnnotateAction, Expression: "true"}},
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			f, err := NewCELFilter(tc.rules)
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrMissingAnnotations)
+				return
+			}
+			assert.NoError(t, err)
+			res, err := f.FilterAnnotated(Metadata{}, issuances)
+			assert.NoError(t, err)
+			actual := make(map[uint64]Annotations)
+			for _, issuance := range res {
+				actual[issuance.ID] = issuance.Annotations
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
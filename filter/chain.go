@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// FailurePolicy represents what to do when a filter plugin fails.
+type FailurePolicy string
+
+const (
+	// FailOpen skips the failing plugin. Issuances are passed on to the next one.
+	FailOpen FailurePolicy = "fail-open"
+	// FailClosed stops filtering, so that all issuances are reported unfiltered.
+	FailClosed FailurePolicy = "fail-closed"
+	// Abort stops checking the domain, so that issuances are checked again on the next run.
+	Abort FailurePolicy = "abort"
+
+	defaultTimeout = time.Minute
+)
+
+var (
+	// ErrUnknownFailurePolicy is returned when a failure policy is not supported.
+	ErrUnknownFailurePolicy = fmt.Errorf("unknown failure policy")
+	// ErrFailedClosed is returned when a fail-closed plugin fails.
+	ErrFailedClosed = fmt.Errorf("filter failed closed")
+	// ErrAborted is returned when a plugin set to abort fails.
+	ErrAborted = fmt.Errorf("filter aborted")
+)
+
+// Plugin is a filter plugin along with its configuration.
+type Plugin struct {
+	// Path is the path to the plugin executable.
+	Path string `mapstructure:"path"`
+	// Config is passed as is to v2 plugins. Values must be representable as JSON.
+	// Keys are case-insensitive, and passed in lower case when loaded from the configuration.
+	Config map[string]interface{} `mapstructure:"config"`
+	// OnError is either "fail-open", "fail-closed" or "abort". This defaults to "fail-open".
+	OnError FailurePolicy `mapstructure:"on_error"`
+	// Timeout bounds each call to the plugin, once started. This defaults to 1m.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// SHA256 is the hex-encoded SHA256 checksum of the plugin executable.
+	// If set, the plugin is only started if its checksum matches.
+	SHA256 string `mapstructure:"sha256"`
+}
+
+func (p Plugin) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return p.Timeout
+}
+
+// PluginFilter is an IssuanceFilter running filter plugins in order.
+// Plugins are taken from the pool if set, and started for each call otherwise.
+type PluginFilter struct {
+	Plugins []Plugin
+	Pool    *Pool
+}
+
+// NewPluginFilter checks that plugin configurations can be sent to plugins,
+// and that their failure policies and checksums are valid.
+func NewPluginFilter(plugins []Plugin, pool *Pool) (PluginFilter, error) {
+	for _, p := range plugins {
+		if _, err := p.secureConfig(); err != nil {
+			return PluginFilter{}, fmt.Errorf("plugin %s: %w", p.Path, err)
+		}
+		if _, err := newProtoConfig(p.Config); err != nil {
+			return PluginFilter{}, fmt.Errorf("plugin %s: invalid config: %w", p.Path, err)
+		}
+		switch p.OnError {
+		case FailOpen, FailClosed, Abort, "":
+		default:
+			return PluginFilter{}, fmt.Errorf("plugin %s: %w: %s", p.Path, ErrUnknownFailurePolicy, p.OnError)
+		}
+	}
+	return PluginFilter{Plugins: plugins, Pool: pool}, nil
+}
+
+// Filter implements IssuanceFilter.
+func (f PluginFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	return f.FilterWithMetadata(Metadata{}, is)
+}
+
+// FilterWithMetadata implements MetadataFilter.
+func (f PluginFilter) FilterWithMetadata(md Metadata, is []api.Issuance) ([]api.Issuance, error) {
+	res, err := f.FilterAnnotated(md, Annotate(is))
+	return Issuances(res), err
+}
+
+// FilterAnnotated implements AnnotatingFilter. Failing plugins are handled
+// according to their failure policy. Fail-open plugins are skipped. Other
+// plugins stop the chain of plugins, returning the issuances unfiltered along
+// with ErrFailedClosed, or nothing along with ErrAborted.
+func (f PluginFilter) FilterAnnotated(md Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error) {
+	res := is
+	var errs []error
+	for _, p := range f.Plugins {
+		req := FilterRequest{
+			Metadata:  md,
+			Config:    p.Config,
+			Issuances: res,
+		}
+		var r []AnnotatedIssuance
+		var err error
+		if f.Pool != nil {
+			r, err = f.Pool.Filter(p, req)
+		} else {
+			r, err = applyFilter(p, req)
+		}
+		if err == nil {
+			res = r
+			continue
+		}
+		switch p.OnError {
+		case FailClosed:
+			errs = append(errs, fmt.Errorf("plugin %s: %w: %w", p.Path, ErrFailedClosed, err))
+			return is, errors.Join(errs...)
+		case Abort:
+			errs = append(errs, fmt.Errorf("plugin %s: %w: %w", p.Path, ErrAborted, err))
+			return nil, errors.Join(errs...)
+		default:
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Path, err))
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// Chain is a chain of filters applied in order.
+type Chain []IssuanceFilter
+
+// NewChain compiles a chain applying built-in rules, then CEL expressions, then plugins.
+// Stages without any filters are omitted. Plugins are run from the pool, if any.
+func NewChain(rules []Rule, expressions []CELRule, plugins []Plugin, pool *Pool) (Chain, error) {
+	var chain Chain
+	if len(rules) > 0 {
+		f, err := NewRuleFilter(rules)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	if len(expressions) > 0 {
+		f, err := NewCELFilter(expressions)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	if len(plugins) > 0 {
+		f, err := NewPluginFilter(plugins, pool)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	return chain, nil
+}
+
+// Filter implements IssuanceFilter.
+func (c Chain) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	return c.FilterWithMetadata(Metadata{}, is)
+}
+
+// FilterWithMetadata implements MetadataFilter.
+func (c Chain) FilterWithMetadata(md Metadata, is []api.Issuance) ([]api.Issuance, error) {
+	res, err := c.FilterAnnotated(md, Annotate(is))
+	return Issuances(res), err
+}
+
+// FilterAnnotated implements AnnotatingFilter, passing the metadata and
+// annotations along to filters supporting them. Filters failing along the
+// chain do not stop it: the issuances they return are passed on to the next
+// filter, and errors are returned along with the result. Filters failing closed
+// stop the chain, and the issuances are returned unfiltered. Aborting filters
+// stop the chain, and nothing is returned.
+func (c Chain) FilterAnnotated(md Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error) {
+	res := is
+	var errs []error
+	for _, f := range c {
+		r, err := FilterAnnotated(f, md, res)
+		if err != nil {
+			errs = append(errs, err)
+			if errors.Is(err, ErrAborted) {
+				return nil, errors.Join(errs...)
+			}
+			if errors.Is(err, ErrFailedClosed) {
+				return is, errors.Join(errs...)
+			}
+		}
+		res = r
+	}
+	return res, errors.Join(errs...)
+}
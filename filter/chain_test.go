@@ -0,0 +1,120 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingFilter struct{}
+
+func (failingFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	return is[1:], assert.AnError
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+	chain, err := NewChain(nil, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, chain)
+
+	_, err = NewChain([]Rule{{Action: "drop"}}, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrUnknownAction)
+	_, err = NewChain(nil, []CELRule{{Expression: "("}}, nil, nil)
+	assert.Error(t, err)
+
+	chain, err = NewChain(
+		[]Rule{{DNSNames: []string{"dev.example.com"}}},
+		[]CELRule{{Expression: `issuance.id == 3u`}},
+		nil,
+		nil,
+	)
+	assert.NoError(t, err)
+	// Filters failing along the chain do not stop it.
+	chain = append(Chain{failingFilter{}}, chain...)
+	issuances := []api.Issuance{
+		{ID: 1, Domains: []string{"www.example.com"}},
+		{ID: 2, Domains: []string{"www.example.com"}},
+		{ID: 3, Domains: []string{"www.example.com"}},
+		{ID: 4, Domains: []string{"dev.example.com"}},
+	}
+	actual, err := chain.Filter(issuances)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []api.Issuance{issuances[1]}, actual)
+}
+
+func TestChainFailurePolicy(t *testing.T) {
+	t.Parallel()
+	issuances := []api.Issuance{
+		{ID: 1, Domains: []string{"www.example.com"}},
+		{ID: 2, Domains: []string{"dev.example.com"}},
+		{ID: 3, Domains: []string{"www.example.com"}},
+	}
+	limit := Plugin{Path: testFilterV2Bin, Config: map[string]interface{}{"limit": 1}}
+	failing := func(policy FailurePolicy) Plugin {
+		return Plugin{Path: testFilterV2Bin, Config: map[string]interface{}{"error": "boom"}, OnError: policy}
+	}
+	cases := []struct {
+		title    string
+		plugins  []Plugin
+		expected []api.Issuance
+		err      error
+	}{
+		{
+			title:    "FailOpen",
+			plugins:  []Plugin{failing(FailOpen), limit},
+			expected: issuances[:1],
+		},
+		{
+			title:    "Default",
+			plugins:  []Plugin{failing(""), limit},
+			expected: issuances[:1],
+		},
+		{
+			title:    "FailClosed",
+			plugins:  []Plugin{limit, failing(FailClosed)},
+			expected: issuances,
+			err:      ErrFailedClosed,
+		},
+		{
+			title:   "Abort",
+			plugins: []Plugin{limit, failing(Abort)},
+			err:     ErrAborted,
+		},
+		{
+			title: "Timeout",
+			plugins: []Plugin{
+				{Path: testFilterV2Bin, Config: map[string]interface{}{"delay": "10s"}, Timeout: 100 * time.Millisecond},
+			},
+			expected: []api.Issuance{issuances[0], issuances[2]},
+			err:      ErrTimeout,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			for _, pool := range []*Pool{nil, NewPool()} {
+				chain, err := NewChain([]Rule{{DNSNames: []string{"dev.example.com"}}}, nil, tc.plugins, pool)
+				assert.NoError(t, err)
+				actual, err := chain.Filter(issuances)
+				assert.Error(t, err)
+				if tc.err != nil {
+					assert.ErrorIs(t, err, tc.err)
+				}
+				assert.Equal(t, tc.expected, actual)
+				if pool != nil {
+					pool.Close()
+				}
+			}
+		})
+	}
+
+	_, err := NewChain(nil, nil, []Plugin{failing("ignore")}, nil)
+	assert.ErrorIs(t, err, ErrUnknownFailurePolicy)
+}
@@ -45,7 +45,8 @@ func (s *IssuanceFilterRPCServer) Filter(is []api.Issuance, resp *[]api.Issuance
 	return err
 }
 
-// IssuanceFilterPlugin us an implementation of plugin.Plugin.
+// IssuanceFilterPlugin is an implementation of plugin.Plugin and plugin.GRPCPlugin.
+// Plugins may be served over either net/rpc or gRPC.
 type IssuanceFilterPlugin struct {
 	Impl IssuanceFilter
 }
@@ -1,48 +1,144 @@
 package filter
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os/exec"
 	"time"
 
 	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
 )
 
+var (
+	// ErrUnknownPlugin is returned when a plugin dispenses an unsupported type.
+	ErrUnknownPlugin = fmt.Errorf("unknown plugin type")
+	// ErrTimeout is returned when a plugin does not answer in time.
+	ErrTimeout = fmt.Errorf("filter plugin timed out")
+	// ErrInsecurePlugin is returned when a plugin executable could have been tampered with.
+	ErrInsecurePlugin = fmt.Errorf("insecure plugin")
+	// ErrInvalidChecksum is returned when a plugin checksum is not a hex-encoded SHA256 hash.
+	ErrInvalidChecksum = fmt.Errorf("invalid plugin checksum")
+)
+
 // ApplyFilters runs the filter plugins and returns the resulting issuances.
 // Plugin errors are ignored. It is up to the plugin to log them appropriately.
+// Each plugin is started and stopped on every call. Use a Pool to keep them running.
 func ApplyFilters(filterPaths []string, issuances []api.Issuance) ([]api.Issuance, error) {
 	res := issuances
 	for _, fp := range filterPaths {
-		r, err := applyFilter(fp, res)
+		r, err := applyFilter(Plugin{Path: fp}, FilterRequest{Issuances: Annotate(res)})
 		if err != nil {
 			return res, err
 		}
-		res = r
+		res = Issuances(r)
 	}
 	return res, nil
 }
 
-func applyFilter(filter string, issuances []api.Issuance) ([]api.Issuance, error) {
+// secureConfig returns the configuration verifying the checksum of the plugin, if set.
+func (p Plugin) secureConfig() (*plugin.SecureConfig, error) {
+	if p.SHA256 == "" {
+		return nil, nil
+	}
+	checksum, err := hex.DecodeString(p.SHA256)
+	if err != nil || len(checksum) != sha256.Size {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidChecksum, p.SHA256)
+	}
+	return &plugin.SecureConfig{
+		Checksum: checksum,
+		Hash:     sha256.New(),
+	}, nil
+}
+
+// startPlugin starts the filter plugin and dispenses its filter, negotiating
+// the latest protocol version supported by the plugin. v1 plugins are adapted
+// to IssuanceFilterV2. Plugins are only started if their permissions are safe,
+// and their checksum matches, if set. Logs of the plugin are sent to the logger,
+// as well as anything it writes to its standard output and error. The client
+// is killed on errors.
+func startPlugin(p Plugin, logger hclog.Logger) (*plugin.Client, plugin.ClientProtocol, IssuanceFilterV2, error) {
+	secureConfig, err := p.secureConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd := exec.Command(p.Path)
+	if cmd.Err != nil {
+		return nil, nil, nil, cmd.Err
+	}
+	if err := checkPermissions(cmd.Path); err != nil {
+		return nil, nil, nil, err
+	}
 	client := plugin.NewClient(&plugin.ClientConfig{
 		HandshakeConfig:  HandshakeConfig,
-		Plugins:          PluginMap,
-		Cmd:              exec.Command(filter),
-		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC},
+		VersionedPlugins: VersionedPluginMap,
+		Cmd:              cmd,
+		SecureConfig:     secureConfig,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolNetRPC, plugin.ProtocolGRPC},
 		StartTimeout:     10 * time.Second,
 		Managed:          true,
+		Logger:           logger,
+		SyncStdout:       logger.StandardWriter(&hclog.StandardLoggerOptions{ForceLevel: hclog.Info}),
+		SyncStderr:       logger.StandardWriter(&hclog.StandardLoggerOptions{ForceLevel: hclog.Info}),
 	})
-	defer client.Kill()
 
 	rpcClient, err := client.Client()
 	if err != nil {
-		return issuances, err
+		client.Kill()
+		return nil, nil, nil, err
 	}
 
 	raw, err := rpcClient.Dispense(PluginKey)
 	if err != nil {
-		return issuances, err
+		client.Kill()
+		return nil, nil, nil, err
 	}
 
-	issuanceFilter := raw.(IssuanceFilter)
-	return issuanceFilter.Filter(issuances)
+	switch f := raw.(type) {
+	case IssuanceFilterV2:
+		return client, rpcClient, f, nil
+	case IssuanceFilter:
+		return client, rpcClient, issuanceFilterV1{impl: f}, nil
+	default:
+		client.Kill()
+		return nil, nil, nil, fmt.Errorf("%w: %T", ErrUnknownPlugin, raw)
+	}
+}
+
+// callPlugin sends the request to the plugin. If it does not answer within the
+// timeout, the plugin is killed and ErrTimeout is returned.
+func callPlugin(client *plugin.Client, f IssuanceFilterV2, req FilterRequest, timeout time.Duration) ([]AnnotatedIssuance, error) {
+	type result struct {
+		issuances []AnnotatedIssuance
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := f.Filter(req)
+		done <- result{issuances: res, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.issuances, r.err
+	case <-timer.C:
+		client.Kill()
+		return req.Issuances, fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	}
+}
+
+func applyFilter(p Plugin, req FilterRequest) ([]AnnotatedIssuance, error) {
+	logger := newPluginLogger(log.DefaultLogger(), p.Path, func() string {
+		return req.Domain.Name
+	})
+	client, _, issuanceFilter, err := startPlugin(p, logger)
+	if err != nil {
+		return req.Issuances, err
+	}
+	defer client.Kill()
+	return callPlugin(client, issuanceFilter, req, p.timeout())
 }
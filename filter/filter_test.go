@@ -4,9 +4,15 @@
 package filter
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-plugin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -115,3 +121,36 @@ func TestApplyFilters(t *testing.T) {
 		})
 	}
 }
+
+func TestStartPluginChecksum(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile(testFilterBin)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	cases := []struct {
+		title  string
+		sha256 string
+		err    error
+	}{
+		{title: "NoChecksum"},
+		{title: "Match", sha256: checksum},
+		{title: "MatchUpperCase", sha256: strings.ToUpper(checksum)},
+		{title: "Mismatch", sha256: strings.Repeat("0", 64), err: plugin.ErrChecksumsDoNotMatch},
+		{title: "Invalid", sha256: "not-hex", err: ErrInvalidChecksum},
+		{title: "Short", sha256: "abcd", err: ErrInvalidChecksum},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			client, _, _, err := startPlugin(Plugin{Path: testFilterBin, SHA256: tc.sha256}, newPluginLogger(log.DefaultLogger(), testFilterBin, nil))
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			client.Kill()
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package filter
+
+import (
+	"context"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/filter/proto"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// IssuanceFilterGRPCClient is a plugin implementation over gRPC.
+type IssuanceFilterGRPCClient struct {
+	client proto.IssuanceFilterClient
+}
+
+func (f *IssuanceFilterGRPCClient) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	resp, err := f.client.Filter(context.Background(), &proto.FilterRequest{
+		Issuances: toProtoIssuances(Annotate(is)),
+	})
+	if err != nil {
+		return is, err
+	}
+	return Issuances(fromProtoIssuances(resp.GetIssuances())), nil
+}
+
+// IssuanceFilterGRPCServer is the gRPC server that IssuanceFilterGRPCClient talks to.
+type IssuanceFilterGRPCServer struct {
+	proto.UnimplementedIssuanceFilterServer
+	Impl IssuanceFilter
+}
+
+func (s *IssuanceFilterGRPCServer) Filter(_ context.Context, req *proto.FilterRequest) (*proto.FilterResponse, error) {
+	r, err := s.Impl.Filter(Issuances(fromProtoIssuances(req.GetIssuances())))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.FilterResponse{Issuances: toProtoIssuances(Annotate(r))}, nil
+}
+
+func (p *IssuanceFilterPlugin) GRPCServer(_ *plugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterIssuanceFilterServer(s, &IssuanceFilterGRPCServer{Impl: p.Impl})
+	return nil
+}
+
+func (*IssuanceFilterPlugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &IssuanceFilterGRPCClient{client: proto.NewIssuanceFilterClient(c)}, nil
+}
+
+// IssuanceFilterV2GRPCClient is a v2 plugin implementation over gRPC.
+type IssuanceFilterV2GRPCClient struct {
+	client proto.IssuanceFilterV2Client
+}
+
+func (f *IssuanceFilterV2GRPCClient) Filter(req FilterRequest) ([]AnnotatedIssuance, error) {
+	r, err := toProtoFilterRequest(req)
+	if err != nil {
+		return req.Issuances, err
+	}
+	resp, err := f.client.Filter(context.Background(), r)
+	if err != nil {
+		return req.Issuances, err
+	}
+	return fromProtoIssuances(resp.GetIssuances()), nil
+}
+
+// IssuanceFilterV2GRPCServer is the gRPC server that IssuanceFilterV2GRPCClient talks to.
+type IssuanceFilterV2GRPCServer struct {
+	proto.UnimplementedIssuanceFilterV2Server
+	Impl IssuanceFilterV2
+}
+
+func (s *IssuanceFilterV2GRPCServer) Filter(_ context.Context, req *proto.FilterV2Request) (*proto.FilterResponse, error) {
+	r, err := s.Impl.Filter(fromProtoFilterRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.FilterResponse{Issuances: toProtoIssuances(r)}, nil
+}
+
+func (p *IssuanceFilterV2Plugin) GRPCServer(_ *plugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterIssuanceFilterV2Server(s, &IssuanceFilterV2GRPCServer{Impl: p.Impl})
+	return nil
+}
+
+func (*IssuanceFilterV2Plugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return &IssuanceFilterV2GRPCClient{client: proto.NewIssuanceFilterV2Client(c)}, nil
+}
+
+// newProtoConfig converts a plugin configuration. Only values which can be
+// represented as JSON are supported.
+func newProtoConfig(config map[string]interface{}) (*structpb.Struct, error) {
+	if config == nil {
+		return nil, nil
+	}
+	return structpb.NewStruct(config)
+}
+
+func toProtoFilterRequest(req FilterRequest) (*proto.FilterV2Request, error) {
+	config, err := newProtoConfig(req.Config)
+	if err != nil {
+		return nil, err
+	}
+	res := &proto.FilterV2Request{
+		Issuances: toProtoIssuances(req.Issuances),
+		Domain: &proto.Domain{
+			Name:              req.Domain.Name,
+			MatchWildcards:    req.Domain.MatchWildcards,
+			IncludeSubdomains: req.Domain.IncludeSubdomains,
+			Source:            req.Domain.Source,
+		},
+		Run: &proto.Run{
+			Version: req.Run.Version,
+		},
+		Config: config,
+	}
+	if !req.Run.StartedAt.IsZero() {
+		res.Run.StartedAt = req.Run.StartedAt.Format(time.RFC3339Nano)
+	}
+	return res, nil
+}
+
+func fromProtoFilterRequest(req *proto.FilterV2Request) FilterRequest {
+	res := FilterRequest{
+		Metadata: Metadata{
+			Domain: Domain{
+				Name:              req.GetDomain().GetName(),
+				MatchWildcards:    req.GetDomain().GetMatchWildcards(),
+				IncludeSubdomains: req.GetDomain().GetIncludeSubdomains(),
+				Source:            req.GetDomain().GetSource(),
+			},
+			Run: Run{
+				Version: req.GetRun().GetVersion(),
+			},
+		},
+		Issuances: fromProtoIssuances(req.GetIssuances()),
+	}
+	if req.GetConfig() != nil {
+		res.Config = req.GetConfig().AsMap()
+	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, req.GetRun().GetStartedAt()); err == nil {
+		res.Run.StartedAt = startedAt
+	}
+	return res
+}
+
+func toProtoIssuances(is []AnnotatedIssuance) []*proto.Issuance {
+	res := make([]*proto.Issuance, 0, len(is))
+	for _, i := range is {
+		res = append(res, toProtoIssuance(i))
+	}
+	return res
+}
+
+func toProtoIssuance(annotated AnnotatedIssuance) *proto.Issuance {
+	i := annotated.Issuance
+	res := &proto.Issuance{
+		Id:           i.ID,
+		TbsSha256:    i.TBSSHA256,
+		DnsNames:     i.Domains,
+		PubkeySha256: i.PubKeySHA256,
+		Issuer: &proto.Issuer{
+			Name:         i.Issuer.Name,
+			PubkeySha256: i.Issuer.PubKeySHA256,
+			FriendlyName: i.Issuer.FriendlyName,
+			Website:      i.Issuer.Website,
+			CaaDomains:   i.Issuer.CAADomains,
+			Operator: &proto.Operator{
+				Name:    i.Issuer.Operator.Name,
+				Website: i.Issuer.Operator.Website,
+			},
+		},
+		NotBefore: i.NotBefore,
+		NotAfter:  i.NotAfter,
+		Cert: &proto.Certificate{
+			Type:   i.Cert.Type,
+			Sha256: i.Cert.SHA256,
+			Data:   i.Cert.Data,
+		},
+		CertDer:          i.CertDER,
+		CertSha256:       i.CertSHA256,
+		ProblemReporting: i.ProblemReporting,
+		Revoked:          i.Revoked,
+		Revocation: &proto.Revocation{
+			Time:      i.Revocation.Time,
+			CheckedAt: i.Revocation.CheckedAt,
+		},
+		Pubkey: &proto.PubKey{
+			Type:      i.PubKey.Type,
+			BitLength: int32(i.PubKey.BitLength),
+			Curve:     i.PubKey.Curve,
+		},
+		Annotations: annotated.Annotations,
+	}
+	if i.Revocation.Reason != nil {
+		reason := int32(*i.Revocation.Reason)
+		res.Revocation.Reason = &reason
+	}
+	return res
+}
+
+func fromProtoIssuances(is []*proto.Issuance) []AnnotatedIssuance {
+	res := make([]AnnotatedIssuance, 0, len(is))
+	for _, i := range is {
+		res = append(res, fromProtoIssuance(i))
+	}
+	return res
+}
+
+// fromProtoIssuance converts a protobuf issuance. Getters are used throughout,
+// since plugins may omit any field.
+func fromProtoIssuance(i *proto.Issuance) AnnotatedIssuance {
+	res := api.Issuance{
+		ID:           i.GetId(),
+		TBSSHA256:    i.GetTbsSha256(),
+		Domains:      i.GetDnsNames(),
+		PubKeySHA256: i.GetPubkeySha256(),
+		Issuer: api.Issuer{
+			Name:         i.GetIssuer().GetName(),
+			PubKeySHA256: i.GetIssuer().GetPubkeySha256(),
+			FriendlyName: i.GetIssuer().GetFriendlyName(),
+			Website:      i.GetIssuer().GetWebsite(),
+			CAADomains:   i.GetIssuer().GetCaaDomains(),
+			Operator: api.Operator{
+				Name:    i.GetIssuer().GetOperator().GetName(),
+				Website: i.GetIssuer().GetOperator().GetWebsite(),
+			},
+		},
+		NotBefore: i.GetNotBefore(),
+		NotAfter:  i.GetNotAfter(),
+		Cert: api.Certificate{
+			Type:   i.GetCert().GetType(),
+			SHA256: i.GetCert().GetSha256(),
+			Data:   i.GetCert().GetData(),
+		},
+		CertDER:          i.GetCertDer(),
+		CertSHA256:       i.GetCertSha256(),
+		ProblemReporting: i.GetProblemReporting(),
+		Revoked:          i.GetRevoked(),
+		Revocation: api.Revocation{
+			Time:      i.GetRevocation().GetTime(),
+			CheckedAt: i.GetRevocation().GetCheckedAt(),
+		},
+		PubKey: api.PubKey{
+			Type:      i.GetPubkey().GetType(),
+			BitLength: int(i.GetPubkey().GetBitLength()),
+			Curve:     i.GetPubkey().GetCurve(),
+		},
+	}
+	if i.GetRevocation() != nil && i.GetRevocation().Reason != nil {
+		reason := int(i.GetRevocation().GetReason())
+		res.Revocation.Reason = &reason
+	}
+	return AnnotatedIssuance{Issuance: res, Annotations: i.GetAnnotations()}
+}
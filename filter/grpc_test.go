@@ -0,0 +1,155 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+type truncateFilter struct {
+	err error
+}
+
+func (f truncateFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(is) > 1 {
+		return is[:1], nil
+	}
+	return is, nil
+}
+
+func fullIssuance() api.Issuance {
+	reason := 4
+	return api.Issuance{
+		ID:           42,
+		TBSSHA256:    "tbs",
+		Domains:      []string{"example.com", "www.example.com"},
+		PubKeySHA256: "pubkey",
+		Issuer: api.Issuer{
+			Name:         "C=US, O=Let's Encrypt, CN=R3",
+			PubKeySHA256: "issuer",
+			FriendlyName: "Let's Encrypt",
+			Website:      "https://letsencrypt.org",
+			CAADomains:   []string{"letsencrypt.org"},
+			Operator: api.Operator{
+				Name:    "ISRG",
+				Website: "https://www.abetterinternet.org",
+			},
+		},
+		NotBefore: "2026-01-01T00:00:00Z",
+		NotAfter:  "2026-04-01T00:00:00Z",
+		Cert: api.Certificate{
+			Type:   "precert",
+			SHA256: "cert",
+			Data:   "data",
+		},
+		CertDER:          "der",
+		CertSHA256:       "cert",
+		ProblemReporting: "mailto:abuse@example.com",
+		Revoked:          true,
+		Revocation: api.Revocation{
+			Time:      "2026-02-01T00:00:00Z",
+			Reason:    &reason,
+			CheckedAt: "2026-02-02T00:00:00Z",
+		},
+		PubKey: api.PubKey{
+			Type:      "ecdsa",
+			BitLength: 256,
+			Curve:     "P-256",
+		},
+	}
+}
+
+func TestProtoIssuance(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		issuance AnnotatedIssuance
+	}{
+		{
+			title:    "Full",
+			issuance: AnnotatedIssuance{Issuance: fullIssuance()},
+		},
+		{
+			title: "NoReason",
+			issuance: AnnotatedIssuance{Issuance: api.Issuance{
+				ID:      1,
+				Domains: []string{"example.com"},
+			}},
+		},
+		{
+			title: "Annotations",
+			issuance: AnnotatedIssuance{
+				Issuance:    fullIssuance(),
+				Annotations: Annotations{"severity": "high", "owner": "payments"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual := fromProtoIssuance(toProtoIssuance(tc.issuance))
+			assert.Equal(t, tc.issuance, actual)
+		})
+	}
+}
+
+func TestIssuanceFilterGRPC(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title     string
+		impl      IssuanceFilter
+		issuances []api.Issuance
+		expected  []api.Issuance
+		isErr     bool
+	}{
+		{
+			title:     "Empty",
+			impl:      truncateFilter{},
+			issuances: []api.Issuance{},
+			expected:  []api.Issuance{},
+		},
+		{
+			title:     "Multiple",
+			impl:      truncateFilter{},
+			issuances: []api.Issuance{fullIssuance(), {ID: 2, Domains: []string{"example.com"}}},
+			expected:  []api.Issuance{fullIssuance()},
+		},
+		{
+			title:     "Error",
+			impl:      truncateFilter{err: errors.New("filter error")},
+			issuances: []api.Issuance{fullIssuance()},
+			expected:  []api.Issuance{fullIssuance()},
+			isErr:     true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			client, server := plugin.TestPluginGRPCConn(t, false, map[string]plugin.Plugin{
+				PluginKey: &IssuanceFilterPlugin{Impl: tc.impl},
+			})
+			defer client.Close()
+			defer server.Stop()
+			raw, err := client.Dispense(PluginKey)
+			assert.NoError(t, err)
+			actual, err := raw.(IssuanceFilter).Filter(tc.issuances)
+			if tc.isErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	stdlog "log"
+	"strings"
+
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-hclog"
+)
+
+// pluginLogger is an hclog.Logger forwarding logs of plugins and of go-plugin
+// to cybozu-go/log. Entries are tagged with the path of the plugin, and with
+// the domain being filtered when it is known.
+type pluginLogger struct {
+	logger *log.Logger
+	name   string
+	args   []interface{}
+	path   string
+	domain func() string
+}
+
+// newPluginLogger returns a logger for the plugin. domain returns the domain
+// being filtered, or an empty string if unknown.
+func newPluginLogger(logger *log.Logger, path string, domain func() string) *pluginLogger {
+	return &pluginLogger{
+		logger: logger,
+		path:   path,
+		domain: domain,
+	}
+}
+
+// fieldName returns a field name accepted by cybozu-go/log. Reserved names
+// are prefixed with "plugin_", and invalid characters are replaced with "_".
+func fieldName(k string) string {
+	name := []byte(strings.ToLower(k))
+	for i, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = append([]byte{'_'}, name...)
+	}
+	if log.ReservedKey(string(name)) {
+		return "plugin_" + string(name)
+	}
+	return string(name)
+}
+
+func addFields(fields map[string]interface{}, args []interface{}) {
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fields["extra_value_at_end"] = args[i]
+			break
+		}
+		fields[fieldName(fmt.Sprint(args[i]))] = args[i+1]
+	}
+}
+
+// toSeverity maps hclog levels to cybozu-go/log severities.
+func toSeverity(level hclog.Level) int {
+	switch level {
+	case hclog.Trace, hclog.Debug:
+		return log.LvDebug
+	case hclog.Warn:
+		return log.LvWarn
+	case hclog.Error:
+		return log.LvError
+	default:
+		return log.LvInfo
+	}
+}
+
+// parseLogLine parses lines logged by plugins with the JSON formatter of
+// cybozu-go/log, which go-plugin passes on verbatim at the debug level.
+func parseLogLine(line string) (int, string, map[string]interface{}, bool) {
+	if !strings.HasPrefix(line, "{") {
+		return 0, "", nil, false
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return 0, "", nil, false
+	}
+	severity, ok := raw[log.FnSeverity].(string)
+	if !ok {
+		return 0, "", nil, false
+	}
+	msg, ok := raw[log.FnMessage].(string)
+	if !ok {
+		return 0, "", nil, false
+	}
+	for _, lv := range []int{log.LvCritical, log.LvError, log.LvWarn, log.LvInfo, log.LvDebug} {
+		if log.LevelName(lv) != severity {
+			continue
+		}
+		fields := make(map[string]interface{}, len(raw))
+		for k, v := range raw {
+			if !log.ReservedKey(k) {
+				fields[fieldName(k)] = v
+			}
+		}
+		return lv, msg, fields, true
+	}
+	return 0, "", nil, false
+}
+
+// Log implements hclog.Logger.
+func (l *pluginLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	if level == hclog.Off {
+		return
+	}
+	severity := toSeverity(level)
+	fields := make(map[string]interface{}, len(l.args)/2+len(args)/2+2)
+	if len(args) == 0 {
+		if lv, m, f, ok := parseLogLine(msg); ok {
+			severity, msg, fields = lv, m, f
+		}
+	}
+	if !l.logger.Enabled(severity) {
+		return
+	}
+	addFields(fields, l.args)
+	addFields(fields, args)
+	fields["plugin"] = l.path
+	if l.domain != nil {
+		if domain := l.domain(); domain != "" {
+			fields[log.FnDomain] = domain
+		}
+	}
+	_ = l.logger.Log(severity, msg, fields)
+}
+
+// Trace implements hclog.Logger.
+func (l *pluginLogger) Trace(msg string, args ...interface{}) {
+	l.Log(hclog.Trace, msg, args...)
+}
+
+// Debug implements hclog.Logger.
+func (l *pluginLogger) Debug(msg string, args ...interface{}) {
+	l.Log(hclog.Debug, msg, args...)
+}
+
+// Info implements hclog.Logger.
+func (l *pluginLogger) Info(msg string, args ...interface{}) {
+	l.Log(hclog.Info, msg, args...)
+}
+
+// Warn implements hclog.Logger.
+func (l *pluginLogger) Warn(msg string, args ...interface{}) {
+	l.Log(hclog.Warn, msg, args...)
+}
+
+// Error implements hclog.Logger.
+func (l *pluginLogger) Error(msg string, args ...interface{}) {
+	l.Log(hclog.Error, msg, args...)
+}
+
+// IsTrace implements hclog.Logger.
+func (l *pluginLogger) IsTrace() bool {
+	return l.logger.Enabled(log.LvDebug)
+}
+
+// IsDebug implements hclog.Logger.
+func (l *pluginLogger) IsDebug() bool {
+	return l.logger.Enabled(log.LvDebug)
+}
+
+// IsInfo implements hclog.Logger.
+func (l *pluginLogger) IsInfo() bool {
+	return l.logger.Enabled(log.LvInfo)
+}
+
+// IsWarn implements hclog.Logger.
+func (l *pluginLogger) IsWarn() bool {
+	return l.logger.Enabled(log.LvWarn)
+}
+
+// IsError implements hclog.Logger.
+func (l *pluginLogger) IsError() bool {
+	return l.logger.Enabled(log.LvError)
+}
+
+// ImpliedArgs implements hclog.Logger.
+func (l *pluginLogger) ImpliedArgs() []interface{} {
+	return l.args
+}
+
+// With implements hclog.Logger.
+func (l *pluginLogger) With(args ...interface{}) hclog.Logger {
+	nl := *l
+	nl.args = append(append([]interface{}{}, l.args...), args...)
+	return &nl
+}
+
+// Name implements hclog.Logger.
+func (l *pluginLogger) Name() string {
+	return l.name
+}
+
+// Named implements hclog.Logger.
+func (l *pluginLogger) Named(name string) hclog.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return l.ResetNamed(name)
+}
+
+// ResetNamed implements hclog.Logger.
+func (l *pluginLogger) ResetNamed(name string) hclog.Logger {
+	nl := *l
+	nl.name = name
+	return &nl
+}
+
+// SetLevel implements hclog.Logger. Levels are set with the threshold of
+// cybozu-go/log instead, so this does nothing.
+func (*pluginLogger) SetLevel(hclog.Level) {}
+
+// GetLevel implements hclog.Logger. Debug entries are let through as trace
+// entries, so that go-plugin does not discard them.
+func (l *pluginLogger) GetLevel() hclog.Level {
+	switch {
+	case l.logger.Enabled(log.LvDebug):
+		return hclog.Trace
+	case l.logger.Enabled(log.LvInfo):
+		return hclog.Info
+	case l.logger.Enabled(log.LvWarn):
+		return hclog.Warn
+	default:
+		return hclog.Error
+	}
+}
+
+// StandardLogger implements hclog.Logger.
+func (l *pluginLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *stdlog.Logger {
+	return stdlog.New(l.StandardWriter(opts), "", 0)
+}
+
+// StandardWriter implements hclog.Logger. Each line written is logged at the
+// forced level, if any, and at the info level otherwise.
+func (l *pluginLogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	level := hclog.Info
+	if opts != nil && opts.ForceLevel != hclog.NoLevel {
+		level = opts.ForceLevel
+	}
+	return lineWriter{logger: l, level: level}
+}
+
+// lineWriter logs each line written to it.
+type lineWriter struct {
+	logger hclog.Logger
+	level  hclog.Level
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			w.logger.Log(w.level, line)
+		}
+	}
+	return len(p), nil
+}
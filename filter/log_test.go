@@ -0,0 +1,195 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger(threshold int) (*log.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := log.NewLogger()
+	logger.SetFormatter(log.JSONFormat{})
+	logger.SetOutput(&buf)
+	logger.SetThreshold(threshold)
+	return logger, &buf
+}
+
+func readLogEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFieldName(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"error":     "error",
+		"@module":   "_module",
+		"Plugin-ID": "plugin_id",
+		"1st":       "_1st",
+		"":          "_",
+		"message":   "plugin_message",
+		"severity":  "plugin_severity",
+	}
+	for k, expected := range cases {
+		assert.Equal(t, expected, fieldName(k), k)
+		assert.True(t, log.IsValidKey(fieldName(k)), k)
+	}
+}
+
+func TestPluginLogger(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title     string
+		threshold int
+		log       func(l hclog.Logger)
+		expected  []map[string]interface{}
+	}{
+		{
+			title:     "Levels",
+			threshold: log.LvInfo,
+			log: func(l hclog.Logger) {
+				l.Trace("trace")
+				l.Debug("debug")
+				l.Info("info")
+				l.Warn("warn", "count", 1)
+				l.Error("error", "error", "boom")
+			},
+			expected: []map[string]interface{}{
+				{"severity": "info", "message": "info"},
+				{"severity": "warning", "message": "warn", "count": 1.0},
+				{"severity": "error", "message": "error", "error": "boom"},
+			},
+		},
+		{
+			title:     "Debug",
+			threshold: log.LvDebug,
+			log: func(l hclog.Logger) {
+				l.Trace("trace")
+				l.Debug("debug")
+			},
+			expected: []map[string]interface{}{
+				{"severity": "debug", "message": "trace"},
+				{"severity": "debug", "message": "debug"},
+			},
+		},
+		{
+			title:     "Args",
+			threshold: log.LvInfo,
+			log: func(l hclog.Logger) {
+				l.Named("testfilter").With("@module", "filter", "plugin", "other").Info("info", "message", "hello", "odd")
+			},
+			expected: []map[string]interface{}{
+				{"severity": "info", "message": "info", "_module": "filter", "plugin_message": "hello", "extra_value_at_end": "odd"},
+			},
+		},
+		{
+			title:     "JSONLine",
+			threshold: log.LvInfo,
+			log: func(l hclog.Logger) {
+				l.Debug(`{"topic":"testfilter","logged_at":"2026-01-01T00:00:00Z","severity":"warning","utsname":"host","message":"running","issuances":2,"domain":"example.net"}`)
+				l.Debug(`{"@level":"unknown"}`)
+			},
+			expected: []map[string]interface{}{
+				{"severity": "warning", "message": "running", "issuances": 2.0},
+			},
+		},
+		{
+			title:     "Writer",
+			threshold: log.LvInfo,
+			log: func(l hclog.Logger) {
+				w := l.StandardWriter(&hclog.StandardLoggerOptions{ForceLevel: hclog.Warn})
+				_, _ = w.Write([]byte("first\nsecond\r\n\n"))
+			},
+			expected: []map[string]interface{}{
+				{"severity": "warning", "message": "first"},
+				{"severity": "warning", "message": "second"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			logger, buf := newTestLogger(tc.threshold)
+			tc.log(newPluginLogger(logger, "/usr/local/bin/testfilter", func() string {
+				return "example.com"
+			}))
+			entries := readLogEntries(t, buf)
+			if !assert.Len(t, entries, len(tc.expected)) {
+				return
+			}
+			for i, expected := range tc.expected {
+				expected["plugin"] = "/usr/local/bin/testfilter"
+				expected["domain"] = "example.com"
+				for k, v := range expected {
+					assert.Equal(t, v, entries[i][k], k)
+				}
+			}
+		})
+	}
+}
+
+func TestPluginLoggerLevel(t *testing.T) {
+	t.Parallel()
+	cases := map[int]hclog.Level{
+		log.LvDebug:    hclog.Trace,
+		log.LvInfo:     hclog.Info,
+		log.LvWarn:     hclog.Warn,
+		log.LvError:    hclog.Error,
+		log.LvCritical: hclog.Error,
+	}
+	for threshold, expected := range cases {
+		logger, _ := newTestLogger(threshold)
+		assert.Equal(t, expected, newPluginLogger(logger, "", nil).GetLevel())
+	}
+}
+
+func TestPluginLogForwarding(t *testing.T) {
+	t.Parallel()
+	logger, buf := newTestLogger(log.LvInfo)
+	p := Plugin{Path: testFilterV2Bin}
+	client, _, f, err := startPlugin(p, newPluginLogger(logger, p.Path, func() string {
+		return "example.com"
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = f.Filter(FilterRequest{
+		Metadata:  Metadata{Domain: Domain{Name: "example.com"}},
+		Issuances: Annotate([]api.Issuance{{ID: 1, Domains: []string{"example.com"}}}),
+	})
+	assert.NoError(t, err)
+	client.Kill()
+
+	var found bool
+	for _, entry := range readLogEntries(t, buf) {
+		if entry["message"] != "running sample v2 filter" {
+			continue
+		}
+		found = true
+		assert.Equal(t, "info", entry["severity"])
+		assert.Equal(t, testFilterV2Bin, entry["plugin"])
+		assert.Equal(t, "example.com", entry["domain"])
+		assert.Equal(t, 1.0, entry["issuances"])
+	}
+	assert.True(t, found, buf.String())
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package filter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkPermissions refuses plugins which users other than the current user or
+// root could replace: the executable and the directory containing it, both
+// before and after resolving symbolic links, must be owned by the current user
+// or root, and must not be world-writable. World-writable directories with the
+// sticky bit set, such as /tmp, are allowed since only the owner of an entry
+// may replace or rename it there.
+func checkPermissions(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{resolved, filepath.Dir(abs), filepath.Dir(resolved)} {
+		if err := checkWritable(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWritable refuses files and directories which users other than the
+// current user or root could write to.
+func checkWritable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode()
+	if mode.Perm()&0o002 != 0 && !(mode.IsDir() && mode&os.ModeSticky != 0) {
+		return fmt.Errorf("%w: %s is world-writable", ErrInsecurePlugin, path)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if st.Uid != 0 && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%w: %s is owned by uid %d", ErrInsecurePlugin, path, st.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build test && !windows
+// +build test,!windows
+
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile(testFilterBin)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	assert.NoError(t, os.Chmod(dir, 0o755))
+	uid, gid := os.Getuid(), os.Getgid()
+	cases := []struct {
+		title   string
+		mode    os.FileMode
+		dirMode os.FileMode
+		uid     int
+		gid     int
+		isErr   bool
+	}{
+		{title: "Safe", mode: 0o755, dirMode: 0o755, uid: uid, gid: gid},
+		{title: "GroupWritable", mode: 0o775, dirMode: 0o755, uid: uid, gid: gid + 1000},
+		{title: "WorldWritable", mode: 0o757, dirMode: 0o755, uid: uid, gid: gid, isErr: true},
+		{title: "OtherOwner", mode: 0o755, dirMode: 0o755, uid: uid + 1000, gid: gid, isErr: true},
+		{title: "GroupWritableDir", mode: 0o755, dirMode: 0o2775, uid: uid, gid: gid + 1000},
+		{title: "WorldWritableDir", mode: 0o755, dirMode: 0o777, uid: uid, gid: gid, isErr: true},
+		{title: "StickyDir", mode: 0o755, dirMode: 0o777 | os.ModeSticky, uid: uid, gid: gid},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			if (tc.uid != uid || tc.gid != gid) && uid != 0 {
+				t.Skip("changing the owner of files requires root")
+			}
+			pluginDir := filepath.Join(dir, tc.title)
+			path := filepath.Join(pluginDir, "plugin")
+			assert.NoError(t, os.Mkdir(pluginDir, 0o755))
+			assert.NoError(t, os.WriteFile(path, data, tc.mode))
+			assert.NoError(t, os.Chmod(path, tc.mode))
+			assert.NoError(t, os.Chmod(pluginDir, tc.dirMode))
+			assert.NoError(t, os.Chown(path, tc.uid, tc.gid))
+			assert.NoError(t, os.Chown(pluginDir, uid, tc.gid))
+			err := checkPermissions(path)
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrInsecurePlugin)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Symbolic links are checked along with their target.
+	safe := filepath.Join(dir, "safe")
+	assert.NoError(t, os.WriteFile(safe, data, 0o755))
+	links := filepath.Join(dir, "links")
+	assert.NoError(t, os.Mkdir(links, 0o755))
+	assert.NoError(t, os.Symlink(safe, filepath.Join(links, "plugin")))
+	assert.NoError(t, checkPermissions(filepath.Join(links, "plugin")))
+	assert.NoError(t, os.Chmod(links, 0o777))
+	assert.ErrorIs(t, checkPermissions(filepath.Join(links, "plugin")), ErrInsecurePlugin)
+	assert.NoError(t, os.Chmod(safe, 0o777))
+	assert.NoError(t, os.Chmod(links, 0o755))
+	assert.ErrorIs(t, checkPermissions(filepath.Join(links, "plugin")), ErrInsecurePlugin)
+
+	// Only the directory containing the plugin is checked.
+	parent := filepath.Join(dir, "parent")
+	assert.NoError(t, os.MkdirAll(filepath.Join(parent, "plugins"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(parent, "plugins", "plugin"), data, 0o755))
+	assert.NoError(t, os.Chmod(parent, 0o777))
+	assert.NoError(t, checkPermissions(filepath.Join(parent, "plugins", "plugin")))
+
+	assert.Error(t, checkPermissions(filepath.Join(dir, "nonexistent")))
+
+	// Insecure plugins are not started.
+	path := filepath.Join(dir, "insecure")
+	assert.NoError(t, os.WriteFile(path, data, 0o755))
+	assert.NoError(t, os.Chmod(path, 0o777))
+	_, err = applyFilter(Plugin{Path: path}, FilterRequest{})
+	assert.ErrorIs(t, err, ErrInsecurePlugin)
+}
@@ -0,0 +1,167 @@
+package filter
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-plugin"
+)
+
+// pluginProcess is a running filter plugin process.
+type pluginProcess struct {
+	client *plugin.Client
+	proto  plugin.ClientProtocol
+	filter IssuanceFilterV2
+}
+
+// healthy tells whether the plugin process is still running and responding.
+func (pr *pluginProcess) healthy() bool {
+	return !pr.client.Exited() && pr.proto.Ping() == nil
+}
+
+// pooledPlugin is a filter plugin kept by the pool, along with its running process.
+type pooledPlugin struct {
+	// mu serializes (re)starts of the plugin and guards process.
+	mu      sync.Mutex
+	process *pluginProcess
+
+	domainsMu sync.Mutex
+	// domains counts the calls in flight for each domain.
+	domains map[string]int
+}
+
+// domain returns the domain being filtered, if the plugin is only filtering
+// issuances for a single domain, so that its logs can be attributed to it.
+func (pp *pooledPlugin) domain() string {
+	pp.domainsMu.Lock()
+	defer pp.domainsMu.Unlock()
+	if len(pp.domains) != 1 {
+		return ""
+	}
+	for domain := range pp.domains {
+		return domain
+	}
+	return ""
+}
+
+// start returns the running plugin process, (re)starting it if needed.
+// Concurrent callers wait for the plugin being started instead of starting it again.
+func (pp *pooledPlugin) start(fp Plugin) (*pluginProcess, error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.process != nil {
+		if pp.process.healthy() {
+			return pp.process, nil
+		}
+		_ = log.Warn("filter plugin is unhealthy, restarting", map[string]interface{}{
+			"filter": fp.Path,
+		})
+		pp.process.client.Kill()
+		pp.process = nil
+	}
+	client, proto, f, err := startPlugin(fp, newPluginLogger(log.DefaultLogger(), fp.Path, pp.domain))
+	if err != nil {
+		return nil, err
+	}
+	pp.process = &pluginProcess{
+		client: client,
+		proto:  proto,
+		filter: f,
+	}
+	return pp.process, nil
+}
+
+// stop kills the plugin process, if any.
+func (pp *pooledPlugin) stop() {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.process != nil {
+		pp.process.client.Kill()
+		pp.process = nil
+	}
+}
+
+// call sends the request to the plugin process, killing it on timeouts.
+func (pp *pooledPlugin) call(pr *pluginProcess, req FilterRequest, timeout time.Duration) ([]AnnotatedIssuance, error) {
+	domain := req.Domain.Name
+	pp.domainsMu.Lock()
+	pp.domains[domain]++
+	pp.domainsMu.Unlock()
+	defer func() {
+		pp.domainsMu.Lock()
+		defer pp.domainsMu.Unlock()
+		if pp.domains[domain]--; pp.domains[domain] == 0 {
+			delete(pp.domains, domain)
+		}
+	}()
+	return callPlugin(pr.client, pr.filter, req, timeout)
+}
+
+// Pool keeps filter plugins running, so that a single process per plugin is
+// shared across domains and runs. Plugins are started on first use, and
+// restarted if they are found to have crashed or to be unresponsive.
+// Plugins may be called concurrently, and different plugins may be started concurrently.
+type Pool struct {
+	mu      sync.Mutex
+	plugins map[string]*pooledPlugin
+}
+
+// NewPool returns an empty pool.
+func NewPool() *Pool {
+	return &Pool{
+		plugins: make(map[string]*pooledPlugin),
+	}
+}
+
+// get returns the pooled plugin, adding it to the pool if needed. Plugins are
+// keyed by their path and checksum, so that plugins started without checking
+// their checksum are not used in place of those with a checksum set.
+func (p *Pool) get(fp Plugin) *pooledPlugin {
+	key := fp.Path
+	if fp.SHA256 != "" {
+		key += "@" + strings.ToLower(fp.SHA256)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pp, ok := p.plugins[key]
+	if !ok {
+		pp = &pooledPlugin{
+			domains: make(map[string]int),
+		}
+		p.plugins[key] = pp
+	}
+	return pp
+}
+
+// Filter sends the request to the plugin. If the plugin crashes while
+// filtering, it is restarted and the request is sent once more. Plugins timing
+// out are killed, and restarted on their next use.
+func (p *Pool) Filter(fp Plugin, req FilterRequest) ([]AnnotatedIssuance, error) {
+	pp := p.get(fp)
+	pr, err := pp.start(fp)
+	if err != nil {
+		return req.Issuances, err
+	}
+	res, err := pp.call(pr, req, fp.timeout())
+	if err == nil || errors.Is(err, ErrTimeout) || pr.healthy() {
+		return res, err
+	}
+	pr, err = pp.start(fp)
+	if err != nil {
+		return req.Issuances, err
+	}
+	return pp.call(pr, req, fp.timeout())
+}
+
+// Close stops all plugins in the pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, pp := range p.plugins {
+		pp.stop()
+		delete(p.plugins, key)
+	}
+}
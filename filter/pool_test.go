@@ -0,0 +1,89 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+	// Annotations are kept by v1 plugins.
+	issuances := []AnnotatedIssuance{
+		{Issuance: api.Issuance{ID: 1, Domains: []string{"www.example.com"}}, Annotations: Annotations{"severity": "high"}},
+		{Issuance: api.Issuance{ID: 2, Domains: []string{"dev.example.com"}}},
+	}
+	pool := NewPool()
+	defer pool.Close()
+
+	req := FilterRequest{Issuances: issuances}
+	actual, err := pool.Filter(Plugin{Path: testFilterBin}, req)
+	assert.NoError(t, err)
+	assert.Equal(t, issuances[:1], actual)
+	first := pool.plugins[testFilterBin].process
+
+	// The running plugin is reused.
+	actual, err = PluginFilter{Plugins: []Plugin{{Path: testFilterBin}, {Path: testFilterBin}}, Pool: pool}.FilterAnnotated(Metadata{}, issuances)
+	assert.NoError(t, err)
+	assert.Equal(t, issuances[:1], actual)
+	assert.Same(t, first, pool.plugins[testFilterBin].process)
+
+	// Crashed plugins are restarted.
+	first.client.Kill()
+	actual, err = pool.Filter(Plugin{Path: testFilterBin}, req)
+	assert.NoError(t, err)
+	assert.Equal(t, issuances[:1], actual)
+	assert.NotSame(t, first, pool.plugins[testFilterBin].process)
+	assert.True(t, pool.plugins[testFilterBin].process.healthy())
+
+	_, err = pool.Filter(Plugin{Path: "/nonexistent"}, req)
+	assert.Error(t, err)
+	assert.Nil(t, pool.plugins["/nonexistent"].process)
+
+	pool.Close()
+	assert.Empty(t, pool.plugins)
+	assert.True(t, first.client.Exited())
+}
+
+func TestPoolConcurrentStart(t *testing.T) {
+	t.Parallel()
+	pool := NewPool()
+	defer pool.Close()
+	req := FilterRequest{Issuances: []AnnotatedIssuance{{Issuance: api.Issuance{ID: 1, Domains: []string{"www.example.com"}}}}}
+	processes := make([]*pluginProcess, 8)
+	var wg sync.WaitGroup
+	for i := range processes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pool.Filter(Plugin{Path: testFilterBin}, req)
+			assert.NoError(t, err)
+			pool.mu.Lock()
+			pp := pool.plugins[testFilterBin]
+			pool.mu.Unlock()
+			pp.mu.Lock()
+			processes[i] = pp.process
+			pp.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	// Concurrent first uses start a single process.
+	for _, pr := range processes {
+		assert.Same(t, processes[0], pr)
+	}
+}
+
+func TestPooledPluginDomain(t *testing.T) {
+	t.Parallel()
+	pp := &pooledPlugin{domains: make(map[string]int)}
+	assert.Empty(t, pp.domain())
+	pp.domains["example.com"] = 2
+	assert.Equal(t, "example.com", pp.domain())
+	pp.domains["example.net"] = 1
+	assert.Empty(t, pp.domain())
+}
@@ -0,0 +1,946 @@
+// Protocol for ct-monitor issuance filter plugins served over gRPC.
+// Plugins receive the issuances observed for a domain and return those which
+// should be reported. Messages mirror the issuance objects of the Cert Spotter API.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11-devel
+// 	protoc        (unknown)
+// source: filter/proto/filter.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FilterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Issuances     []*Issuance            `protobuf:"bytes,1,rep,name=issuances,proto3" json:"issuances,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilterRequest) Reset() {
+	*x = FilterRequest{}
+	mi := &file_filter_proto_filter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterRequest) ProtoMessage() {}
+
+func (x *FilterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterRequest.ProtoReflect.Descriptor instead.
+func (*FilterRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FilterRequest) GetIssuances() []*Issuance {
+	if x != nil {
+		return x.Issuances
+	}
+	return nil
+}
+
+type FilterV2Request struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Issuances []*Issuance            `protobuf:"bytes,1,rep,name=issuances,proto3" json:"issuances,omitempty"`
+	Domain    *Domain                `protobuf:"bytes,2,opt,name=domain,proto3" json:"domain,omitempty"`
+	Run       *Run                   `protobuf:"bytes,3,opt,name=run,proto3" json:"run,omitempty"`
+	// Configuration of the plugin, as set in filter_config.
+	Config        *structpb.Struct `protobuf:"bytes,4,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilterV2Request) Reset() {
+	*x = FilterV2Request{}
+	mi := &file_filter_proto_filter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilterV2Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterV2Request) ProtoMessage() {}
+
+func (x *FilterV2Request) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterV2Request.ProtoReflect.Descriptor instead.
+func (*FilterV2Request) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FilterV2Request) GetIssuances() []*Issuance {
+	if x != nil {
+		return x.Issuances
+	}
+	return nil
+}
+
+func (x *FilterV2Request) GetDomain() *Domain {
+	if x != nil {
+		return x.Domain
+	}
+	return nil
+}
+
+func (x *FilterV2Request) GetRun() *Run {
+	if x != nil {
+		return x.Run
+	}
+	return nil
+}
+
+func (x *FilterV2Request) GetConfig() *structpb.Struct {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type FilterResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Issuances     []*Issuance            `protobuf:"bytes,1,rep,name=issuances,proto3" json:"issuances,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FilterResponse) Reset() {
+	*x = FilterResponse{}
+	mi := &file_filter_proto_filter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FilterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterResponse) ProtoMessage() {}
+
+func (x *FilterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterResponse.ProtoReflect.Descriptor instead.
+func (*FilterResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FilterResponse) GetIssuances() []*Issuance {
+	if x != nil {
+		return x.Issuances
+	}
+	return nil
+}
+
+// Domain is the monitored domain issuances are filtered for.
+type Domain struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Name              string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	MatchWildcards    bool                   `protobuf:"varint,2,opt,name=match_wildcards,json=matchWildcards,proto3" json:"match_wildcards,omitempty"`
+	IncludeSubdomains bool                   `protobuf:"varint,3,opt,name=include_subdomains,json=includeSubdomains,proto3" json:"include_subdomains,omitempty"`
+	// Name of the issuance source the domain is queried from.
+	Source        string `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Domain) Reset() {
+	*x = Domain{}
+	mi := &file_filter_proto_filter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Domain) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Domain) ProtoMessage() {}
+
+func (x *Domain) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Domain.ProtoReflect.Descriptor instead.
+func (*Domain) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Domain) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Domain) GetMatchWildcards() bool {
+	if x != nil {
+		return x.MatchWildcards
+	}
+	return false
+}
+
+func (x *Domain) GetIncludeSubdomains() bool {
+	if x != nil {
+		return x.IncludeSubdomains
+	}
+	return false
+}
+
+func (x *Domain) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+// Run describes the ct-monitor run issuances are filtered in.
+type Run struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// RFC 3339 timestamp of when the run started.
+	StartedAt string `protobuf:"bytes,1,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	// Version of ct-monitor.
+	Version       string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Run) Reset() {
+	*x = Run{}
+	mi := &file_filter_proto_filter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Run) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Run) ProtoMessage() {}
+
+func (x *Run) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Run.ProtoReflect.Descriptor instead.
+func (*Run) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Run) GetStartedAt() string {
+	if x != nil {
+		return x.StartedAt
+	}
+	return ""
+}
+
+func (x *Run) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+// Issuance represents a certificate issuance.
+// Timestamps are formatted as RFC 3339 strings.
+type Issuance struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TbsSha256    string                 `protobuf:"bytes,2,opt,name=tbs_sha256,json=tbsSha256,proto3" json:"tbs_sha256,omitempty"`
+	DnsNames     []string               `protobuf:"bytes,3,rep,name=dns_names,json=dnsNames,proto3" json:"dns_names,omitempty"`
+	PubkeySha256 string                 `protobuf:"bytes,4,opt,name=pubkey_sha256,json=pubkeySha256,proto3" json:"pubkey_sha256,omitempty"`
+	Issuer       *Issuer                `protobuf:"bytes,5,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	NotBefore    string                 `protobuf:"bytes,6,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter     string                 `protobuf:"bytes,7,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	// Deprecated in the Cert Spotter API, use cert_der and cert_sha256 instead.
+	Cert *Certificate `protobuf:"bytes,8,opt,name=cert,proto3" json:"cert,omitempty"`
+	// Base64-encoded DER certificate.
+	CertDer          string      `protobuf:"bytes,9,opt,name=cert_der,json=certDer,proto3" json:"cert_der,omitempty"`
+	CertSha256       string      `protobuf:"bytes,10,opt,name=cert_sha256,json=certSha256,proto3" json:"cert_sha256,omitempty"`
+	ProblemReporting string      `protobuf:"bytes,11,opt,name=problem_reporting,json=problemReporting,proto3" json:"problem_reporting,omitempty"`
+	Revoked          bool        `protobuf:"varint,12,opt,name=revoked,proto3" json:"revoked,omitempty"`
+	Revocation       *Revocation `protobuf:"bytes,13,opt,name=revocation,proto3" json:"revocation,omitempty"`
+	Pubkey           *PubKey     `protobuf:"bytes,14,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	// Labels attached by filters, such as severity=high. Only v2 plugins may set them.
+	Annotations   map[string]string `protobuf:"bytes,15,rep,name=annotations,proto3" json:"annotations,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Issuance) Reset() {
+	*x = Issuance{}
+	mi := &file_filter_proto_filter_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Issuance) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Issuance) ProtoMessage() {}
+
+func (x *Issuance) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Issuance.ProtoReflect.Descriptor instead.
+func (*Issuance) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Issuance) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Issuance) GetTbsSha256() string {
+	if x != nil {
+		return x.TbsSha256
+	}
+	return ""
+}
+
+func (x *Issuance) GetDnsNames() []string {
+	if x != nil {
+		return x.DnsNames
+	}
+	return nil
+}
+
+func (x *Issuance) GetPubkeySha256() string {
+	if x != nil {
+		return x.PubkeySha256
+	}
+	return ""
+}
+
+func (x *Issuance) GetIssuer() *Issuer {
+	if x != nil {
+		return x.Issuer
+	}
+	return nil
+}
+
+func (x *Issuance) GetNotBefore() string {
+	if x != nil {
+		return x.NotBefore
+	}
+	return ""
+}
+
+func (x *Issuance) GetNotAfter() string {
+	if x != nil {
+		return x.NotAfter
+	}
+	return ""
+}
+
+func (x *Issuance) GetCert() *Certificate {
+	if x != nil {
+		return x.Cert
+	}
+	return nil
+}
+
+func (x *Issuance) GetCertDer() string {
+	if x != nil {
+		return x.CertDer
+	}
+	return ""
+}
+
+func (x *Issuance) GetCertSha256() string {
+	if x != nil {
+		return x.CertSha256
+	}
+	return ""
+}
+
+func (x *Issuance) GetProblemReporting() string {
+	if x != nil {
+		return x.ProblemReporting
+	}
+	return ""
+}
+
+func (x *Issuance) GetRevoked() bool {
+	if x != nil {
+		return x.Revoked
+	}
+	return false
+}
+
+func (x *Issuance) GetRevocation() *Revocation {
+	if x != nil {
+		return x.Revocation
+	}
+	return nil
+}
+
+func (x *Issuance) GetPubkey() *PubKey {
+	if x != nil {
+		return x.Pubkey
+	}
+	return nil
+}
+
+func (x *Issuance) GetAnnotations() map[string]string {
+	if x != nil {
+		return x.Annotations
+	}
+	return nil
+}
+
+type Issuer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	PubkeySha256  string                 `protobuf:"bytes,2,opt,name=pubkey_sha256,json=pubkeySha256,proto3" json:"pubkey_sha256,omitempty"`
+	FriendlyName  string                 `protobuf:"bytes,3,opt,name=friendly_name,json=friendlyName,proto3" json:"friendly_name,omitempty"`
+	Website       string                 `protobuf:"bytes,4,opt,name=website,proto3" json:"website,omitempty"`
+	CaaDomains    []string               `protobuf:"bytes,5,rep,name=caa_domains,json=caaDomains,proto3" json:"caa_domains,omitempty"`
+	Operator      *Operator              `protobuf:"bytes,6,opt,name=operator,proto3" json:"operator,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Issuer) Reset() {
+	*x = Issuer{}
+	mi := &file_filter_proto_filter_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Issuer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Issuer) ProtoMessage() {}
+
+func (x *Issuer) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Issuer.ProtoReflect.Descriptor instead.
+func (*Issuer) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Issuer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Issuer) GetPubkeySha256() string {
+	if x != nil {
+		return x.PubkeySha256
+	}
+	return ""
+}
+
+func (x *Issuer) GetFriendlyName() string {
+	if x != nil {
+		return x.FriendlyName
+	}
+	return ""
+}
+
+func (x *Issuer) GetWebsite() string {
+	if x != nil {
+		return x.Website
+	}
+	return ""
+}
+
+func (x *Issuer) GetCaaDomains() []string {
+	if x != nil {
+		return x.CaaDomains
+	}
+	return nil
+}
+
+func (x *Issuer) GetOperator() *Operator {
+	if x != nil {
+		return x.Operator
+	}
+	return nil
+}
+
+type Operator struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Website       string                 `protobuf:"bytes,2,opt,name=website,proto3" json:"website,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operator) Reset() {
+	*x = Operator{}
+	mi := &file_filter_proto_filter_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operator) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operator) ProtoMessage() {}
+
+func (x *Operator) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operator.ProtoReflect.Descriptor instead.
+func (*Operator) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Operator) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Operator) GetWebsite() string {
+	if x != nil {
+		return x.Website
+	}
+	return ""
+}
+
+type Certificate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Either "cert" or "precert".
+	Type   string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Sha256 string `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	// Base64-encoded DER certificate.
+	Data          string `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Certificate) Reset() {
+	*x = Certificate{}
+	mi := &file_filter_proto_filter_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Certificate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Certificate) ProtoMessage() {}
+
+func (x *Certificate) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Certificate.ProtoReflect.Descriptor instead.
+func (*Certificate) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Certificate) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Certificate) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *Certificate) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+type Revocation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Time  string                 `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// CRL reason code, unset if unknown.
+	Reason        *int32 `protobuf:"varint,2,opt,name=reason,proto3,oneof" json:"reason,omitempty"`
+	CheckedAt     string `protobuf:"bytes,3,opt,name=checked_at,json=checkedAt,proto3" json:"checked_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Revocation) Reset() {
+	*x = Revocation{}
+	mi := &file_filter_proto_filter_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Revocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Revocation) ProtoMessage() {}
+
+func (x *Revocation) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Revocation.ProtoReflect.Descriptor instead.
+func (*Revocation) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Revocation) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *Revocation) GetReason() int32 {
+	if x != nil && x.Reason != nil {
+		return *x.Reason
+	}
+	return 0
+}
+
+func (x *Revocation) GetCheckedAt() string {
+	if x != nil {
+		return x.CheckedAt
+	}
+	return ""
+}
+
+type PubKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	BitLength     int32                  `protobuf:"varint,2,opt,name=bit_length,json=bitLength,proto3" json:"bit_length,omitempty"`
+	Curve         string                 `protobuf:"bytes,3,opt,name=curve,proto3" json:"curve,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PubKey) Reset() {
+	*x = PubKey{}
+	mi := &file_filter_proto_filter_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PubKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PubKey) ProtoMessage() {}
+
+func (x *PubKey) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_filter_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PubKey.ProtoReflect.Descriptor instead.
+func (*PubKey) Descriptor() ([]byte, []int) {
+	return file_filter_proto_filter_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PubKey) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *PubKey) GetBitLength() int32 {
+	if x != nil {
+		return x.BitLength
+	}
+	return 0
+}
+
+func (x *PubKey) GetCurve() string {
+	if x != nil {
+		return x.Curve
+	}
+	return ""
+}
+
+var File_filter_proto_filter_proto protoreflect.FileDescriptor
+
+const file_filter_proto_filter_proto_rawDesc = "" +
+	"\n" +
+	"\x19filter/proto/filter.proto\x12\x13ctmonitor.filter.v1\x1a\x1cgoogle/protobuf/struct.proto\"L\n" +
+	"\rFilterRequest\x12;\n" +
+	"\tissuances\x18\x01 \x03(\v2\x1d.ctmonitor.filter.v1.IssuanceR\tissuances\"\xe0\x01\n" +
+	"\x0fFilterV2Request\x12;\n" +
+	"\tissuances\x18\x01 \x03(\v2\x1d.ctmonitor.filter.v1.IssuanceR\tissuances\x123\n" +
+	"\x06domain\x18\x02 \x01(\v2\x1b.ctmonitor.filter.v1.DomainR\x06domain\x12*\n" +
+	"\x03run\x18\x03 \x01(\v2\x18.ctmonitor.filter.v1.RunR\x03run\x12/\n" +
+	"\x06config\x18\x04 \x01(\v2\x17.google.protobuf.StructR\x06config\"M\n" +
+	"\x0eFilterResponse\x12;\n" +
+	"\tissuances\x18\x01 \x03(\v2\x1d.ctmonitor.filter.v1.IssuanceR\tissuances\"\x8c\x01\n" +
+	"\x06Domain\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12'\n" +
+	"\x0fmatch_wildcards\x18\x02 \x01(\bR\x0ematchWildcards\x12-\n" +
+	"\x12include_subdomains\x18\x03 \x01(\bR\x11includeSubdomains\x12\x16\n" +
+	"\x06source\x18\x04 \x01(\tR\x06source\">\n" +
+	"\x03Run\x12\x1d\n" +
+	"\n" +
+	"started_at\x18\x01 \x01(\tR\tstartedAt\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\"\xad\x05\n" +
+	"\bIssuance\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x1d\n" +
+	"\n" +
+	"tbs_sha256\x18\x02 \x01(\tR\ttbsSha256\x12\x1b\n" +
+	"\tdns_names\x18\x03 \x03(\tR\bdnsNames\x12#\n" +
+	"\rpubkey_sha256\x18\x04 \x01(\tR\fpubkeySha256\x123\n" +
+	"\x06issuer\x18\x05 \x01(\v2\x1b.ctmonitor.filter.v1.IssuerR\x06issuer\x12\x1d\n" +
+	"\n" +
+	"not_before\x18\x06 \x01(\tR\tnotBefore\x12\x1b\n" +
+	"\tnot_after\x18\a \x01(\tR\bnotAfter\x124\n" +
+	"\x04cert\x18\b \x01(\v2 .ctmonitor.filter.v1.CertificateR\x04cert\x12\x19\n" +
+	"\bcert_der\x18\t \x01(\tR\acertDer\x12\x1f\n" +
+	"\vcert_sha256\x18\n" +
+	" \x01(\tR\n" +
+	"certSha256\x12+\n" +
+	"\x11problem_reporting\x18\v \x01(\tR\x10problemReporting\x12\x18\n" +
+	"\arevoked\x18\f \x01(\bR\arevoked\x12?\n" +
+	"\n" +
+	"revocation\x18\r \x01(\v2\x1f.ctmonitor.filter.v1.RevocationR\n" +
+	"revocation\x123\n" +
+	"\x06pubkey\x18\x0e \x01(\v2\x1b.ctmonitor.filter.v1.PubKeyR\x06pubkey\x12P\n" +
+	"\vannotations\x18\x0f \x03(\v2..ctmonitor.filter.v1.Issuance.AnnotationsEntryR\vannotations\x1a>\n" +
+	"\x10AnnotationsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xdc\x01\n" +
+	"\x06Issuer\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12#\n" +
+	"\rpubkey_sha256\x18\x02 \x01(\tR\fpubkeySha256\x12#\n" +
+	"\rfriendly_name\x18\x03 \x01(\tR\ffriendlyName\x12\x18\n" +
+	"\awebsite\x18\x04 \x01(\tR\awebsite\x12\x1f\n" +
+	"\vcaa_domains\x18\x05 \x03(\tR\n" +
+	"caaDomains\x129\n" +
+	"\boperator\x18\x06 \x01(\v2\x1d.ctmonitor.filter.v1.OperatorR\boperator\"8\n" +
+	"\bOperator\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\awebsite\x18\x02 \x01(\tR\awebsite\"M\n" +
+	"\vCertificate\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x16\n" +
+	"\x06sha256\x18\x02 \x01(\tR\x06sha256\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\tR\x04data\"g\n" +
+	"\n" +
+	"Revocation\x12\x12\n" +
+	"\x04time\x18\x01 \x01(\tR\x04time\x12\x1b\n" +
+	"\x06reason\x18\x02 \x01(\x05H\x00R\x06reason\x88\x01\x01\x12\x1d\n" +
+	"\n" +
+	"checked_at\x18\x03 \x01(\tR\tcheckedAtB\t\n" +
+	"\a_reason\"Q\n" +
+	"\x06PubKey\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1d\n" +
+	"\n" +
+	"bit_length\x18\x02 \x01(\x05R\tbitLength\x12\x14\n" +
+	"\x05curve\x18\x03 \x01(\tR\x05curve2c\n" +
+	"\x0eIssuanceFilter\x12Q\n" +
+	"\x06Filter\x12\".ctmonitor.filter.v1.FilterRequest\x1a#.ctmonitor.filter.v1.FilterResponse2g\n" +
+	"\x10IssuanceFilterV2\x12S\n" +
+	"\x06Filter\x12$.ctmonitor.filter.v1.FilterV2Request\x1a#.ctmonitor.filter.v1.FilterResponseB+Z)github.com/Hsn723/ct-monitor/filter/protob\x06proto3"
+
+var (
+	file_filter_proto_filter_proto_rawDescOnce sync.Once
+	file_filter_proto_filter_proto_rawDescData []byte
+)
+
+func file_filter_proto_filter_proto_rawDescGZIP() []byte {
+	file_filter_proto_filter_proto_rawDescOnce.Do(func() {
+		file_filter_proto_filter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_filter_proto_filter_proto_rawDesc), len(file_filter_proto_filter_proto_rawDesc)))
+	})
+	return file_filter_proto_filter_proto_rawDescData
+}
+
+var file_filter_proto_filter_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_filter_proto_filter_proto_goTypes = []any{
+	(*FilterRequest)(nil),   // 0: ctmonitor.filter.v1.FilterRequest
+	(*FilterV2Request)(nil), // 1: ctmonitor.filter.v1.FilterV2Request
+	(*FilterResponse)(nil),  // 2: ctmonitor.filter.v1.FilterResponse
+	(*Domain)(nil),          // 3: ctmonitor.filter.v1.Domain
+	(*Run)(nil),             // 4: ctmonitor.filter.v1.Run
+	(*Issuance)(nil),        // 5: ctmonitor.filter.v1.Issuance
+	(*Issuer)(nil),          // 6: ctmonitor.filter.v1.Issuer
+	(*Operator)(nil),        // 7: ctmonitor.filter.v1.Operator
+	(*Certificate)(nil),     // 8: ctmonitor.filter.v1.Certificate
+	(*Revocation)(nil),      // 9: ctmonitor.filter.v1.Revocation
+	(*PubKey)(nil),          // 10: ctmonitor.filter.v1.PubKey
+	nil,                     // 11: ctmonitor.filter.v1.Issuance.AnnotationsEntry
+	(*structpb.Struct)(nil), // 12: google.protobuf.Struct
+}
+var file_filter_proto_filter_proto_depIdxs = []int32{
+	5,  // 0: ctmonitor.filter.v1.FilterRequest.issuances:type_name -> ctmonitor.filter.v1.Issuance
+	5,  // 1: ctmonitor.filter.v1.FilterV2Request.issuances:type_name -> ctmonitor.filter.v1.Issuance
+	3,  // 2: ctmonitor.filter.v1.FilterV2Request.domain:type_name -> ctmonitor.filter.v1.Domain
+	4,  // 3: ctmonitor.filter.v1.FilterV2Request.run:type_name -> ctmonitor.filter.v1.Run
+	12, // 4: ctmonitor.filter.v1.FilterV2Request.config:type_name -> google.protobuf.Struct
+	5,  // 5: ctmonitor.filter.v1.FilterResponse.issuances:type_name -> ctmonitor.filter.v1.Issuance
+	6,  // 6: ctmonitor.filter.v1.Issuance.issuer:type_name -> ctmonitor.filter.v1.Issuer
+	8,  // 7: ctmonitor.filter.v1.Issuance.cert:type_name -> ctmonitor.filter.v1.Certificate
+	9,  // 8: ctmonitor.filter.v1.Issuance.revocation:type_name -> ctmonitor.filter.v1.Revocation
+	10, // 9: ctmonitor.filter.v1.Issuance.pubkey:type_name -> ctmonitor.filter.v1.PubKey
+	11, // 10: ctmonitor.filter.v1.Issuance.annotations:type_name -> ctmonitor.filter.v1.Issuance.AnnotationsEntry
+	7,  // 11: ctmonitor.filter.v1.Issuer.operator:type_name -> ctmonitor.filter.v1.Operator
+	0,  // 12: ctmonitor.filter.v1.IssuanceFilter.Filter:input_type -> ctmonitor.filter.v1.FilterRequest
+	1,  // 13: ctmonitor.filter.v1.IssuanceFilterV2.Filter:input_type -> ctmonitor.filter.v1.FilterV2Request
+	2,  // 14: ctmonitor.filter.v1.IssuanceFilter.Filter:output_type -> ctmonitor.filter.v1.FilterResponse
+	2,  // 15: ctmonitor.filter.v1.IssuanceFilterV2.Filter:output_type -> ctmonitor.filter.v1.FilterResponse
+	14, // [14:16] is the sub-list for method output_type
+	12, // [12:14] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_filter_proto_filter_proto_init() }
+func file_filter_proto_filter_proto_init() {
+	if File_filter_proto_filter_proto != nil {
+		return
+	}
+	file_filter_proto_filter_proto_msgTypes[9].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_filter_proto_filter_proto_rawDesc), len(file_filter_proto_filter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_filter_proto_filter_proto_goTypes,
+		DependencyIndexes: file_filter_proto_filter_proto_depIdxs,
+		MessageInfos:      file_filter_proto_filter_proto_msgTypes,
+	}.Build()
+	File_filter_proto_filter_proto = out.File
+	file_filter_proto_filter_proto_goTypes = nil
+	file_filter_proto_filter_proto_depIdxs = nil
+}
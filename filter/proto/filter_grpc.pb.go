@@ -0,0 +1,243 @@
+// Protocol for ct-monitor issuance filter plugins served over gRPC.
+// Plugins receive the issuances observed for a domain and return those which
+// should be reported. Messages mirror the issuance objects of the Cert Spotter API.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: filter/proto/filter.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IssuanceFilter_Filter_FullMethodName = "/ctmonitor.filter.v1.IssuanceFilter/Filter"
+)
+
+// IssuanceFilterClient is the client API for IssuanceFilter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IssuanceFilter filters issuances. It is served by plugins negotiating
+// version 1 of the plugin protocol.
+type IssuanceFilterClient interface {
+	// Filter returns the issuances which should be reported.
+	Filter(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*FilterResponse, error)
+}
+
+type issuanceFilterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIssuanceFilterClient(cc grpc.ClientConnInterface) IssuanceFilterClient {
+	return &issuanceFilterClient{cc}
+}
+
+func (c *issuanceFilterClient) Filter(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*FilterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FilterResponse)
+	err := c.cc.Invoke(ctx, IssuanceFilter_Filter_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IssuanceFilterServer is the server API for IssuanceFilter service.
+// All implementations must embed UnimplementedIssuanceFilterServer
+// for forward compatibility.
+//
+// IssuanceFilter filters issuances. It is served by plugins negotiating
+// version 1 of the plugin protocol.
+type IssuanceFilterServer interface {
+	// Filter returns the issuances which should be reported.
+	Filter(context.Context, *FilterRequest) (*FilterResponse, error)
+	mustEmbedUnimplementedIssuanceFilterServer()
+}
+
+// UnimplementedIssuanceFilterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIssuanceFilterServer struct{}
+
+func (UnimplementedIssuanceFilterServer) Filter(context.Context, *FilterRequest) (*FilterResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Filter not implemented")
+}
+func (UnimplementedIssuanceFilterServer) mustEmbedUnimplementedIssuanceFilterServer() {}
+func (UnimplementedIssuanceFilterServer) testEmbeddedByValue()                        {}
+
+// UnsafeIssuanceFilterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IssuanceFilterServer will
+// result in compilation errors.
+type UnsafeIssuanceFilterServer interface {
+	mustEmbedUnimplementedIssuanceFilterServer()
+}
+
+func RegisterIssuanceFilterServer(s grpc.ServiceRegistrar, srv IssuanceFilterServer) {
+	// If the following call panics, it indicates UnimplementedIssuanceFilterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IssuanceFilter_ServiceDesc, srv)
+}
+
+func _IssuanceFilter_Filter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IssuanceFilterServer).Filter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IssuanceFilter_Filter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IssuanceFilterServer).Filter(ctx, req.(*FilterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// IssuanceFilter_ServiceDesc is the grpc.ServiceDesc for IssuanceFilter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IssuanceFilter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ctmonitor.filter.v1.IssuanceFilter",
+	HandlerType: (*IssuanceFilterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Filter",
+			Handler:    _IssuanceFilter_Filter_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "filter/proto/filter.proto",
+}
+
+const (
+	IssuanceFilterV2_Filter_FullMethodName = "/ctmonitor.filter.v1.IssuanceFilterV2/Filter"
+)
+
+// IssuanceFilterV2Client is the client API for IssuanceFilterV2 service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IssuanceFilterV2 filters issuances, given the domain and run they are
+// filtered for. It is served by plugins negotiating version 2 of the plugin protocol.
+type IssuanceFilterV2Client interface {
+	// Filter returns the issuances which should be reported.
+	Filter(ctx context.Context, in *FilterV2Request, opts ...grpc.CallOption) (*FilterResponse, error)
+}
+
+type issuanceFilterV2Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIssuanceFilterV2Client(cc grpc.ClientConnInterface) IssuanceFilterV2Client {
+	return &issuanceFilterV2Client{cc}
+}
+
+func (c *issuanceFilterV2Client) Filter(ctx context.Context, in *FilterV2Request, opts ...grpc.CallOption) (*FilterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FilterResponse)
+	err := c.cc.Invoke(ctx, IssuanceFilterV2_Filter_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IssuanceFilterV2Server is the server API for IssuanceFilterV2 service.
+// All implementations must embed UnimplementedIssuanceFilterV2Server
+// for forward compatibility.
+//
+// IssuanceFilterV2 filters issuances, given the domain and run they are
+// filtered for. It is served by plugins negotiating version 2 of the plugin protocol.
+type IssuanceFilterV2Server interface {
+	// Filter returns the issuances which should be reported.
+	Filter(context.Context, *FilterV2Request) (*FilterResponse, error)
+	mustEmbedUnimplementedIssuanceFilterV2Server()
+}
+
+// UnimplementedIssuanceFilterV2Server must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIssuanceFilterV2Server struct{}
+
+func (UnimplementedIssuanceFilterV2Server) Filter(context.Context, *FilterV2Request) (*FilterResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Filter not implemented")
+}
+func (UnimplementedIssuanceFilterV2Server) mustEmbedUnimplementedIssuanceFilterV2Server() {}
+func (UnimplementedIssuanceFilterV2Server) testEmbeddedByValue()                          {}
+
+// UnsafeIssuanceFilterV2Server may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IssuanceFilterV2Server will
+// result in compilation errors.
+type UnsafeIssuanceFilterV2Server interface {
+	mustEmbedUnimplementedIssuanceFilterV2Server()
+}
+
+func RegisterIssuanceFilterV2Server(s grpc.ServiceRegistrar, srv IssuanceFilterV2Server) {
+	// If the following call panics, it indicates UnimplementedIssuanceFilterV2Server was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IssuanceFilterV2_ServiceDesc, srv)
+}
+
+func _IssuanceFilterV2_Filter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilterV2Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IssuanceFilterV2Server).Filter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IssuanceFilterV2_Filter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IssuanceFilterV2Server).Filter(ctx, req.(*FilterV2Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// IssuanceFilterV2_ServiceDesc is the grpc.ServiceDesc for IssuanceFilterV2 service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IssuanceFilterV2_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ctmonitor.filter.v1.IssuanceFilterV2",
+	HandlerType: (*IssuanceFilterV2Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Filter",
+			Handler:    _IssuanceFilterV2_Filter_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "filter/proto/filter.proto",
+}
@@ -0,0 +1,245 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// Action represents what to do with issuances matching a rule.
+type Action string
+
+const (
+	// ExcludeAction discards issuances matching the rule.
+	ExcludeAction Action = "exclude"
+	// MatchAction keeps issuances matching the rule. When match rules are set,
+	// issuances matching none of them are discarded.
+	MatchAction Action = "match"
+	// AnnotateAction attaches annotations to issuances matching the rule, without
+	// discarding any. Annotations of later rules take precedence.
+	AnnotateAction Action = "annotate"
+)
+
+var (
+	// ErrUnknownAction is returned when a rule action is not supported.
+	ErrUnknownAction = fmt.Errorf("unknown rule action")
+	// ErrMissingAnnotations is returned when an annotate rule has no annotations.
+	ErrMissingAnnotations = fmt.Errorf("missing annotations")
+)
+
+// Rule is a built-in filter rule. A rule matches an issuance if all of its
+// conditions are satisfied. Conditions which are not set are ignored, and a
+// condition listing several values is satisfied if any of them matches.
+type Rule struct {
+	// Action is either "exclude", "match" or "annotate". This defaults to "exclude".
+	Action Action `mapstructure:"action"`
+	// Annotations are attached to issuances matching annotate rules.
+	Annotations map[string]string `mapstructure:"annotations"`
+	// DNSNames are glob patterns, where * matches any sequence of characters.
+	// The condition is satisfied if every DNS name of the issuance matches a pattern,
+	// so that excluding a name does not hide certificates also covering other names.
+	DNSNames []string `mapstructure:"dns_names"`
+	// DNSNameRegexps are regular expressions, with the same semantics as DNSNames.
+	DNSNameRegexps []string `mapstructure:"dns_name_regexps"`
+	// IssuerNames are glob patterns matched against the issuer's distinguished name
+	// or friendly name, ignoring case.
+	IssuerNames []string `mapstructure:"issuer_names"`
+	// IssuerPubKeySHA256 are hex-encoded SHA256 hashes of the issuer's public key.
+	IssuerPubKeySHA256 []string `mapstructure:"issuer_pubkey_sha256"`
+	// PubKeySHA256 are hex-encoded SHA256 hashes of the certificate's public key.
+	PubKeySHA256 []string `mapstructure:"pubkey_sha256"`
+	// MinValidity and MaxValidity bound the validity period of the certificate.
+	MinValidity time.Duration `mapstructure:"min_validity"`
+	MaxValidity time.Duration `mapstructure:"max_validity"`
+	// Wildcard, if set, requires the certificate to include, or not include, wildcard names.
+	Wildcard *bool `mapstructure:"wildcard"`
+}
+
+type compiledRule struct {
+	Rule
+	dnsNameRegexps []*regexp.Regexp
+}
+
+// RuleFilter is an IssuanceFilter applying built-in rules.
+// Issuances are kept if they match any of the match rules, or if there are
+// no match rules, and if they match none of the exclude rules. Issuances kept
+// are then annotated by the annotate rules they match.
+type RuleFilter struct {
+	match    []compiledRule
+	exclude  []compiledRule
+	annotate []compiledRule
+}
+
+// NewRuleFilter compiles rules into a RuleFilter.
+func NewRuleFilter(rules []Rule) (*RuleFilter, error) {
+	f := &RuleFilter{}
+	for i, r := range rules {
+		c := compiledRule{Rule: r}
+		c.DNSNames = toLower(r.DNSNames)
+		c.IssuerNames = toLower(r.IssuerNames)
+		c.IssuerPubKeySHA256 = toLower(r.IssuerPubKeySHA256)
+		c.PubKeySHA256 = toLower(r.PubKeySHA256)
+		for _, pattern := range slices.Concat(c.DNSNames, c.IssuerNames) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: %q: %w", i, pattern, err)
+			}
+		}
+		for _, expr := range r.DNSNameRegexps {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			c.dnsNameRegexps = append(c.dnsNameRegexps, re)
+		}
+		switch r.Action {
+		case ExcludeAction, "":
+			f.exclude = append(f.exclude, c)
+		case MatchAction:
+			f.match = append(f.match, c)
+		case AnnotateAction:
+			if len(r.Annotations) == 0 {
+				return nil, fmt.Errorf("rule %d: %w", i, ErrMissingAnnotations)
+			}
+			f.annotate = append(f.annotate, c)
+		default:
+			return nil, fmt.Errorf("rule %d: %w: %s", i, ErrUnknownAction, r.Action)
+		}
+	}
+	return f, nil
+}
+
+func toLower(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = strings.ToLower(v)
+	}
+	return res
+}
+
+// Filter implements IssuanceFilter.
+func (f *RuleFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	res, err := f.FilterAnnotated(Metadata{}, Annotate(is))
+	return Issuances(res), err
+}
+
+// FilterAnnotated implements AnnotatingFilter.
+func (f *RuleFilter) FilterAnnotated(_ Metadata, is []AnnotatedIssuance) ([]AnnotatedIssuance, error) {
+	res := make([]AnnotatedIssuance, 0, len(is))
+	for _, issuance := range is {
+		if !f.keep(issuance.Issuance) {
+			continue
+		}
+		for _, r := range f.annotate {
+			if r.matches(issuance.Issuance) {
+				issuance.Annotations = issuance.Annotations.merge(r.Annotations)
+			}
+		}
+		res = append(res, issuance)
+	}
+	return res, nil
+}
+
+func (f *RuleFilter) keep(issuance api.Issuance) bool {
+	if len(f.match) > 0 && !anyRuleMatches(f.match, issuance) {
+		return false
+	}
+	return !anyRuleMatches(f.exclude, issuance)
+}
+
+func anyRuleMatches(rules []compiledRule, issuance api.Issuance) bool {
+	for _, r := range rules {
+		if r.matches(issuance) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r compiledRule) matches(issuance api.Issuance) bool {
+	names := toLower(issuance.Domains)
+	if len(r.DNSNames) > 0 && !allNamesMatch(names, func(name string) bool { return matchGlobs(r.DNSNames, name) }) {
+		return false
+	}
+	if len(r.dnsNameRegexps) > 0 && !allNamesMatch(names, func(name string) bool { return matchRegexps(r.dnsNameRegexps, name) }) {
+		return false
+	}
+	if len(r.IssuerNames) > 0 && !matchGlobs(r.IssuerNames, strings.ToLower(issuance.Issuer.Name)) && !matchGlobs(r.IssuerNames, strings.ToLower(issuance.Issuer.FriendlyName)) {
+		return false
+	}
+	if len(r.IssuerPubKeySHA256) > 0 && !slices.Contains(r.IssuerPubKeySHA256, strings.ToLower(issuance.Issuer.PubKeySHA256)) {
+		return false
+	}
+	if len(r.PubKeySHA256) > 0 && !slices.Contains(r.PubKeySHA256, strings.ToLower(issuance.PubKeySHA256)) {
+		return false
+	}
+	if r.MinValidity > 0 || r.MaxValidity > 0 {
+		validity, ok := validityPeriod(issuance)
+		if !ok || (r.MinValidity > 0 && validity < r.MinValidity) || (r.MaxValidity > 0 && validity > r.MaxValidity) {
+			return false
+		}
+	}
+	if r.Wildcard != nil && hasWildcard(names) != *r.Wildcard {
+		return false
+	}
+	return true
+}
+
+func allNamesMatch(names []string, match func(string) bool) bool {
+	if len(names) == 0 {
+		return false
+	}
+	for _, name := range names {
+		if !match(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchGlobs(patterns []string, s string) bool {
+	// Patterns are validated when compiling rules, so errors are not expected here.
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegexps(regexps []*regexp.Regexp, s string) bool {
+	for _, re := range regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func validityPeriod(issuance api.Issuance) (time.Duration, bool) {
+	notBefore, err := time.Parse(time.RFC3339, issuance.NotBefore)
+	if err != nil {
+		return 0, false
+	}
+	notAfter, err := time.Parse(time.RFC3339, issuance.NotAfter)
+	if err != nil {
+		return 0, false
+	}
+	return notAfter.Sub(notBefore), true
+}
+
+func hasWildcard(names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleFilter(t *testing.T) {
+	t.Parallel()
+	yes, no := true, false
+	issuances := []api.Issuance{
+		{
+			ID:        1,
+			Domains:   []string{"www.example.com", "example.com"},
+			Issuer:    api.Issuer{Name: "C=US, O=Let's Encrypt, CN=R3", FriendlyName: "Let's Encrypt", PubKeySHA256: "AA"},
+			NotBefore: "2026-01-01T00:00:00Z",
+			NotAfter:  "2026-04-01T00:00:00Z",
+		},
+		{
+			ID:           2,
+			Domains:      []string{"dev.example.com"},
+			Issuer:       api.Issuer{Name: "C=US, O=Let's Encrypt, CN=R3", FriendlyName: "Let's Encrypt", PubKeySHA256: "AA"},
+			PubKeySHA256: "bb",
+			NotBefore:    "2026-01-01T00:00:00Z",
+			NotAfter:     "2026-04-01T00:00:00Z",
+		},
+		{
+			ID:        3,
+			Domains:   []string{"*.example.com", "dev.example.com"},
+			Issuer:    api.Issuer{Name: "C=GB, O=Sectigo Limited, CN=Sectigo RSA Domain Validation Secure Server CA", FriendlyName: "Sectigo", PubKeySHA256: "cc"},
+			NotBefore: "2026-01-01T00:00:00Z",
+			NotAfter:  "2027-01-01T00:00:00Z",
+		},
+		{
+			ID:        4,
+			Domains:   []string{"dev-api.example.com"},
+			Issuer:    api.Issuer{Name: "CN=Internal CA"},
+			NotBefore: "invalid",
+		},
+	}
+	cases := []struct {
+		title    string
+		rules    []Rule
+		expected []uint64
+		isErr    bool
+	}{
+		{
+			title:    "NoRules",
+			expected: []uint64{1, 2, 3, 4},
+		},
+		{
+			title:    "ExcludeDNSNames",
+			rules:    []Rule{{DNSNames: []string{"DEV.example.com"}}},
+			expected: []uint64{1, 3, 4},
+		},
+		{
+			title:    "ExcludeDNSNameRegexps",
+			rules:    []Rule{{Action: ExcludeAction, DNSNameRegexps: []string{`^dev[.-]`}}},
+			expected: []uint64{1, 3},
+		},
+		{
+			title:    "MatchIssuerNames",
+			rules:    []Rule{{Action: MatchAction, IssuerNames: []string{"*let's encrypt*"}}},
+			expected: []uint64{1, 2},
+		},
+		{
+			title:    "MatchIssuerFriendlyName",
+			rules:    []Rule{{Action: MatchAction, IssuerNames: []string{"Sectigo"}}},
+			expected: []uint64{3},
+		},
+		{
+			title:    "ExcludeIssuerPubKey",
+			rules:    []Rule{{IssuerPubKeySHA256: []string{"aa"}}},
+			expected: []uint64{3, 4},
+		},
+		{
+			title:    "ExcludePubKey",
+			rules:    []Rule{{PubKeySHA256: []string{"BB"}}},
+			expected: []uint64{1, 3, 4},
+		},
+		{
+			title:    "MatchMaxValidity",
+			rules:    []Rule{{Action: MatchAction, MaxValidity: 100 * 24 * time.Hour}},
+			expected: []uint64{1, 2},
+		},
+		{
+			title:    "ExcludeMinValidity",
+			rules:    []Rule{{MinValidity: 100 * 24 * time.Hour}},
+			expected: []uint64{1, 2, 4},
+		},
+		{
+			title:    "ExcludeWildcard",
+			rules:    []Rule{{Wildcard: &yes}},
+			expected: []uint64{1, 2, 4},
+		},
+		{
+			title:    "MatchNoWildcard",
+			rules:    []Rule{{Action: MatchAction, Wildcard: &no}},
+			expected: []uint64{1, 2, 4},
+		},
+		{
+			title: "AllConditions",
+			rules: []Rule{{
+				DNSNames:    []string{"*.example.com"},
+				IssuerNames: []string{"sectigo"},
+			}},
+			expected: []uint64{1, 2, 4},
+		},
+		{
+			title: "MatchAndExclude",
+			rules: []Rule{
+				{Action: MatchAction, IssuerNames: []string{"*let's encrypt*"}},
+				{Action: MatchAction, Wildcard: &yes},
+				{Action: ExcludeAction, DNSNames: []string{"dev.example.com"}},
+			},
+			expected: []uint64{1, 3},
+		},
+		{
+			title: "UnknownAction",
+			rules: []Rule{{Action: "drop"}},
+			isErr: true,
+		},
+		{
+			title: "InvalidGlob",
+			rules: []Rule{{DNSNames: []string{"["}}},
+			isErr: true,
+		},
+		{
+			title: "InvalidRegexp",
+			rules: []Rule{{DNSNameRegexps: []string{"("}}},
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			f, err := NewRuleFilter(tc.rules)
+			if tc.isErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			res, err := f.Filter(issuances)
+			assert.NoError(t, err)
+			var actual []uint64
+			for _, issuance := range res {
+				actual = append(actual, issuance.ID)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestRuleFilterAnnotations(t *testing.T) {
+	t.Parallel()
+	issuances := []AnnotatedIssuance{
+		{Issuance: api.Issuance{ID: 1, Domains: []string{"www.example.com"}, Issuer: api.Issuer{FriendlyName: "Let's Encrypt"}}},
+		{Issuance: api.Issuance{ID: 2, Domains: []string{"pay.example.com"}, Issuer: api.Issuer{FriendlyName: "Sectigo"}}, Annotations: Annotations{"owner": "web"}},
+		{Issuance: api.Issuance{ID: 3, Domains: []string{"dev.example.com"}, Issuer: api.Issuer{FriendlyName: "Sectigo"}}},
+	}
+	cases := []struct {
+		title    string
+		rules    []Rule
+		expected map[uint64]Annotations
+		isErr    bool
+	}{
+		{
+			title: "Annotate",
+			rules: []Rule{
+				{Action: AnnotateAction, IssuerNames: []string{"sectigo"}, Annotations: map[string]string{"severity": "high", "reason": "unknown issuer"}},
+				{Action: AnnotateAction, DNSNames: []string{"pay.*"}, Annotations: map[string]string{"owner": "payments"}},
+				{DNSNames: []string{"dev.*"}},
+			},
+			expected: map[uint64]Annotations{
+				1: nil,
+				2: {"severity": "high", "reason": "unknown issuer", "owner": "payments"},
+			},
+		},
+		{
+			title: "Precedence",
+			rules: []Rule{
+				{Action: AnnotateAction, IssuerNames: []string{"sectigo"}, Annotations: map[string]string{"severity": "high"}},
+				{Action: AnnotateAction, DNSNames: []string{"dev.*"}, Annotations: map[string]string{"severity": "low"}},
+			},
+			expected: map[uint64]Annotations{
+				1: nil,
+				2: {"severity": "high", "owner": "web"},
+				3: {"severity": "low"},
+			},
+		},
+		{
+			title: "MissingAnnotations",
+			rules: []Rule{{Action: AnnotateAction, DNSNames: []string{"*"}}},
+			isErr: true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			f, err := NewRuleFilter(tc.rules)
+			if tc.isErr {
+				assert.ErrorIs(t, err, ErrMissingAnnotations)
+				return
+			}
+			assert.NoError(t, err)
+			res, err := f.FilterAnnotated(Metadata{}, issuances)
+			assert.NoError(t, err)
+			actual := make(map[uint64]Annotations)
+			for _, issuance := range res {
+				actual[issuance.ID] = issuance.Annotations
+			}
+			assert.Equal(t, tc.expected, actual)
+			// Annotations of the input are left untouched.
+			assert.Equal(t, Annotations{"owner": "web"}, issuances[1].Annotations)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+//go:build testfilter
+// +build testfilter
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/cybozu-go/log"
+	"github.com/hashicorp/go-plugin"
+)
+
+type sampleFilter struct{}
+
+// Filter keeps issuances for the domain, up to the configured limit, and
+// annotates them with the configured severity. It answers after the configured
+// delay, or fails with the configured error.
+func (sampleFilter) Filter(req filter.FilterRequest) ([]filter.AnnotatedIssuance, error) {
+	_ = log.Info("running sample v2 filter", map[string]interface{}{
+		"domain":    req.Domain.Name,
+		"issuances": len(req.Issuances),
+	})
+	if delay, ok := req.Config["delay"].(string); ok {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return nil, err
+		}
+		time.Sleep(d)
+	}
+	if msg, ok := req.Config["error"].(string); ok {
+		return nil, errors.New(msg)
+	}
+	res := []filter.AnnotatedIssuance{}
+	for _, is := range req.Issuances {
+		if req.Domain.Name != "" && !slices.Contains(is.Domains, req.Domain.Name) {
+			continue
+		}
+		if severity, ok := req.Config["severity"].(string); ok {
+			annotations := filter.Annotations{"severity": severity}
+			for k, v := range is.Annotations {
+				annotations[k] = v
+			}
+			is.Annotations = annotations
+		}
+		res = append(res, is)
+	}
+	limit := len(res)
+	switch l := req.Config["limit"].(type) {
+	case int64:
+		limit = int(l)
+	case float64:
+		limit = int(l)
+	}
+	return res[:min(limit, len(res))], nil
+}
+
+func main() {
+	// Logs are forwarded to ct-monitor, which recognizes JSON entries.
+	log.DefaultLogger().SetFormatter(log.JSONFormat{})
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: filter.HandshakeConfigV2,
+		Plugins: map[string]plugin.Plugin{
+			filter.PluginKey: &filter.IssuanceFilterV2Plugin{Impl: &sampleFilter{}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"encoding/gob"
+	"net/rpc"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/hashicorp/go-plugin"
+)
+
+var (
+	// HandshakeConfigV2 is the handshake configuration of v2 plugins.
+	HandshakeConfigV2 = plugin.HandshakeConfig{
+		ProtocolVersion:  2,
+		MagicCookieKey:   HandshakeConfig.MagicCookieKey,
+		MagicCookieValue: HandshakeConfig.MagicCookieValue,
+	}
+	PluginMapV2 = map[string]plugin.Plugin{
+		PluginKey: &IssuanceFilterV2Plugin{},
+	}
+	// VersionedPluginMap lists the plugins of each supported protocol version.
+	VersionedPluginMap = map[int]plugin.PluginSet{
+		int(HandshakeConfig.ProtocolVersion):   PluginMap,
+		int(HandshakeConfigV2.ProtocolVersion): PluginMapV2,
+	}
+)
+
+func init() {
+	// Plugin configurations are sent as is over net/rpc.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// Domain describes the monitored domain issuances are filtered for.
+type Domain struct {
+	Name              string
+	MatchWildcards    bool
+	IncludeSubdomains bool
+	// Source is the name of the issuance source the domain is queried from.
+	Source string
+}
+
+// Run describes the ct-monitor run issuances are filtered in.
+type Run struct {
+	StartedAt time.Time
+	Version   string
+}
+
+// Metadata describes what issuances are filtered for.
+type Metadata struct {
+	Domain Domain
+	Run    Run
+}
+
+// FilterRequest is the request received by v2 plugins.
+type FilterRequest struct {
+	Metadata
+	// Config is the configuration of the plugin, as set in filter_config.
+	Config    map[string]interface{}
+	Issuances []AnnotatedIssuance
+}
+
+// IssuanceFilterV2 is the interface exposed as a v2 plugin. Plugins return the
+// issuances to keep, and may add, change or remove their annotations.
+type IssuanceFilterV2 interface {
+	Filter(req FilterRequest) ([]AnnotatedIssuance, error)
+}
+
+// MetadataFilter is implemented by filters making use of metadata.
+type MetadataFilter interface {
+	FilterWithMetadata(md Metadata, is []api.Issuance) ([]api.Issuance, error)
+}
+
+// FilterWithMetadata filters the issuances, passing the metadata along if the filter supports it.
+func FilterWithMetadata(f IssuanceFilter, md Metadata, is []api.Issuance) ([]api.Issuance, error) {
+	if mf, ok := f.(MetadataFilter); ok {
+		return mf.FilterWithMetadata(md, is)
+	}
+	return f.Filter(is)
+}
+
+// issuanceFilterV1 adapts v1 plugins to IssuanceFilterV2.
+type issuanceFilterV1 struct {
+	impl IssuanceFilter
+}
+
+func (f issuanceFilterV1) Filter(req FilterRequest) ([]AnnotatedIssuance, error) {
+	res, err := f.impl.Filter(Issuances(req.Issuances))
+	return keepAnnotations(req.Issuances, res), err
+}
+
+// IssuanceFilterV2RPCClient is a v2 plugin implementation over RPC.
+type IssuanceFilterV2RPCClient struct {
+	client *rpc.Client
+}
+
+func (f *IssuanceFilterV2RPCClient) Filter(req FilterRequest) ([]AnnotatedIssuance, error) {
+	var resp []AnnotatedIssuance
+	err := f.client.Call("Plugin.Filter", req, &resp)
+	return resp, err
+}
+
+// IssuanceFilterV2RPCServer is the RPC server that IssuanceFilterV2RPCClient talks to.
+type IssuanceFilterV2RPCServer struct {
+	Impl IssuanceFilterV2
+}
+
+func (s *IssuanceFilterV2RPCServer) Filter(req FilterRequest, resp *[]AnnotatedIssuance) error {
+	r, err := s.Impl.Filter(req)
+	*resp = r
+	return err
+}
+
+// IssuanceFilterV2Plugin is an implementation of plugin.Plugin and plugin.GRPCPlugin for v2 plugins.
+type IssuanceFilterV2Plugin struct {
+	Impl IssuanceFilterV2
+}
+
+func (p *IssuanceFilterV2Plugin) Server(*plugin.MuxBroker) (interface{}, error) {
+	return &IssuanceFilterV2RPCServer{Impl: p.Impl}, nil
+}
+
+func (*IssuanceFilterV2Plugin) Client(_ *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	return &IssuanceFilterV2RPCClient{client: c}, nil
+}
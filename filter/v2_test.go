@@ -0,0 +1,206 @@
+//go:build test
+// +build test
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFilterV2Bin = "/tmp/ct-monitor/work/testfilterv2"
+)
+
+type recordingFilterV2 struct {
+	req *FilterRequest
+}
+
+func (f recordingFilterV2) Filter(req FilterRequest) ([]AnnotatedIssuance, error) {
+	*f.req = req
+	res := []AnnotatedIssuance{req.Issuances[0]}
+	res[0].Annotations = res[0].Annotations.merge(map[string]string{"owner": "payments"})
+	return res, nil
+}
+
+type metadataFilter struct {
+	md *Metadata
+}
+
+func (metadataFilter) Filter(is []api.Issuance) ([]api.Issuance, error) {
+	return is, nil
+}
+
+func (f metadataFilter) FilterWithMetadata(md Metadata, is []api.Issuance) ([]api.Issuance, error) {
+	*f.md = md
+	return is, nil
+}
+
+func testFilterRequest() FilterRequest {
+	return FilterRequest{
+		Metadata: Metadata{
+			Domain: Domain{
+				Name:              "example.com",
+				MatchWildcards:    true,
+				IncludeSubdomains: true,
+				Source:            "certspotter",
+			},
+			Run: Run{
+				StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				Version:   "1.2.3",
+			},
+		},
+		Config: map[string]interface{}{
+			"team":   "security",
+			"owners": []interface{}{"ops", "dev"},
+			"limits": map[string]interface{}{"names": 2.0},
+		},
+		Issuances: []AnnotatedIssuance{
+			{Issuance: fullIssuance(), Annotations: Annotations{"severity": "high"}},
+			{Issuance: api.Issuance{ID: 2, Domains: []string{"example.com"}}},
+		},
+	}
+}
+
+func TestIssuanceFilterV2(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title string
+		conn  func(t *testing.T, impl IssuanceFilterV2) (interface{}, func())
+	}{
+		{
+			title: "RPC",
+			conn: func(t *testing.T, impl IssuanceFilterV2) (interface{}, func()) {
+				client, _ := plugin.TestPluginRPCConn(t, map[string]plugin.Plugin{
+					PluginKey: &IssuanceFilterV2Plugin{Impl: impl},
+				}, nil)
+				raw, err := client.Dispense(PluginKey)
+				assert.NoError(t, err)
+				return raw, func() {
+					client.Close()
+				}
+			},
+		},
+		{
+			title: "GRPC",
+			conn: func(t *testing.T, impl IssuanceFilterV2) (interface{}, func()) {
+				client, server := plugin.TestPluginGRPCConn(t, false, map[string]plugin.Plugin{
+					PluginKey: &IssuanceFilterV2Plugin{Impl: impl},
+				})
+				raw, err := client.Dispense(PluginKey)
+				assert.NoError(t, err)
+				return raw, func() {
+					client.Close()
+					server.Stop()
+				}
+			},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			var received FilterRequest
+			raw, closeConn := tc.conn(t, recordingFilterV2{req: &received})
+			defer closeConn()
+			req := testFilterRequest()
+			actual, err := raw.(IssuanceFilterV2).Filter(req)
+			assert.NoError(t, err)
+			expected := []AnnotatedIssuance{
+				{Issuance: fullIssuance(), Annotations: Annotations{"severity": "high", "owner": "payments"}},
+			}
+			assert.Equal(t, expected, actual)
+			assert.Equal(t, testFilterRequest(), received)
+		})
+	}
+}
+
+func TestPluginFilter(t *testing.T) {
+	t.Parallel()
+	md := Metadata{Domain: Domain{Name: "example.com"}}
+	issuances := []api.Issuance{
+		{ID: 1, Domains: []string{"www.example.com"}},
+		{ID: 2, Domains: []string{"example.com"}},
+		{ID: 3, Domains: []string{"example.com", "www.example.com"}},
+		{ID: 4, Domains: []string{"example.com"}},
+	}
+	cases := []struct {
+		title    string
+		plugins  []Plugin
+		expected []api.Issuance
+		isErr    bool
+	}{
+		{
+			title:    "V1",
+			plugins:  []Plugin{{Path: testFilterBin, Config: map[string]interface{}{"limit": 2}}},
+			expected: issuances[:1],
+		},
+		{
+			title:    "V2",
+			plugins:  []Plugin{{Path: testFilterV2Bin}},
+			expected: issuances[1:],
+		},
+		{
+			title:    "V2Config",
+			plugins:  []Plugin{{Path: testFilterV2Bin, Config: map[string]interface{}{"limit": int64(2)}}},
+			expected: issuances[1:3],
+		},
+		{
+			title:    "Mixed",
+			plugins:  []Plugin{{Path: testFilterV2Bin}, {Path: testFilterBin}},
+			expected: issuances[1:2],
+		},
+		{
+			title:    "Error",
+			plugins:  []Plugin{{Path: testFilterV2Bin}, {Path: "/nonexistent"}},
+			expected: issuances[1:],
+			isErr:    true,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			for _, pool := range []*Pool{nil, NewPool()} {
+				f, err := NewPluginFilter(tc.plugins, pool)
+				assert.NoError(t, err)
+				actual, err := f.FilterWithMetadata(md, issuances)
+				if tc.isErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+				assert.Equal(t, tc.expected, actual)
+				if pool != nil {
+					pool.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestNewPluginFilter(t *testing.T) {
+	t.Parallel()
+	_, err := NewPluginFilter([]Plugin{{Path: testFilterV2Bin, Config: map[string]interface{}{"limit": 1}}}, nil)
+	assert.NoError(t, err)
+	_, err = NewPluginFilter([]Plugin{{Path: testFilterV2Bin, Config: map[string]interface{}{"since": time.Now()}}}, nil)
+	assert.Error(t, err)
+	_, err = NewPluginFilter([]Plugin{{Path: testFilterV2Bin, SHA256: "abcd"}}, nil)
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+}
+
+func TestFilterWithMetadata(t *testing.T) {
+	t.Parallel()
+	md := testFilterRequest().Metadata
+	issuances := Issuances(testFilterRequest().Issuances)
+	var received Metadata
+	chain := Chain{truncateFilter{}, metadataFilter{md: &received}}
+	actual, err := chain.FilterWithMetadata(md, issuances)
+	assert.NoError(t, err)
+	assert.Equal(t, issuances[:1], actual)
+	assert.Equal(t, md, received)
+}
@@ -0,0 +1,223 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltOpenTimeout = 30 * time.Second
+)
+
+var (
+	issuancesBucket     = []byte("issuances")
+	notificationsBucket = []byte("notifications")
+)
+
+// BoltDB is a DB backed by a BoltDB database. The database is opened on the
+// first write and kept open, and locked, until Close is called at the end of
+// each run. Readers such as the history command wait up to 30 seconds for it
+// to be closed. It is safe for concurrent use.
+type BoltDB struct {
+	filename string
+
+	mu sync.Mutex
+	db *bolt.DB
+}
+
+// NewBoltDB returns a BoltDB for the database at filename, which is created on first write.
+func NewBoltDB(filename string) *BoltDB {
+	return &BoltDB{filename: filename}
+}
+
+// open returns the database opened for writing, opening it if needed.
+func (d *BoltDB) open() (*bolt.DB, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.db != nil {
+		return d.db, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(d.filename), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(d.filename, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	d.db = db
+	return db, nil
+}
+
+// opened returns the database if it is opened for writing.
+func (d *BoltDB) opened() *bolt.DB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.db
+}
+
+func (d *BoltDB) update(fn func(tx *bolt.Tx) error) error {
+	db, err := d.open()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{issuancesBucket, notificationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func (d *BoltDB) view(fn func(tx *bolt.Tx) error) error {
+	if db := d.opened(); db != nil {
+		return db.View(fn)
+	}
+	if _, err := os.Stat(d.filename); os.IsNotExist(err) {
+		return nil
+	}
+	db, err := bolt.Open(d.filename, 0600, &bolt.Options{Timeout: boltOpenTimeout, ReadOnly: true})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return fmt.Errorf("history database %s is in use by a running check: %w", d.filename, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// Close implements DB.
+func (d *BoltDB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.db == nil {
+		return nil
+	}
+	err := d.db.Close()
+	d.db = nil
+	return err
+}
+
+func getBoltRecord(b *bolt.Bucket, key []byte) (*Record, error) {
+	data := b.Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func putBoltJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// Record implements DB.
+func (d *BoltDB) Record(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(issuancesBucket)
+		nb := tx.Bucket(notificationsBucket)
+		for _, r := range records {
+			key := []byte(r.key())
+			current, err := getBoltRecord(b, key)
+			if err != nil {
+				return err
+			}
+			if current != nil {
+				r = current.merge(r)
+			}
+			if err := putBoltJSON(b, key, r); err != nil {
+				return err
+			}
+			if r.NotificationID == "" {
+				continue
+			}
+			var keys []string
+			if data := nb.Get([]byte(r.NotificationID)); data != nil {
+				if err := json.Unmarshal(data, &keys); err != nil {
+					return err
+				}
+			}
+			if slices.Contains(keys, string(key)) {
+				continue
+			}
+			if err := putBoltJSON(nb, []byte(r.NotificationID), append(keys, string(key))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetStatus implements DB.
+func (d *BoltDB) SetStatus(notificationID string, status Status) error {
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(issuancesBucket)
+		data := tx.Bucket(notificationsBucket).Get([]byte(notificationID))
+		if data == nil {
+			return nil
+		}
+		var keys []string
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			r, err := getBoltRecord(b, []byte(key))
+			if err != nil {
+				return err
+			}
+			// The issuance may have been reported again in a later notification.
+			if r == nil || r.NotificationID != notificationID {
+				continue
+			}
+			r.Status = status
+			if err := putBoltJSON(b, []byte(key), r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query implements DB.
+func (d *BoltDB) Query(q Query) (records []Record, err error) {
+	err = d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(issuancesBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if q.Match(r) {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	slices.SortStableFunc(records, func(a, b Record) int {
+		return a.NotBefore.Compare(b.NotBefore)
+	})
+	return records, err
+}
@@ -0,0 +1,214 @@
+// Package history keeps a record of observed issuances, along with the verdict
+// of filters and the status of the notifications they were reported in.
+package history
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// Verdict represents the outcome of filters for an issuance.
+type Verdict string
+
+const (
+	// VerdictReported is set for issuances remaining after filters.
+	VerdictReported Verdict = "reported"
+	// VerdictFiltered is set for issuances discarded by filters.
+	VerdictFiltered Verdict = "filtered"
+	// VerdictExpected is set for issuances matching the baseline of expected certificates.
+	VerdictExpected Verdict = "expected"
+)
+
+// Status represents the status of the notification an issuance was reported in.
+type Status string
+
+const (
+	// StatusNone is set for issuances which are not reported.
+	StatusNone Status = "none"
+	// StatusPending is set for issuances waiting in the outbox.
+	StatusPending Status = "pending"
+	// StatusRetrying is set for issuances whose notification failed to be delivered.
+	StatusRetrying Status = "retrying"
+	// StatusSent is set for issuances whose notification was delivered.
+	StatusSent Status = "sent"
+)
+
+// rank orders statuses by progress of delivery.
+func (s Status) rank() int {
+	switch s {
+	case StatusPending:
+		return 1
+	case StatusRetrying:
+		return 2
+	case StatusSent:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Record represents an observed issuance.
+type Record struct {
+	// Domain is the configured domain the issuance was observed for.
+	Domain             string    `json:"domain"`
+	ID                 uint64    `json:"id"`
+	Names              []string  `json:"names"`
+	Issuer             string    `json:"issuer"`
+	IssuerFriendlyName string    `json:"issuer_friendly_name,omitempty"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	CertSHA256         string    `json:"cert_sha256,omitempty"`
+	TBSSHA256          string    `json:"tbs_sha256,omitempty"`
+	PubKeySHA256       string    `json:"pubkey_sha256,omitempty"`
+	// ObservedAt is the time the issuance was first observed.
+	ObservedAt     time.Time `json:"observed_at"`
+	Verdict        Verdict   `json:"verdict"`
+	Status         Status    `json:"status"`
+	NotificationID string    `json:"notification_id,omitempty"`
+	// Annotations are the labels attached by filters to reported issuances.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewRecord returns a record for an issuance observed for the domain.
+// Records are created with the filtered verdict, and updated by the caller
+// for issuances which are reported.
+func NewRecord(domain string, issuance api.Issuance, observedAt time.Time) Record {
+	// Validity timestamps which fail to parse are left unset.
+	notBefore, _ := time.Parse(time.RFC3339, issuance.NotBefore)
+	notAfter, _ := time.Parse(time.RFC3339, issuance.NotAfter)
+	return Record{
+		Domain:             domain,
+		ID:                 issuance.ID,
+		Names:              issuance.Domains,
+		Issuer:             issuance.Issuer.Name,
+		IssuerFriendlyName: issuance.Issuer.FriendlyName,
+		NotBefore:          notBefore,
+		NotAfter:           notAfter,
+		CertSHA256:         issuance.CertSHA256,
+		TBSSHA256:          issuance.TBSSHA256,
+		PubKeySHA256:       issuance.PubKeySHA256,
+		ObservedAt:         observedAt,
+		Verdict:            VerdictFiltered,
+		Status:             StatusNone,
+	}
+}
+
+// merge returns the record updated with a later observation of the same issuance.
+// The time the issuance was first observed is kept, and so is the notification
+// it was reported in if its delivery is more advanced, so that observing an
+// issuance again, for instance when a page is fetched again after a crash,
+// does not reset its status.
+func (r Record) merge(next Record) Record {
+	if r.ObservedAt.Before(next.ObservedAt) {
+		next.ObservedAt = r.ObservedAt
+	}
+	if r.Status.rank() > next.Status.rank() {
+		next.Verdict = r.Verdict
+		next.Status = r.Status
+		next.NotificationID = r.NotificationID
+		next.Annotations = r.Annotations
+	}
+	return next
+}
+
+// key returns the key identifying the record. Issuances are identified by their
+// certificate hash, or by their ID for sources which do not provide it.
+func (r Record) key() string {
+	id := r.CertSHA256
+	if id == "" {
+		id = strconv.FormatUint(r.ID, 10)
+	}
+	return r.Domain + "\x00" + id
+}
+
+// Query represents criteria for looking up records. Unset criteria match all records.
+type Query struct {
+	// Domain is the configured domain the issuances were observed for.
+	Domain string
+	// NamePattern is a glob pattern, as understood by path.Match, matched against DNS names.
+	NamePattern string
+	// Issuer is matched against the issuer's name or friendly name, ignoring case.
+	Issuer string
+	// Since and Until bound the start of the validity period of the certificates.
+	Since time.Time
+	Until time.Time
+	// Annotations must all be set to the given values.
+	Annotations map[string]string
+}
+
+// Match returns whether the record matches the query.
+func (q Query) Match(r Record) bool {
+	if q.Domain != "" && !strings.EqualFold(q.Domain, r.Domain) {
+		return false
+	}
+	if q.NamePattern != "" && !matchNames(strings.ToLower(q.NamePattern), r.Names) {
+		return false
+	}
+	if q.Issuer != "" {
+		issuer := strings.ToLower(q.Issuer)
+		if !strings.Contains(strings.ToLower(r.Issuer), issuer) && !strings.Contains(strings.ToLower(r.IssuerFriendlyName), issuer) {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && r.NotBefore.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.NotBefore.After(q.Until) {
+		return false
+	}
+	for k, v := range q.Annotations {
+		if value, ok := r.Annotations[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchNames(pattern string, names []string) bool {
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DB is a database of observed issuances.
+type DB interface {
+	// Record adds records to the database. Records already present are updated,
+	// keeping the time they were first observed and the most advanced delivery status.
+	Record(records ...Record) error
+	// SetStatus updates the status of the records reported in the notification.
+	SetStatus(notificationID string, status Status) error
+	// Query returns the records matching the query, ordered by start of validity.
+	Query(q Query) ([]Record, error)
+	// Close releases the database until the next write.
+	Close() error
+}
+
+// NoOpDB is a DB which does not keep any records, used when history is disabled.
+type NoOpDB struct{}
+
+// Record implements DB.
+func (NoOpDB) Record(...Record) error {
+	return nil
+}
+
+// SetStatus implements DB.
+func (NoOpDB) SetStatus(string, Status) error {
+	return nil
+}
+
+// Query implements DB.
+func (NoOpDB) Query(Query) ([]Record, error) {
+	return nil, nil
+}
+
+// Close implements DB.
+func (NoOpDB) Close() error {
+	return nil
+}
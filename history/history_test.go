@@ -0,0 +1,152 @@
+//go:build test
+// +build test
+
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRecord(domain string, id uint64, sha256, notBefore string, names ...string) Record {
+	return NewRecord(domain, api.Issuance{
+		ID:         id,
+		Domains:    names,
+		CertSHA256: sha256,
+		NotBefore:  notBefore,
+		NotAfter:   "2027-01-01T00:00:00Z",
+		Issuer: api.Issuer{
+			Name:         "C=US, O=Let's Encrypt, CN=R3",
+			FriendlyName: "Let's Encrypt",
+		},
+	}, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func TestQueryMatch(t *testing.T) {
+	t.Parallel()
+	r := testRecord("example.com", 1, "aa", "2026-03-01T00:00:00Z", "www.example.com", "example.com")
+	r.Annotations = map[string]string{"severity": "high", "owner": "payments"}
+	cases := []struct {
+		title  string
+		q      Query
+		expect bool
+	}{
+		{title: "Empty", q: Query{}, expect: true},
+		{title: "Domain", q: Query{Domain: "Example.com"}, expect: true},
+		{title: "OtherDomain", q: Query{Domain: "example.net"}, expect: false},
+		{title: "NamePattern", q: Query{NamePattern: "*.example.com"}, expect: true},
+		{title: "NamePatternNoMatch", q: Query{NamePattern: "*.dev.example.com"}, expect: false},
+		{title: "Issuer", q: Query{Issuer: "R3"}, expect: true},
+		{title: "IssuerFriendlyName", q: Query{Issuer: "let's encrypt"}, expect: true},
+		{title: "OtherIssuer", q: Query{Issuer: "Sectigo"}, expect: false},
+		{title: "Since", q: Query{Since: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}, expect: true},
+		{title: "SinceAfter", q: Query{Since: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)}, expect: false},
+		{title: "Until", q: Query{Until: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}, expect: true},
+		{title: "UntilBefore", q: Query{Until: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}, expect: false},
+		{title: "Annotations", q: Query{Annotations: map[string]string{"severity": "high"}}, expect: true},
+		{title: "OtherAnnotations", q: Query{Annotations: map[string]string{"severity": "low"}}, expect: false},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expect, tc.q.Match(r))
+		})
+	}
+}
+
+func TestBoltDB(t *testing.T) {
+	t.Parallel()
+	db := NewBoltDB(filepath.Join(t.TempDir(), "sub", "history.db"))
+
+	// Querying a database which does not exist yet returns nothing.
+	records, err := db.Query(Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	reported := testRecord("example.com", 2, "bb", "2026-03-01T00:00:00Z", "www.example.com")
+	reported.Verdict = VerdictReported
+	reported.Status = StatusPending
+	reported.NotificationID = "n1"
+	filtered := testRecord("example.com", 1, "aa", "2026-02-01T00:00:00Z", "dev.example.com")
+	// crt.sh does not provide hashes, so the issuance is identified by its ID.
+	other := testRecord("example.net", 1, "", "2026-01-01T00:00:00Z", "example.net")
+	assert.NoError(t, db.Record(reported, filtered, other))
+
+	records, err = db.Query(Query{Domain: "example.com"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		// Records are ordered by start of validity.
+		assert.Equal(t, filtered, records[0])
+		assert.Equal(t, reported, records[1])
+	}
+
+	assert.NoError(t, db.SetStatus("n1", StatusSent))
+	assert.NoError(t, db.SetStatus("unknown", StatusSent))
+	records, err = db.Query(Query{NamePattern: "www.example.com"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, StatusSent, records[0].Status)
+	}
+
+	// Observing an issuance again keeps the time it was first observed.
+	again := other
+	again.ObservedAt = other.ObservedAt.Add(time.Hour)
+	assert.NoError(t, db.Record(again))
+	records, err = db.Query(Query{Domain: "example.net"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, other.ObservedAt, records[0].ObservedAt)
+	}
+
+	// Observing a reported issuance again keeps the most advanced delivery status.
+	reportedAgain := reported
+	reportedAgain.ObservedAt = reported.ObservedAt.Add(time.Hour)
+	reportedAgain.Status = StatusPending
+	reportedAgain.NotificationID = "n2"
+	filteredAgain := reported
+	filteredAgain.Verdict = VerdictFiltered
+	filteredAgain.Status = StatusNone
+	filteredAgain.NotificationID = ""
+	assert.NoError(t, db.Record(reportedAgain))
+	assert.NoError(t, db.Record(filteredAgain))
+	records, err = db.Query(Query{NamePattern: "www.example.com"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, VerdictReported, records[0].Verdict)
+		assert.Equal(t, StatusSent, records[0].Status)
+		assert.Equal(t, "n1", records[0].NotificationID)
+		assert.Equal(t, reported.ObservedAt, records[0].ObservedAt)
+	}
+
+	// An issuance filtered earlier and reported later takes the status of the new report.
+	retried := filtered
+	retried.Verdict = VerdictReported
+	retried.Status = StatusPending
+	retried.NotificationID = "n3"
+	assert.NoError(t, db.Record(retried))
+	assert.NoError(t, db.SetStatus("n3", StatusRetrying))
+	records, err = db.Query(Query{NamePattern: "dev.example.com"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, StatusRetrying, records[0].Status)
+	}
+
+	records, err = db.Query(Query{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	// The database is kept open, and locked, until closed.
+	reader := NewBoltDB(db.filename)
+	assert.NoError(t, db.Close())
+	assert.NoError(t, db.Close())
+	records, err = reader.Query(Query{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.NoError(t, db.Record(other))
+	assert.NoError(t, db.Close())
+}
@@ -47,6 +47,18 @@ func (s AmazonSESMailer) Init() error {
 
 // Send implements the Mailer's Send interface.
 func (s AmazonSESMailer) Send(subject, body string) error {
+	return s.send(s.newEmail("", subject, body))
+}
+
+// SendWithKey implements the IdempotentMailer interface.
+// Since SES assigns its own Message-ID, the idempotency key is set in the
+// X-CT-Monitor-Report-ID header, which mail filters can use to discard
+// duplicate messages.
+func (s AmazonSESMailer) SendWithKey(key, subject, body string) error {
+	return s.send(s.newEmail(key, subject, body))
+}
+
+func (s AmazonSESMailer) newEmail(key, subject, body string) *sesv2.SendEmailInput {
 	charset := "UTF-8"
 	email := &sesv2.SendEmailInput{
 		Destination: &sesv2.Destination{
@@ -70,9 +82,21 @@ func (s AmazonSESMailer) Send(subject, body string) error {
 		},
 		FromEmailAddress: aws.String(s.From),
 	}
+	if key != "" {
+		email.Content.Simple.Headers = []*sesv2.MessageHeader{
+			{Name: aws.String(idempotencyHeader), Value: aws.String(key)},
+		}
+	}
+	return email
+}
+
+func (s AmazonSESMailer) send(email *sesv2.SendEmailInput) error {
 	res, err := s.Session.SendEmail(email)
+	if err != nil {
+		return err
+	}
 	_ = log.Info("SES email sent", map[string]interface{}{
-		"message_id": *res.MessageId,
+		"message_id": aws.StringValue(res.MessageId),
 	})
-	return err
+	return nil
 }
@@ -0,0 +1,25 @@
+//go:build test
+// +build test
+
+package mailer
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAmazonSESNewEmail(t *testing.T) {
+	t.Parallel()
+	s := AmazonSESMailer{From: "from@localhost", To: "to@localhost"}
+	email := s.newEmail("", "hello", "world")
+	assert.Equal(t, "hello", aws.StringValue(email.Content.Simple.Subject.Data))
+	assert.Empty(t, email.Content.Simple.Headers)
+
+	email = s.newEmail("abc", "hello", "world")
+	if assert.Len(t, email.Content.Simple.Headers, 1) {
+		assert.Equal(t, idempotencyHeader, aws.StringValue(email.Content.Simple.Headers[0].Name))
+		assert.Equal(t, "abc", aws.StringValue(email.Content.Simple.Headers[0].Value))
+	}
+}
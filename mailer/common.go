@@ -12,6 +12,29 @@ type Mailer interface {
 	Send(subject, body string) error
 }
 
+// IdempotentMailer is implemented by mailers able to tag messages with an
+// idempotency key, so that retried deliveries of the same report can be recognized.
+type IdempotentMailer interface {
+	SendWithKey(key, subject, body string) error
+}
+
+// idempotencyHeader carries the idempotency key of messages, for providers
+// which assign their own Message-ID.
+const idempotencyHeader = "X-CT-Monitor-Report-ID"
+
+// messageID returns the Message-ID of messages tagged with the idempotency key.
+func messageID(key string) string {
+	return fmt.Sprintf("<%s@ct-monitor>", key)
+}
+
+// SendWithKey sends a message tagged with the idempotency key if the mailer supports it.
+func SendWithKey(m Mailer, key, subject, body string) error {
+	if im, ok := m.(IdempotentMailer); ok {
+		return im.SendWithKey(key, subject, body)
+	}
+	return m.Send(subject, body)
+}
+
 var (
 	ErrMissingSender    = fmt.Errorf("sender address missing")
 	ErrMissingRecipient = fmt.Errorf("recipient address missing")
@@ -47,14 +47,36 @@ func (s *SendgridMailer) Init(from, to string) error {
 
 // Send implements the Mailer's Send interface.
 func (s SendgridMailer) Send(subject, body string) error {
+	return s.send(s.newMessage("", subject, body))
+}
+
+// SendWithKey implements the IdempotentMailer interface.
+// The idempotency key is used as Message-ID, which mail clients use to
+// discard duplicate messages, and is also set in the X-CT-Monitor-Report-ID header.
+func (s SendgridMailer) SendWithKey(key, subject, body string) error {
+	return s.send(s.newMessage(key, subject, body))
+}
+
+func (s SendgridMailer) newMessage(key, subject, body string) *mail.SGMailV3 {
 	fromEmail := mail.NewEmail(s.From, s.From)
 	toEmail := mail.NewEmail(s.To, s.To)
 	message := mail.NewSingleEmail(fromEmail, subject, toEmail, body, "")
+	if key != "" {
+		message.SetHeader("Message-ID", messageID(key))
+		message.SetHeader(idempotencyHeader, key)
+	}
+	return message
+}
+
+func (s SendgridMailer) send(message *mail.SGMailV3) error {
 	res, err := s.Client.Send(message)
+	if err != nil {
+		return err
+	}
 	_ = log.Info("sendgrid response", map[string]interface{}{
 		"status_code": res.StatusCode,
 		"body":        res.Body,
 		"headers":     res.Headers,
 	})
-	return err
+	return nil
 }
@@ -0,0 +1,24 @@
+//go:build test
+// +build test
+
+package mailer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendgridNewMessage(t *testing.T) {
+	t.Parallel()
+	s := SendgridMailer{From: "from@localhost", To: "to@localhost"}
+	message := s.newMessage("", "hello", "world")
+	assert.Equal(t, "hello", message.Subject)
+	assert.Empty(t, message.Headers)
+
+	message = s.newMessage("abc", "hello", "world")
+	assert.Equal(t, map[string]string{
+		"Message-ID":      "<abc@ct-monitor>",
+		idempotencyHeader: "abc",
+	}, message.Headers)
+}
@@ -36,8 +36,28 @@ func (s SMTPMailer) Init() error {
 
 // Send implements the Mailer's Send interface.
 func (s SMTPMailer) Send(subject, body string) error {
+	return s.send(s.formatMessage("", subject, body))
+}
+
+// SendWithKey implements the IdempotentMailer interface.
+// The idempotency key is used as Message-ID, which mail clients use to
+// discard duplicate messages.
+func (s SMTPMailer) SendWithKey(key, subject, body string) error {
+	return s.send(s.formatMessage(key, subject, body))
+}
+
+func (s SMTPMailer) formatMessage(key, subject, body string) string {
+	var headers strings.Builder
+	fmt.Fprintf(&headers, "To: %s\r\nSubject: %s\r\n", s.To, subject)
+	if key != "" {
+		fmt.Fprintf(&headers, "Message-ID: %s\r\n", messageID(key))
+	}
+	return fmt.Sprintf("%s\r\n%s\r\n", headers.String(), body)
+}
+
+func (s SMTPMailer) send(message string) error {
 	addr := net.JoinHostPort(s.Server, strconv.Itoa(s.Port))
-	msg := strings.NewReader(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.To, subject, body))
+	msg := strings.NewReader(message)
 	tos := []string{s.To}
 
 	rootCAs, _ := LoadCACert(s.CaCert)
@@ -257,3 +257,10 @@ func TestSMTPSend(t *testing.T) {
 		})
 	}
 }
+
+func TestSMTPFormatMessage(t *testing.T) {
+	t.Parallel()
+	mailer := SMTPMailer{To: "to@localhost"}
+	assert.Equal(t, "To: to@localhost\r\nSubject: hello\r\n\r\nworld\r\n", mailer.formatMessage("", "hello", "world"))
+	assert.Equal(t, "To: to@localhost\r\nSubject: hello\r\nMessage-ID: <abc@ct-monitor>\r\n\r\nworld\r\n", mailer.formatMessage("abc", "hello", "world"))
+}
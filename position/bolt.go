@@ -0,0 +1,177 @@
+package position
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/source"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltOpenTimeout = 30 * time.Second
+)
+
+var (
+	positionsBucket = []byte("positions")
+	outboxBucket    = []byte("outbox")
+)
+
+// BoltStore is a Store backed by a BoltDB database.
+// Each Set is committed in its own transaction, and the database file is
+// locked while open, so that concurrent jobs cannot corrupt it.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens the BoltDB database at filename, creating it if it does not exist.
+// It waits for other processes holding the database to release it, up to a timeout.
+func NewBoltStore(filename string) (*BoltStore, error) {
+	if err := createDir(filename); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{positionsBucket, outboxBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func getBoltCursor(b *bolt.Bucket, key string) (source.Cursor, error) {
+	cursor := source.Cursor{}
+	data := b.Get([]byte(key))
+	if data == nil {
+		return cursor, nil
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// Get implements Store.
+func (s *BoltStore) Get(key string) (cursor source.Cursor, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		cursor, err = getBoltCursor(tx.Bucket(positionsBucket), key)
+		return err
+	})
+	return cursor, err
+}
+
+// Set implements Store.
+func (s *BoltStore) Set(key string, cursor source.Cursor) error {
+	return s.Commit(key, cursor)
+}
+
+// Commit implements Store.
+func (s *BoltStore) Commit(key string, cursor source.Cursor, notifications ...Notification) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(positionsBucket)
+		current, err := getBoltCursor(b, key)
+		if err != nil {
+			return err
+		}
+		for k, v := range cursor {
+			current[k] = v
+		}
+		data, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return err
+		}
+		outbox := tx.Bucket(outboxBucket)
+		for _, n := range notifications {
+			if outbox.Get([]byte(n.ID)) != nil {
+				continue
+			}
+			if err := putBoltNotification(outbox, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putBoltNotification(b *bolt.Bucket, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(n.ID), data)
+}
+
+// Pending implements Store.
+func (s *BoltStore) Pending() (notifications []Notification, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(_, v []byte) error {
+			var n Notification
+			if err := json.Unmarshal(v, &n); err != nil {
+				return err
+			}
+			notifications = append(notifications, n)
+			return nil
+		})
+	})
+	sortNotifications(notifications)
+	return notifications, err
+}
+
+// Reschedule implements Store.
+func (s *BoltStore) Reschedule(n Notification) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+		if b.Get([]byte(n.ID)) == nil {
+			return nil
+		}
+		return putBoltNotification(b, n)
+	})
+}
+
+// Ack implements Store.
+func (s *BoltStore) Ack(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).Delete([]byte(id))
+	})
+}
+
+// Delete implements Store.
+func (s *BoltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(positionsBucket).Delete([]byte(key))
+	})
+}
+
+// Keys implements Store.
+func (s *BoltStore) Keys() (keys []string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(positionsBucket).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Flush implements Store. Changes are committed on Set, so this is a no-op.
+func (s *BoltStore) Flush() error {
+	return nil
+}
+
+// Close implements Store.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
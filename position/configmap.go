@@ -0,0 +1,245 @@
+package position
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/source"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// ConfigMapDataKey is the ConfigMap data key under which positions are stored.
+	ConfigMapDataKey = "positions.json"
+	// ConfigMapOutboxKey is the ConfigMap data key under which the outbox is stored.
+	ConfigMapOutboxKey = "outbox.json"
+	kubernetesTimeout  = 30 * time.Second
+	// configMapMaxData is the maximum size of the data of a ConfigMap.
+	// The API server rejects ConfigMaps larger than 1 MiB, metadata included.
+	configMapMaxData = 1 << 20
+)
+
+// ErrConfigMapTooLarge is returned when positions and the outbox do not fit in a ConfigMap.
+var ErrConfigMapTooLarge = fmt.Errorf("positions and outbox exceed the size limit of a configmap")
+
+// configMapState is the content of the ConfigMap.
+type configMapState struct {
+	positions map[string]source.Cursor
+	outbox    map[string]Notification
+}
+
+// ConfigMapStore is a Store backed by a Kubernetes ConfigMap, storing positions
+// as JSON under ConfigMapDataKey and the outbox under ConfigMapOutboxKey.
+// Each change is applied to the latest version of the ConfigMap and retried on
+// conflict, relying on resourceVersion for optimistic concurrency, so that
+// concurrent jobs cannot clobber each other's positions.
+// The ConfigMap is created if it does not exist.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore returns a store keeping positions in the named ConfigMap.
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (s *ConfigMapStore) unmarshal(cm *corev1.ConfigMap, key string, v interface{}) error {
+	data, ok := cm.Data[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("malformed %s in configmap %s/%s: %w", key, s.namespace, s.name, err)
+	}
+	return nil
+}
+
+// load returns the ConfigMap and its content.
+// The ConfigMap is nil if it does not exist.
+func (s *ConfigMapStore) load(ctx context.Context) (*corev1.ConfigMap, *configMapState, error) {
+	state := &configMapState{
+		positions: make(map[string]source.Cursor),
+		outbox:    make(map[string]Notification),
+	}
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, state, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.unmarshal(cm, ConfigMapDataKey, &state.positions); err != nil {
+		return nil, nil, err
+	}
+	if err := s.unmarshal(cm, ConfigMapOutboxKey, &state.outbox); err != nil {
+		return nil, nil, err
+	}
+	return cm, state, nil
+}
+
+// update applies fn to the latest content and writes it back, retrying on conflict.
+func (s *ConfigMapStore) update(fn func(*configMapState)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, state, err := s.load(ctx)
+		if err != nil {
+			return err
+		}
+		fn(state)
+		positions, err := json.Marshal(state.positions)
+		if err != nil {
+			return err
+		}
+		outbox, err := json.Marshal(state.outbox)
+		if err != nil {
+			return err
+		}
+		if size := len(positions) + len(outbox); size > configMapMaxData {
+			return fmt.Errorf("%w: configmap %s/%s would be %d bytes, deliver pending notifications or lower pagination limits", ErrConfigMapTooLarge, s.namespace, s.name, size)
+		}
+		if cm == nil {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/name": "ct-monitor",
+					},
+				},
+				Data: map[string]string{
+					ConfigMapDataKey:   string(positions),
+					ConfigMapOutboxKey: string(outbox),
+				},
+			}
+			_, err := s.client.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created concurrently, retry against the existing ConfigMap.
+				return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, s.name, err)
+			}
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[ConfigMapDataKey] = string(positions)
+		cm.Data[ConfigMapOutboxKey] = string(outbox)
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Get implements Store.
+func (s *ConfigMapStore) Get(key string) (source.Cursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	_, state, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cursor, ok := state.positions[key]; ok {
+		return cursor, nil
+	}
+	return source.Cursor{}, nil
+}
+
+// Set implements Store.
+func (s *ConfigMapStore) Set(key string, cursor source.Cursor) error {
+	return s.Commit(key, cursor)
+}
+
+// Commit implements Store.
+func (s *ConfigMapStore) Commit(key string, cursor source.Cursor, notifications ...Notification) error {
+	return s.update(func(state *configMapState) {
+		current, ok := state.positions[key]
+		if !ok {
+			current = source.Cursor{}
+			state.positions[key] = current
+		}
+		for k, v := range cursor {
+			current[k] = v
+		}
+		for _, n := range notifications {
+			if _, ok := state.outbox[n.ID]; !ok {
+				state.outbox[n.ID] = n
+			}
+		}
+	})
+}
+
+// Delete implements Store.
+func (s *ConfigMapStore) Delete(key string) error {
+	return s.update(func(state *configMapState) {
+		delete(state.positions, key)
+	})
+}
+
+// Keys implements Store.
+func (s *ConfigMapStore) Keys() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	_, state, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(state.positions))
+	for k := range state.positions {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Pending implements Store.
+func (s *ConfigMapStore) Pending() ([]Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	_, state, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	notifications := make([]Notification, 0, len(state.outbox))
+	for _, n := range state.outbox {
+		notifications = append(notifications, n)
+	}
+	sortNotifications(notifications)
+	return notifications, nil
+}
+
+// Reschedule implements Store.
+func (s *ConfigMapStore) Reschedule(n Notification) error {
+	return s.update(func(state *configMapState) {
+		if _, ok := state.outbox[n.ID]; ok {
+			state.outbox[n.ID] = n
+		}
+	})
+}
+
+// Ack implements Store.
+func (s *ConfigMapStore) Ack(id string) error {
+	return s.update(func(state *configMapState) {
+		delete(state.outbox, id)
+	})
+}
+
+// Flush implements Store. Changes are written on Set, so this is a no-op.
+func (s *ConfigMapStore) Flush() error {
+	return nil
+}
+
+// Close implements Store.
+func (s *ConfigMapStore) Close() error {
+	return nil
+}
@@ -0,0 +1,131 @@
+//go:build test
+// +build test
+
+package position
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	testNamespace = "ct-monitor"
+	testConfigMap = "ct-monitor-positions"
+)
+
+func getTestConfigMapPositions(t *testing.T, client *fake.Clientset) map[string]source.Cursor {
+	t.Helper()
+	cm, err := client.CoreV1().ConfigMaps(testNamespace).Get(context.Background(), testConfigMap, metav1.GetOptions{})
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	positions := make(map[string]source.Cursor)
+	assert.NoError(t, json.Unmarshal([]byte(cm.Data[ConfigMapDataKey]), &positions))
+	return positions
+}
+
+func TestConfigMapStore(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset()
+	s := NewConfigMapStore(client, testNamespace, testConfigMap)
+	cursor, err := s.Get("example_2ecom:w0s0")
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	keys, err := s.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 42, "log1": 3}))
+	assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{"log2": 5}))
+	assert.NoError(t, s.Set("legacy-com", source.Cursor{source.DefaultCursorKey: 1}))
+	expected := source.Cursor{source.DefaultCursorKey: 42, "log1": 3, "log2": 5}
+	cursor, err = s.Get("example_2ecom:w0s0")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, cursor)
+
+	assert.NoError(t, s.Delete("legacy-com"))
+	keys, err = s.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example_2ecom:w0s0"}, keys)
+	assert.Equal(t, map[string]source.Cursor{"example_2ecom:w0s0": expected}, getTestConfigMapPositions(t, client))
+	assert.NoError(t, s.Close())
+}
+
+func TestConfigMapStoreConflict(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: testConfigMap, Namespace: testNamespace},
+		Data:       map[string]string{ConfigMapDataKey: `{"example_2ejp:w0s0":{"":1}}`},
+	})
+	conflicted := false
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicted {
+			return false, nil, nil
+		}
+		conflicted = true
+		// Simulate another job updating the ConfigMap since it was read.
+		concurrent := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: testConfigMap, Namespace: testNamespace},
+			Data:       map[string]string{ConfigMapDataKey: `{"example_2ejp:w0s0":{"":7}}`},
+		}
+		gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+		if err := client.Tracker().Update(gvr, concurrent, testNamespace); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewConflict(gvr.GroupResource(), testConfigMap, assert.AnError)
+	})
+	s := NewConfigMapStore(client, testNamespace, testConfigMap)
+	assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 42}))
+	assert.True(t, conflicted)
+	expected := map[string]source.Cursor{
+		"example_2ecom:w0s0": {source.DefaultCursorKey: 42},
+		"example_2ejp:w0s0":  {source.DefaultCursorKey: 7},
+	}
+	assert.Equal(t, expected, getTestConfigMapPositions(t, client))
+}
+
+func TestConfigMapStoreMalformed(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: testConfigMap, Namespace: testNamespace},
+		Data:       map[string]string{ConfigMapDataKey: "hoge"},
+	})
+	s := NewConfigMapStore(client, testNamespace, testConfigMap)
+	_, err := s.Get("example_2ecom:w0s0")
+	assert.Error(t, err)
+	assert.Error(t, s.Set("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 42}))
+}
+
+func TestConfigMapStoreTooLarge(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset()
+	s := NewConfigMapStore(client, testNamespace, testConfigMap)
+	assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 1}))
+	name := strings.Repeat("a", 60) + ".example.com"
+	issuances := make([]api.Issuance, 100)
+	for i := range issuances {
+		issuances[i] = api.Issuance{ID: uint64(i), Domains: []string{name}}
+		for len(issuances[i].Domains) < 200 {
+			issuances[i].Domains = append(issuances[i].Domains, name)
+		}
+	}
+	n := NewNotification("example_2ecom:w0s0", "example.com", "", filter.Annotate(issuances), time.Now())
+	err := s.Commit("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 100}, n)
+	assert.ErrorIs(t, err, ErrConfigMapTooLarge)
+	assert.Equal(t, map[string]source.Cursor{"example_2ecom:w0s0": {source.DefaultCursorKey: 1}}, getTestConfigMapPositions(t, client))
+}
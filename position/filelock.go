@@ -0,0 +1,72 @@
+package position
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileLock is a Lock backed by an advisory lock (flock, or LockFileEx on Windows)
+// on a lock file. The lock is released by the operating system if the holder
+// exits, so that it cannot go stale. The holder is recorded in the lock file
+// for troubleshooting.
+type FileLock struct {
+	filename string
+	mu       sync.Mutex
+	file     *os.File
+}
+
+// NewFileLock returns a lock on the lock file at filename, which is created if it does not exist.
+func NewFileLock(filename string) *FileLock {
+	return &FileLock{filename: filename}
+}
+
+// TryLock implements Lock.
+func (l *FileLock) TryLock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return nil
+	}
+	if err := createDir(l.filename); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.filename, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if !locked {
+		holder, _ := io.ReadAll(f)
+		f.Close()
+		return fmt.Errorf("%w: %s (%s)", ErrLocked, l.filename, strings.TrimSpace(string(holder)))
+	}
+	if err := f.Truncate(0); err == nil {
+		_, _ = fmt.Fprintf(f, "%s since %s\n", lockIdentity(), time.Now().UTC().Format(time.RFC3339))
+	}
+	l.file = f
+	return nil
+}
+
+// Unlock implements Lock.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	_ = l.file.Truncate(0)
+	err := unlockFile(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
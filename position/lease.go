@@ -0,0 +1,215 @@
+package position
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LeaseLock is a Lock backed by a Kubernetes Lease. The lease is renewed in the
+// background while held. A lease which has not been renewed for its duration,
+// for instance because its holder was killed, is considered stale and is taken over.
+// The lock is lost if the lease is taken over, or if it could not be renewed
+// for its duration, in which case the channel returned by Lost is closed.
+type LeaseLock struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+	lost chan struct{}
+}
+
+// NewLeaseLock returns a lock on the named Lease, which is created if it does not exist.
+func NewLeaseLock(client kubernetes.Interface, namespace, name string, duration time.Duration) *LeaseLock {
+	return &LeaseLock{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		identity:  lockIdentity(),
+		duration:  duration,
+	}
+}
+
+func isLeaseExpired(spec coordinationv1.LeaseSpec, now time.Time) bool {
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil {
+		return true
+	}
+	duration := time.Duration(0)
+	if spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	return spec.RenewTime.Add(duration).Before(now)
+}
+
+func (l *LeaseLock) holdSpec(now time.Time) coordinationv1.LeaseSpec {
+	seconds := int32(l.duration / time.Second)
+	t := metav1.NewMicroTime(now)
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       &l.identity,
+		LeaseDurationSeconds: &seconds,
+		AcquireTime:          &t,
+		RenewTime:            &t,
+	}
+}
+
+func (l *LeaseLock) acquire(ctx context.Context) error {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := time.Now()
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.name,
+				Namespace: l.namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/name": "ct-monitor",
+				},
+			},
+			Spec: l.holdSpec(now),
+		}
+		_, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("%w: lease %s/%s", ErrLocked, l.namespace, l.name)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !isLeaseExpired(lease.Spec, now) && *lease.Spec.HolderIdentity != l.identity {
+		return fmt.Errorf("%w: lease %s/%s (%s)", ErrLocked, l.namespace, l.name, *lease.Spec.HolderIdentity)
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" && *lease.Spec.HolderIdentity != l.identity {
+		_ = log.Warn("taking over stale lease", map[string]interface{}{
+			"lease":      l.namespace + "/" + l.name,
+			"holder":     *lease.Spec.HolderIdentity,
+			"renew_time": lease.Spec.RenewTime.String(),
+		})
+	}
+	lease.Spec = l.holdSpec(now)
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("%w: lease %s/%s", ErrLocked, l.namespace, l.name)
+	}
+	return err
+}
+
+func (l *LeaseLock) renew() error {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return fmt.Errorf("%w: lease %s/%s was taken over", ErrLockLost, l.namespace, l.name)
+	}
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// renewLoop renews the lease until stopped. It closes lost and returns if the
+// lease was taken over, or if it was not renewed for its duration, since
+// another process may then take it over.
+func (l *LeaseLock) renewLoop(stop <-chan struct{}, done, lost chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(max(l.duration/3, time.Second))
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := l.renew()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		_ = log.Error("failed to renew lease", map[string]interface{}{
+			"lease": l.namespace + "/" + l.name,
+			"error": err.Error(),
+		})
+		if errors.Is(err, ErrLockLost) || time.Since(renewed) >= l.duration {
+			_ = log.Error("lost lease", map[string]interface{}{
+				"lease": l.namespace + "/" + l.name,
+			})
+			close(lost)
+			return
+		}
+	}
+}
+
+// TryLock implements Lock.
+func (l *LeaseLock) TryLock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	l.lost = make(chan struct{})
+	go l.renewLoop(l.stop, l.done, l.lost)
+	return nil
+}
+
+// Lost implements LosableLock. The channel is nil if the lock is not held.
+func (l *LeaseLock) Lost() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Unlock implements Lock.
+func (l *LeaseLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stop == nil {
+		return nil
+	}
+	close(l.stop)
+	<-l.done
+	l.stop = nil
+	l.lost = nil
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,63 @@
+package position
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	// ErrLocked is returned when a lock is held elsewhere.
+	ErrLocked = errors.New("lock is held by another process")
+	// ErrLockLost is returned when a lock was lost while held.
+	ErrLockLost = errors.New("lock was lost")
+)
+
+// lockRetryInterval is the interval between attempts when waiting for a lock.
+var lockRetryInterval = 5 * time.Second
+
+// Lock is an exclusive lock guarding a position store for the duration of a run,
+// so that concurrent runs do not send duplicate alerts or overwrite each other's positions.
+type Lock interface {
+	// TryLock acquires the lock without waiting.
+	// It returns an error wrapping ErrLocked if the lock is held elsewhere.
+	TryLock() error
+	// Unlock releases the lock.
+	Unlock() error
+}
+
+// LosableLock is implemented by locks which may be lost while held, such as
+// leases taken over by another process after failing to renew them.
+type LosableLock interface {
+	Lock
+	// Lost returns a channel which is closed if the lock is lost while held.
+	Lost() <-chan struct{}
+}
+
+// Acquire acquires the lock. If wait is false, it fails as soon as the lock is
+// found to be held elsewhere. Otherwise, it retries until the lock is acquired
+// or the context is done.
+func Acquire(ctx context.Context, l Lock, wait bool) error {
+	for {
+		err := l.TryLock()
+		if err == nil || !wait || !errors.Is(err, ErrLocked) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// lockIdentity identifies the current process as a lock holder.
+func lockIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s_%d", hostname, os.Getpid())
+}
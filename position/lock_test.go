@@ -0,0 +1,139 @@
+//go:build test
+// +build test
+
+package position
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func init() {
+	lockRetryInterval = 10 * time.Millisecond
+}
+
+func TestFileLock(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "sub", "positions.toml.lock")
+	first := NewFileLock(filename)
+	second := NewFileLock(filename)
+	assert.NoError(t, first.TryLock())
+	assert.NoError(t, first.TryLock())
+	err := second.TryLock()
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(t, err, lockIdentity())
+	assert.NoError(t, first.Unlock())
+	assert.NoError(t, first.Unlock())
+	assert.NoError(t, second.TryLock())
+	assert.NoError(t, second.Unlock())
+}
+
+func newTestLeaseLock(client *fake.Clientset, identity string) *LeaseLock {
+	l := NewLeaseLock(client, testNamespace, testConfigMap, time.Minute)
+	l.identity = identity
+	return l
+}
+
+func TestLeaseLock(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset()
+	first := newTestLeaseLock(client, "first")
+	second := newTestLeaseLock(client, "second")
+	assert.NoError(t, first.TryLock())
+	err := second.TryLock()
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(t, err, "first")
+	assert.NoError(t, first.Unlock())
+
+	lease, err := client.CoordinationV1().Leases(testNamespace).Get(context.Background(), testConfigMap, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Nil(t, lease.Spec.HolderIdentity)
+	}
+	assert.NoError(t, second.TryLock())
+	assert.NoError(t, second.Unlock())
+}
+
+func TestLeaseLockLost(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset()
+	l := NewLeaseLock(client, testNamespace, testConfigMap, 3*time.Second)
+	l.identity = "first"
+	assert.NoError(t, l.TryLock())
+	lost := l.Lost()
+	assert.NotNil(t, lost)
+
+	leases := client.CoordinationV1().Leases(testNamespace)
+	lease, err := leases.Get(context.Background(), testConfigMap, metav1.GetOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	other := "second"
+	lease.Spec.HolderIdentity = &other
+	_, err = leases.Update(context.Background(), lease, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	select {
+	case <-lost:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lease loss not detected")
+	}
+	// The lease held by the new holder is left as is.
+	assert.NoError(t, l.Unlock())
+	assert.Nil(t, l.Lost())
+	lease, err = leases.Get(context.Background(), testConfigMap, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &other, lease.Spec.HolderIdentity)
+	}
+}
+
+func TestLeaseLockStale(t *testing.T) {
+	t.Parallel()
+	holder := "crashed"
+	seconds := int32(60)
+	renewTime := metav1.NewMicroTime(time.Now().Add(-2 * time.Minute))
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: testConfigMap, Namespace: testNamespace},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &renewTime,
+			RenewTime:            &renewTime,
+		},
+	})
+	l := newTestLeaseLock(client, "new")
+	assert.NoError(t, l.TryLock())
+	lease, err := client.CoordinationV1().Leases(testNamespace).Get(context.Background(), testConfigMap, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "new", *lease.Spec.HolderIdentity)
+	}
+	assert.NoError(t, l.Unlock())
+}
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "positions.toml.lock")
+	holder := NewFileLock(filename)
+	assert.NoError(t, holder.TryLock())
+
+	l := NewFileLock(filename)
+	assert.ErrorIs(t, Acquire(context.Background(), l, false), ErrLocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := Acquire(ctx, l, true)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = holder.Unlock()
+	}()
+	assert.NoError(t, Acquire(context.Background(), l, true))
+	assert.NoError(t, l.Unlock())
+}
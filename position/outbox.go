@@ -0,0 +1,120 @@
+package position
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Hsn723/ct-monitor/filter"
+)
+
+// Notification is a report of issuances pending delivery. Notifications are
+// committed to the outbox of a Store along with the position, and removed once
+// delivered, so that reports are neither lost nor sent twice when a run fails.
+type Notification struct {
+	// ID is the idempotency key of the notification, derived from its content.
+	ID string `json:"id"`
+	// Key is the position key of the domain.
+	Key string `json:"key"`
+	// Domain is the configured domain name which was queried.
+	Domain string `json:"domain"`
+	// Mailer is the name of the mailer the issuances are routed to, if any.
+	Mailer string `json:"mailer,omitempty"`
+	// Issuances are the issuances to report, along with their annotations.
+	// Certificates are stripped, see NewNotification.
+	Issuances []filter.AnnotatedIssuance `json:"issuances"`
+	// Warning tells recipients that the issuances could not be filtered.
+	Warning string `json:"warning,omitempty"`
+	// CreatedAt is the time the notification was committed.
+	CreatedAt time.Time `json:"created_at"`
+	// Attempts is the number of failed delivery attempts.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time before which delivery is not retried.
+	NextAttempt time.Time `json:"next_attempt"`
+	// LastError is the error returned by the last delivery attempt.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// NewNotification returns a notification for the issuances observed for a domain.
+// Its ID only depends on the position key and the issuances, so that committing
+// the same report twice results in a single notification.
+// The certificates themselves (CertDER and Cert.Data) are stripped from the
+// issuances, since reports only need their names, issuer, validity and hashes,
+// and stores such as ConfigMaps are limited in size.
+func NewNotification(key, domain, mailer string, issuances []filter.AnnotatedIssuance, now time.Time) Notification {
+	h := sha256.New()
+	h.Write([]byte(key))
+	for _, issuance := range issuances {
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatUint(issuance.ID, 10)))
+		h.Write([]byte{0})
+		h.Write([]byte(issuance.CertSHA256))
+	}
+	return Notification{
+		ID:          hex.EncodeToString(h.Sum(nil)),
+		Key:         key,
+		Domain:      domain,
+		Mailer:      mailer,
+		Issuances:   stripCertificates(issuances),
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+}
+
+func stripCertificates(issuances []filter.AnnotatedIssuance) []filter.AnnotatedIssuance {
+	if issuances == nil {
+		return nil
+	}
+	res := make([]filter.AnnotatedIssuance, len(issuances))
+	for i, issuance := range issuances {
+		issuance.CertDER = ""
+		issuance.Cert.Data = ""
+		res[i] = issuance
+	}
+	return res
+}
+
+// Coalesce groups notifications for the same position key, mailer and warning,
+// so that the pages of a domain pending delivery are reported at once.
+// Groups are returned in order of their first notification, and notifications
+// keep their order within groups.
+func Coalesce(notifications []Notification) [][]Notification {
+	type groupKey struct {
+		key, mailer, warning string
+	}
+	index := make(map[groupKey]int)
+	var res [][]Notification
+	for _, n := range notifications {
+		k := groupKey{key: n.Key, mailer: n.Mailer, warning: n.Warning}
+		i, ok := index[k]
+		if !ok {
+			i = len(res)
+			index[k] = i
+			res = append(res, nil)
+		}
+		res[i] = append(res[i], n)
+	}
+	return res
+}
+
+// BatchID returns the idempotency key of notifications delivered together.
+// This is the ID of the notification if there is only one.
+func BatchID(notifications []Notification) string {
+	if len(notifications) == 1 {
+		return notifications[0].ID
+	}
+	h := sha256.New()
+	for _, n := range notifications {
+		h.Write([]byte(n.ID))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortNotifications(notifications []Notification) {
+	slices.SortFunc(notifications, func(a, b Notification) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
@@ -0,0 +1,64 @@
+//go:build test
+// +build test
+
+package position
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNotificationStripsCertificates(t *testing.T) {
+	t.Parallel()
+	issuances := []filter.AnnotatedIssuance{{
+		Issuance: api.Issuance{
+			ID:         1,
+			Domains:    []string{"example.com"},
+			CertDER:    "MIIB",
+			CertSHA256: "aa",
+			Cert:       api.Certificate{Type: "cert", SHA256: "aa", Data: "MIIB"},
+		},
+		Annotations: filter.Annotations{"severity": "high"},
+	}}
+	n := NewNotification("example_2ecom:w0s0", "example.com", "", issuances, time.Now())
+	expected := []filter.AnnotatedIssuance{{
+		Issuance: api.Issuance{
+			ID:         1,
+			Domains:    []string{"example.com"},
+			CertSHA256: "aa",
+			Cert:       api.Certificate{Type: "cert", SHA256: "aa"},
+		},
+		Annotations: filter.Annotations{"severity": "high"},
+	}}
+	assert.Equal(t, expected, n.Issuances)
+	assert.Equal(t, "MIIB", issuances[0].CertDER)
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newNotification := func(key, mailer string, id uint64, warning string) Notification {
+		n := NewNotification(key, "example.com", mailer, filter.Annotate([]api.Issuance{{ID: id}}), now)
+		n.Warning = warning
+		return n
+	}
+	first := newNotification("example_2ecom:w0s0", "", 1, "")
+	routed := newNotification("example_2ecom:w0s0", "smtp", 2, "")
+	second := newNotification("example_2ecom:w0s0", "", 3, "")
+	other := newNotification("example_2ecom:w1s0", "", 4, "")
+	warned := newNotification("example_2ecom:w0s0", "", 5, "unfiltered")
+
+	groups := Coalesce([]Notification{first, routed, second, other, warned})
+	assert.Equal(t, [][]Notification{{first, second}, {routed}, {other}, {warned}}, groups)
+	assert.Empty(t, Coalesce(nil))
+
+	assert.Equal(t, first.ID, BatchID([]Notification{first}))
+	batch := BatchID([]Notification{first, second})
+	assert.NotEqual(t, first.ID, batch)
+	assert.NotEqual(t, second.ID, batch)
+	assert.Equal(t, batch, BatchID([]Notification{first, second}))
+}
@@ -0,0 +1,40 @@
+package position
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Hsn723/ct-monitor/source"
+)
+
+// Store is the interface for backends persisting per-domain cursors.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the cursor stored under key, or an empty cursor if there is none.
+	Get(key string) (source.Cursor, error)
+	// Set merges the cursor into the one stored under key.
+	Set(key string, cursor source.Cursor) error
+	// Commit atomically merges the cursor into the one stored under key and
+	// adds the notifications to the outbox. Notifications already in the
+	// outbox are left as is.
+	Commit(key string, cursor source.Cursor, notifications ...Notification) error
+	// Pending returns the notifications in the outbox, oldest first.
+	Pending() ([]Notification, error)
+	// Reschedule replaces a notification in the outbox after a failed delivery attempt.
+	// It is a no-op if the notification is no longer in the outbox.
+	Reschedule(n Notification) error
+	// Ack removes a delivered notification from the outbox.
+	Ack(id string) error
+	// Delete removes the cursor stored under key.
+	Delete(key string) error
+	// Keys returns the keys of all stored cursors.
+	Keys() ([]string, error)
+	// Flush persists changes, for stores which do not persist them on Set.
+	Flush() error
+	// Close flushes changes and releases resources held by the store.
+	Close() error
+}
+
+func createDir(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
@@ -0,0 +1,190 @@
+//go:build test
+// +build test
+
+package position
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/Hsn723/ct-monitor/filter"
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type storeFactory func(filename string) (Store, error)
+
+var storeFactories = map[string]storeFactory{
+	"TOML": func(filename string) (Store, error) { return NewTOMLStore(filename) },
+	"Bolt": func(filename string) (Store, error) { return NewBoltStore(filename) },
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	for title, newStore := range storeFactories {
+		newStore := newStore
+		t.Run(title, func(t *testing.T) {
+			t.Parallel()
+			filename := filepath.Join(t.TempDir(), "sub", "positions")
+			s, err := newStore(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			cursor, err := s.Get("example_2ecom:w0s0")
+			assert.NoError(t, err)
+			assert.Empty(t, cursor)
+
+			assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 42, "log1": 3}))
+			assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{"log2": 5}))
+			assert.NoError(t, s.Set("example_2ejp:w1s1", source.Cursor{source.DefaultCursorKey: 7}))
+			assert.NoError(t, s.Set("legacy-com", source.Cursor{source.DefaultCursorKey: 1, "log1": 2}))
+			expected := source.Cursor{source.DefaultCursorKey: 42, "log1": 3, "log2": 5}
+			cursor, err = s.Get("example_2ecom:w0s0")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, cursor)
+
+			assert.NoError(t, s.Delete("legacy-com"))
+			keys, err := s.Keys()
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"example_2ecom:w0s0", "example_2ejp:w1s1"}, keys)
+			assert.NoError(t, s.Close())
+
+			s, err = newStore(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer s.Close()
+			cursor, err = s.Get("example_2ecom:w0s0")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, cursor)
+			cursor, err = s.Get("legacy-com")
+			assert.NoError(t, err)
+			assert.Empty(t, cursor)
+		})
+	}
+}
+
+func TestStoreConcurrentSet(t *testing.T) {
+	t.Parallel()
+	for title, newStore := range storeFactories {
+		newStore := newStore
+		t.Run(title, func(t *testing.T) {
+			t.Parallel()
+			s, err := newStore(filepath.Join(t.TempDir(), "positions"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer s.Close()
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					assert.NoError(t, s.Set("example_2ecom:w0s0", source.Cursor{string(rune('a' + i)): uint64(i)}))
+				}(i)
+			}
+			wg.Wait()
+			cursor, err := s.Get("example_2ecom:w0s0")
+			assert.NoError(t, err)
+			assert.Len(t, cursor, 10)
+		})
+	}
+}
+
+func TestTOMLStoreEmpty(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "positions.toml")
+	s, err := NewTOMLStore(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Close())
+	assert.NoFileExists(t, filename)
+}
+
+func testOutbox(t *testing.T, s Store) {
+	t.Helper()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := NewNotification("example_2ecom:w0s0", "example.com", "", filter.Annotate([]api.Issuance{{ID: 1, CertSHA256: "aa"}}), now)
+	second := NewNotification("example_2ejp:w0s0", "example.jp", "smtp", []filter.AnnotatedIssuance{{Issuance: api.Issuance{ID: 2}, Annotations: filter.Annotations{"severity": "high"}}, {Issuance: api.Issuance{ID: 3}}}, now.Add(time.Minute))
+	assert.NotEqual(t, first.ID, second.ID)
+
+	assert.NoError(t, s.Commit("example_2ejp:w0s0", source.Cursor{source.DefaultCursorKey: 3}, second))
+	assert.NoError(t, s.Commit("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 1}, first))
+	cursor, err := s.Get("example_2ejp:w0s0")
+	assert.NoError(t, err)
+	assert.Equal(t, source.Cursor{source.DefaultCursorKey: 3}, cursor)
+	keys, err := s.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"example_2ecom:w0s0", "example_2ejp:w0s0"}, keys)
+
+	pending, err := s.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []Notification{first, second}, pending)
+
+	rescheduled := first
+	rescheduled.Attempts = 1
+	rescheduled.NextAttempt = now.Add(time.Hour)
+	rescheduled.LastError = "failed"
+	assert.NoError(t, s.Reschedule(rescheduled))
+	// Committing the same notification again leaves it as is.
+	assert.NoError(t, s.Commit("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 1}, first))
+	assert.NoError(t, s.Ack(second.ID))
+	assert.NoError(t, s.Reschedule(second))
+	pending, err = s.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []Notification{rescheduled}, pending)
+
+	assert.NoError(t, s.Ack(first.ID))
+	pending, err = s.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestStoreOutbox(t *testing.T) {
+	t.Parallel()
+	for title, newStore := range storeFactories {
+		newStore := newStore
+		t.Run(title, func(t *testing.T) {
+			t.Parallel()
+			filename := filepath.Join(t.TempDir(), "positions")
+			s, err := newStore(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			testOutbox(t, s)
+
+			// Acknowledged notifications must not come back once flushed.
+			n := NewNotification("example_2ecom:w0s0", "example.com", "", filter.Annotate([]api.Issuance{{ID: 4}}), time.Now().UTC())
+			assert.NoError(t, s.Commit("example_2ecom:w0s0", source.Cursor{source.DefaultCursorKey: 4}, n))
+			assert.NoError(t, s.Close())
+			s, err = newStore(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			pending, err := s.Pending()
+			assert.NoError(t, err)
+			if assert.Len(t, pending, 1) {
+				assert.Equal(t, n.ID, pending[0].ID)
+			}
+			assert.NoError(t, s.Ack(n.ID))
+			assert.NoError(t, s.Close())
+			s, err = newStore(filename)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer s.Close()
+			pending, err = s.Pending()
+			assert.NoError(t, err)
+			assert.Empty(t, pending)
+		})
+	}
+	t.Run("ConfigMap", func(t *testing.T) {
+		t.Parallel()
+		testOutbox(t, NewConfigMapStore(fake.NewClientset(), testNamespace, testConfigMap))
+	})
+}
@@ -0,0 +1,216 @@
+package position
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Hsn723/ct-monitor/source"
+	"github.com/spf13/viper"
+)
+
+const (
+	cursorKeySeparator = "@"
+	// tomlOutboxPrefix is the prefix of keys holding notifications, stored as JSON.
+	tomlOutboxPrefix = "_outbox."
+)
+
+// TOMLStore is a Store backed by a TOML file.
+// Changes are kept in memory until Flush is called, which replaces the file atomically.
+// Keys are lowercased, as is the case for any viper key.
+type TOMLStore struct {
+	filename string
+	mu       sync.Mutex
+	v        *viper.Viper
+}
+
+// NewTOMLStore opens the TOML file at filename, creating it if it does not exist.
+func NewTOMLStore(filename string) (*TOMLStore, error) {
+	if err := createDir(filename); err != nil {
+		return nil, err
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	v.SetConfigType("toml")
+	if err := v.ReadInConfig(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &TOMLStore{
+		filename: filename,
+		v:        v,
+	}, nil
+}
+
+func getCursorKey(key, cursorKey string) string {
+	if cursorKey == source.DefaultCursorKey {
+		return key
+	}
+	return key + cursorKeySeparator + cursorKey
+}
+
+func splitCursorKey(k string) string {
+	key, _, _ := strings.Cut(k, cursorKeySeparator)
+	return key
+}
+
+func isOutboxKey(k string) bool {
+	return strings.HasPrefix(k, tomlOutboxPrefix)
+}
+
+// remove drops the keys matching skip. viper cannot unset keys, so remaining
+// keys are copied over instead. The caller must hold mu.
+func (s *TOMLStore) remove(skip func(k string) bool) {
+	v := viper.New()
+	v.SetConfigFile(s.filename)
+	v.SetConfigType("toml")
+	for _, k := range s.v.AllKeys() {
+		if skip(k) {
+			continue
+		}
+		v.Set(k, s.v.Get(k))
+	}
+	s.v = v
+}
+
+// Get implements Store.
+func (s *TOMLStore) Get(key string) (source.Cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursor := source.Cursor{}
+	if s.v.IsSet(key) {
+		cursor[source.DefaultCursorKey] = s.v.GetUint64(key)
+	}
+	prefix := key + cursorKeySeparator
+	for _, k := range s.v.AllKeys() {
+		if strings.HasPrefix(k, prefix) {
+			cursor[strings.TrimPrefix(k, prefix)] = s.v.GetUint64(k)
+		}
+	}
+	return cursor, nil
+}
+
+// Set implements Store.
+func (s *TOMLStore) Set(key string, cursor source.Cursor) error {
+	return s.Commit(key, cursor)
+}
+
+// Commit implements Store.
+func (s *TOMLStore) Commit(key string, cursor source.Cursor, notifications ...Notification) error {
+	data := make(map[string]string, len(notifications))
+	for _, n := range notifications {
+		b, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		data[tomlOutboxPrefix+n.ID] = string(b)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range cursor {
+		s.v.Set(getCursorKey(key, k), v)
+	}
+	for k, v := range data {
+		if !s.v.IsSet(k) {
+			s.v.Set(k, v)
+		}
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *TOMLStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(func(k string) bool {
+		return !isOutboxKey(k) && splitCursorKey(k) == key
+	})
+	return nil
+}
+
+// Keys implements Store.
+func (s *TOMLStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for _, k := range s.v.AllKeys() {
+		if isOutboxKey(k) {
+			continue
+		}
+		keys = append(keys, splitCursorKey(k))
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// Pending implements Store.
+func (s *TOMLStore) Pending() ([]Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var notifications []Notification
+	for _, k := range s.v.AllKeys() {
+		if !isOutboxKey(k) {
+			continue
+		}
+		var n Notification
+		if err := json.Unmarshal([]byte(s.v.GetString(k)), &n); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	sortNotifications(notifications)
+	return notifications, nil
+}
+
+// Reschedule implements Store.
+func (s *TOMLStore) Reschedule(n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k := tomlOutboxPrefix + n.ID; s.v.IsSet(k) {
+		s.v.Set(k, string(b))
+	}
+	return nil
+}
+
+// Ack implements Store.
+func (s *TOMLStore) Ack(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(func(k string) bool {
+		return k == tomlOutboxPrefix+id
+	})
+	return nil
+}
+
+// Flush implements Store.
+func (s *TOMLStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.v.AllKeys()) == 0 {
+		// Avoid leaving an empty file, unless one needs to replace a stale file.
+		if _, err := os.Stat(s.filename); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.filename), "position.*.toml")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	if err := s.v.WriteConfigAs(tmpFile.Name()); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), s.filename)
+}
+
+// Close implements Store.
+func (s *TOMLStore) Close() error {
+	return s.Flush()
+}
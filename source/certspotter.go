@@ -0,0 +1,32 @@
+package source
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// CertspotterSource is an IssuanceSource backed by SSLMate's Cert Spotter API.
+type CertspotterSource struct {
+	Client api.CertspotterClient
+}
+
+// GetIssuances implements the IssuanceSource's GetIssuances interface.
+func (s *CertspotterSource) GetIssuances(ctx context.Context, q Query, cursor Cursor) ([]api.Issuance, Cursor, error) {
+	client := s.Client
+	if client.Client == nil {
+		client.Client = http.DefaultClient
+	}
+	client.Client = contextClient{ctx: ctx, client: client.Client}
+	issuances, err := client.GetIssuances(q.Domain, q.MatchWildcards, q.IncludeSubdomains, cursor[DefaultCursorKey])
+	if err != nil {
+		return nil, cursor, err
+	}
+	if len(issuances) == 0 {
+		return issuances, cursor, nil
+	}
+	next := cursor.Clone()
+	next[DefaultCursorKey] = issuances[len(issuances)-1].ID
+	return issuances, next, nil
+}
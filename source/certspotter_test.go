@@ -0,0 +1,76 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockHTTPClient struct {
+	content string
+	query   string
+}
+
+func (c *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.query = req.URL.RawQuery
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(c.content)),
+	}, nil
+}
+
+func TestCertspotterSourceGetIssuances(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title         string
+		content       string
+		cursor        Cursor
+		expectedAfter string
+		expectedIDs   []uint64
+		expected      Cursor
+	}{
+		{
+			title:       "Empty",
+			content:     "[]",
+			cursor:      Cursor{},
+			expectedIDs: []uint64{},
+			expected:    Cursor{},
+		},
+		{
+			title:         "Resume",
+			content:       `[{"id":"5"},{"id":"8"}]`,
+			cursor:        Cursor{DefaultCursorKey: 3},
+			expectedAfter: "after=3",
+			expectedIDs:   []uint64{5, 8},
+			expected:      Cursor{DefaultCursorKey: 8},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			client := &mockHTTPClient{content: tc.content}
+			src := &CertspotterSource{
+				Client: api.CertspotterClient{Client: client},
+			}
+			q := Query{Domain: "example.com"}
+			issuances, cursor, err := src.GetIssuances(context.Background(), q, tc.cursor)
+			assert.NoError(t, err)
+			ids := []uint64{}
+			for _, issuance := range issuances {
+				ids = append(ids, issuance.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expected, cursor)
+			assert.Contains(t, client.query, tc.expectedAfter)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package source
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+const (
+	// CrtshCursorKey is the cursor key used by CrtshSource.
+	// Certificate IDs are specific to crt.sh and must not be mixed with other sources.
+	CrtshCursorKey          = "crtsh"
+	defaultCrtshEndpoint    = "https://crt.sh/"
+	crtshTimestampLayout    = "2006-01-02T15:04:05"
+	crtshNameValueSeparator = "\n"
+)
+
+// ErrMalformedCrtshCertificate is returned when a certificate downloaded from crt.sh cannot be parsed.
+var ErrMalformedCrtshCertificate = fmt.Errorf("malformed crt.sh certificate")
+
+// CrtshSource is an IssuanceSource querying a crt.sh-compatible JSON endpoint.
+// Since crt.sh does not support resuming from a position, all certificates
+// for the domain are retrieved and those with an ID lower than or equal to
+// the cursor are discarded.
+// Search results do not include certificate hashes: unless FetchCertificates
+// is set, the hashes of the issuances returned are left empty.
+type CrtshSource struct {
+	// Endpoint is the crt.sh endpoint. This defaults to "https://crt.sh/".
+	Endpoint string `mapstructure:"endpoint"`
+	// ExcludeExpired should be set to true to ignore expired certificates.
+	ExcludeExpired bool `mapstructure:"exclude_expired"`
+	// FetchCertificates should be set to true to download each new certificate
+	// in order to compute its hashes, at the cost of one request per certificate.
+	FetchCertificates bool `mapstructure:"fetch_certificates"`
+	Client            api.HTTPClient
+}
+
+type crtshEntry struct {
+	ID         uint64 `json:"id"`
+	IssuerName string `json:"issuer_name"`
+	NameValue  string `json:"name_value"`
+	NotBefore  string `json:"not_before"`
+	NotAfter   string `json:"not_after"`
+}
+
+func (s *CrtshSource) endpoint() string {
+	if s.Endpoint == "" {
+		return defaultCrtshEndpoint
+	}
+	return s.Endpoint
+}
+
+// searchTerms returns the identities to search for in order to cover the query.
+func searchTerms(q Query) []string {
+	domain := normalizeName(q.Domain)
+	terms := []string{domain}
+	if q.IncludeSubdomains {
+		terms = append(terms, "%."+domain)
+	}
+	if _, parent, ok := strings.Cut(domain, "."); ok && q.MatchWildcards {
+		terms = append(terms, "*."+parent)
+	}
+	return terms
+}
+
+func (s *CrtshSource) search(ctx context.Context, term string) ([]crtshEntry, error) {
+	if s.Client == nil {
+		s.Client = http.DefaultClient
+	}
+	params := url.Values{}
+	params.Set("q", term)
+	params.Set("output", "json")
+	if s.ExcludeExpired {
+		params.Set("exclude", "expired")
+	}
+	body, err := fetch(ctx, s.Client, s.endpoint()+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var entries []crtshEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func formatCrtshTimestamp(ts string) string {
+	t, err := time.Parse(crtshTimestampLayout, ts)
+	if err != nil {
+		return ts
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// mergeEntry merges a crt.sh row into the issuance with the same certificate ID.
+func mergeEntry(issuance *api.Issuance, entry crtshEntry) {
+	issuance.ID = entry.ID
+	issuance.Issuer.Name = entry.IssuerName
+	issuance.NotBefore = formatCrtshTimestamp(entry.NotBefore)
+	issuance.NotAfter = formatCrtshTimestamp(entry.NotAfter)
+	for _, name := range strings.Split(entry.NameValue, crtshNameValueSeparator) {
+		name = normalizeName(strings.TrimSpace(name))
+		if name == "" || contains(issuance.Domains, name) {
+			continue
+		}
+		issuance.Domains = append(issuance.Domains, name)
+	}
+}
+
+// fetchCertificate downloads the certificate of the issuance in order to
+// fill in its hashes. The issuer's public key hash remains unknown.
+func (s *CrtshSource) fetchCertificate(ctx context.Context, issuance *api.Issuance) error {
+	params := url.Values{}
+	params.Set("d", strconv.FormatUint(issuance.ID, 10))
+	body, err := fetch(ctx, s.Client, s.endpoint()+"?"+params.Encode())
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(body)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("%w: %d", ErrMalformedCrtshCertificate, issuance.ID)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: %d: %w", ErrMalformedCrtshCertificate, issuance.ID, err)
+	}
+	hashed, err := NewIssuance(issuance.ID, cert, nil, "")
+	if err != nil {
+		return err
+	}
+	issuance.TBSSHA256 = hashed.TBSSHA256
+	issuance.PubKeySHA256 = hashed.PubKeySHA256
+	issuance.Cert = hashed.Cert
+	issuance.CertDER = hashed.CertDER
+	issuance.CertSHA256 = hashed.CertSHA256
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIssuances implements the IssuanceSource's GetIssuances interface.
+// Rows are deduplicated by certificate ID. If FetchCertificates is set,
+// the certificates of the issuances returned are downloaded, and the cursor
+// is left unchanged if any of them cannot be.
+func (s *CrtshSource) GetIssuances(ctx context.Context, q Query, cursor Cursor) ([]api.Issuance, Cursor, error) {
+	after := cursor[CrtshCursorKey]
+	byID := make(map[uint64]*api.Issuance)
+	for _, term := range searchTerms(q) {
+		entries, err := s.search(ctx, term)
+		if err != nil {
+			return nil, cursor, err
+		}
+		for _, entry := range entries {
+			if entry.ID <= after {
+				continue
+			}
+			issuance, ok := byID[entry.ID]
+			if !ok {
+				issuance = &api.Issuance{}
+				byID[entry.ID] = issuance
+			}
+			mergeEntry(issuance, entry)
+		}
+	}
+	res := []api.Issuance{}
+	for _, issuance := range byID {
+		if !q.Matches(issuance.Domains) {
+			continue
+		}
+		if s.FetchCertificates {
+			if err := s.fetchCertificate(ctx, issuance); err != nil {
+				return nil, cursor, err
+			}
+		}
+		res = append(res, *issuance)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	next := cursor.Clone()
+	for id := range byID {
+		next[CrtshCursorKey] = max(next[CrtshCursorKey], id)
+	}
+	return res, next, nil
+}
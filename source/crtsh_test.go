@@ -0,0 +1,161 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCrtshServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile("t/crtsh.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") != "json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// The fixture does not depend on the search term, so that
+		// duplicate rows across terms are also exercised.
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCrtshSourceGetIssuances(t *testing.T) {
+	t.Parallel()
+	server := newCrtshServer(t)
+	cases := []struct {
+		title       string
+		query       Query
+		cursor      Cursor
+		expectedIDs []uint64
+		expected    Cursor
+	}{
+		{
+			title:       "Exact",
+			query:       Query{Domain: "example.com"},
+			cursor:      Cursor{},
+			expectedIDs: []uint64{100, 101},
+			expected:    Cursor{CrtshCursorKey: 103},
+		},
+		{
+			title:       "IncludeSubdomains",
+			query:       Query{Domain: "example.com", IncludeSubdomains: true},
+			cursor:      Cursor{},
+			expectedIDs: []uint64{100, 101, 102},
+			expected:    Cursor{CrtshCursorKey: 103},
+		},
+		{
+			title:       "Resume",
+			query:       Query{Domain: "example.com", IncludeSubdomains: true},
+			cursor:      Cursor{CrtshCursorKey: 100, DefaultCursorKey: 7},
+			expectedIDs: []uint64{101, 102},
+			expected:    Cursor{CrtshCursorKey: 103, DefaultCursorKey: 7},
+		},
+		{
+			title:       "CaughtUp",
+			query:       Query{Domain: "example.com"},
+			cursor:      Cursor{CrtshCursorKey: 103},
+			expectedIDs: []uint64{},
+			expected:    Cursor{CrtshCursorKey: 103},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			src := &CrtshSource{Endpoint: server.URL}
+			issuances, cursor, err := src.GetIssuances(context.Background(), tc.query, tc.cursor)
+			assert.NoError(t, err)
+			ids := []uint64{}
+			for _, issuance := range issuances {
+				ids = append(ids, issuance.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expected, cursor)
+		})
+	}
+}
+
+func TestCrtshSourceMapping(t *testing.T) {
+	t.Parallel()
+	server := newCrtshServer(t)
+	src := &CrtshSource{Endpoint: server.URL}
+	issuances, _, err := src.GetIssuances(context.Background(), Query{Domain: "www.example.com"}, Cursor{CrtshCursorKey: 100})
+	assert.NoError(t, err)
+	if assert.Len(t, issuances, 1) {
+		assert.Equal(t, uint64(101), issuances[0].ID)
+		assert.Equal(t, []string{"example.com", "www.example.com"}, issuances[0].Domains)
+		assert.Equal(t, "C=US, O=Let's Encrypt, CN=R3", issuances[0].Issuer.Name)
+		assert.Equal(t, "2024-01-01T00:00:00Z", issuances[0].NotBefore)
+		assert.Equal(t, "2024-03-31T00:00:00Z", issuances[0].NotAfter)
+	}
+}
+
+func TestCrtshSourceFetchCertificates(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("t/crtsh.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := newTestCA(t)
+	cert := ca.issue(t, 101, false, "example.com", "www.example.com")
+	var downloads []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("d"); id != "" {
+			mu.Lock()
+			downloads = append(downloads, id)
+			mu.Unlock()
+			if id != "101" {
+				_, _ = w.Write([]byte("not a certificate"))
+				return
+			}
+			_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	src := &CrtshSource{Endpoint: server.URL, FetchCertificates: true}
+	issuances, cursor, err := src.GetIssuances(context.Background(), Query{Domain: "www.example.com"}, Cursor{CrtshCursorKey: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{CrtshCursorKey: 103}, cursor)
+	assert.Equal(t, []string{"101"}, downloads)
+	expected, err := NewIssuance(101, cert, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, issuances, 1) {
+		assert.Equal(t, "C=US, O=Let's Encrypt, CN=R3", issuances[0].Issuer.Name)
+		assert.Equal(t, expected.TBSSHA256, issuances[0].TBSSHA256)
+		assert.Equal(t, expected.PubKeySHA256, issuances[0].PubKeySHA256)
+		assert.Equal(t, expected.CertSHA256, issuances[0].CertSHA256)
+		assert.Equal(t, expected.Cert, issuances[0].Cert)
+	}
+
+	issuances, cursor, err = src.GetIssuances(context.Background(), Query{Domain: "example.com"}, Cursor{CrtshCursorKey: 99})
+	assert.ErrorIs(t, err, ErrMalformedCrtshCertificate)
+	assert.Empty(t, issuances)
+	assert.Equal(t, Cursor{CrtshCursorKey: 99}, cursor)
+}
+
+func TestSearchTerms(t *testing.T) {
+	t.Parallel()
+	q := Query{Domain: "www.Example.com", MatchWildcards: true, IncludeSubdomains: true}
+	assert.Equal(t, []string{"www.example.com", "%.www.example.com", "*.example.com"}, searchTerms(q))
+}
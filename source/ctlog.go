@@ -0,0 +1,296 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+)
+
+const (
+	defaultCTLogBatchSize  = 256
+	defaultCTLogMaxEntries = 16384
+	// ctLogIndexBits is the number of bits of issuance IDs holding the index
+	// of the entry, the remaining bits identifying the log.
+	ctLogIndexBits = 40
+)
+
+// ErrNoLogs is returned when no CT log could be queried.
+var ErrNoLogs = fmt.Errorf("no CT log could be queried")
+
+// CTLogSource is an IssuanceSource tailing RFC 6962 CT logs directly.
+// Each log keeps its own cursor. Logs are tailed from their current tree
+// size the first time they are seen for a given domain. Entries fetched are
+// shared by all domains when the source is obtained with WithClient.
+type CTLogSource struct {
+	// Logs is the list of CT logs to tail.
+	Logs []CTLog `mapstructure:"logs"`
+	// BatchSize is the number of entries requested per get-entries call.
+	// This defaults to 256.
+	BatchSize uint64 `mapstructure:"batch_size"`
+	// MaxEntries is the maximum number of entries scanned per log on each call.
+	// This defaults to 16384.
+	MaxEntries uint64 `mapstructure:"max_entries"`
+	Client     api.HTTPClient
+
+	cache *logCache[ctLogState]
+}
+
+// CTLog represents a CT log.
+type CTLog struct {
+	// URL is the base URL of the log, without the "ct/v1/" suffix.
+	URL string `mapstructure:"url"`
+}
+
+type signedTreeHead struct {
+	TreeSize uint64 `json:"tree_size"`
+}
+
+type ctLogEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+type getEntriesResponse struct {
+	Entries []ctLogEntry `json:"entries"`
+}
+
+// ctLogState caches the tree size and the entries fetched from a log within its window.
+// Its lock is held while the log is scanned, so that concurrent scans
+// of the same log wait for entries being fetched instead of fetching them again.
+type ctLogState struct {
+	mu      sync.Mutex
+	sth     *signedTreeHead
+	entries map[uint64]ctLogEntry
+	window  logWindow
+}
+
+// CursorKey returns the cursor key for the log.
+func (l CTLog) CursorKey() string {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(l.URL, "/")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// issuanceID returns the ID of the issuance logged at the given index.
+// Since indexes are specific to each log, IDs are made of a prefix derived
+// from the URL of the log followed by the index.
+func (l CTLog) issuanceID(index uint64) uint64 {
+	sum := sha256.Sum256([]byte(strings.TrimSuffix(l.URL, "/")))
+	prefix := binary.BigEndian.Uint64(sum[:8]) >> ctLogIndexBits
+	return prefix<<ctLogIndexBits | index&(1<<ctLogIndexBits-1)
+}
+
+func (l CTLog) endpoint(path string) string {
+	return strings.TrimSuffix(l.URL, "/") + "/ct/v1/" + path
+}
+
+func (s *CTLogSource) get(ctx context.Context, url string, v interface{}) error {
+	if s.Client == nil {
+		s.Client = http.DefaultClient
+	}
+	body, err := fetch(ctx, s.Client, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (s *CTLogSource) getSTH(ctx context.Context, l CTLog) (signedTreeHead, error) {
+	var sth signedTreeHead
+	err := s.get(ctx, l.endpoint("get-sth"), &sth)
+	return sth, err
+}
+
+func (s *CTLogSource) getEntries(ctx context.Context, l CTLog, start, end uint64) (getEntriesResponse, error) {
+	var res getEntriesResponse
+	err := s.get(ctx, fmt.Sprintf("%s?start=%d&end=%d", l.endpoint("get-entries"), start, end), &res)
+	return res, err
+}
+
+func (s *CTLogSource) batchSize() uint64 {
+	if s.BatchSize == 0 {
+		return defaultCTLogBatchSize
+	}
+	return s.BatchSize
+}
+
+func (s *CTLogSource) maxEntries() uint64 {
+	return maxEntriesOrDefault(s.MaxEntries)
+}
+
+func maxEntriesOrDefault(maxEntries uint64) uint64 {
+	if maxEntries == 0 {
+		return defaultCTLogMaxEntries
+	}
+	return maxEntries
+}
+
+// fetchEntries fetches entries from start up to the end of the batch, the
+// next cached entry or end, whichever comes first, and caches them.
+func (s *CTLogSource) fetchEntries(ctx context.Context, l CTLog, state *ctLogState, start, end uint64) error {
+	last := min(start+s.batchSize(), end)
+	for i := start + 1; i < last; i++ {
+		if _, ok := state.entries[i]; ok {
+			last = i
+			break
+		}
+	}
+	res, err := s.getEntries(ctx, l, start, last-1)
+	if err != nil {
+		return err
+	}
+	for i, entry := range res.Entries {
+		state.entries[start+uint64(i)] = entry
+	}
+	return nil
+}
+
+// scanLog scans the log from the given index and returns matching issuances
+// along with the index to resume from. On error, issuances found so far are
+// returned with the index of the first entry that was not scanned.
+// The tree size is cached for the lifetime of the source, and entries for
+// as long as they are within the window of the log.
+func (s *CTLogSource) scanLog(ctx context.Context, l CTLog, q Query, start uint64, resume bool) ([]api.Issuance, uint64, error) {
+	state := s.cache.get(l)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.sth == nil {
+		sth, err := s.getSTH(ctx, l)
+		if err != nil {
+			return nil, start, err
+		}
+		state.sth = &sth
+		state.entries = make(map[uint64]ctLogEntry)
+	}
+	if !resume {
+		return nil, state.sth.TreeSize, nil
+	}
+	res, position, err := s.scanEntries(ctx, l, state, q, start)
+	state.evict(q, start, position, err != nil || position >= state.sth.TreeSize, s.maxEntries())
+	return res, position, err
+}
+
+func (s *CTLogSource) scanEntries(ctx context.Context, l CTLog, state *ctLogState, q Query, start uint64) ([]api.Issuance, uint64, error) {
+	end := min(state.sth.TreeSize, start+s.maxEntries())
+	var res []api.Issuance
+	for ; start < end; start++ {
+		entry, ok := state.entries[start]
+		if !ok {
+			if err := s.fetchEntries(ctx, l, state, start, end); err != nil {
+				return res, start, err
+			}
+			if entry, ok = state.entries[start]; !ok {
+				break
+			}
+		}
+		issuance, ok, err := parseLogEntry(l.issuanceID(start), entry.LeafInput, entry.ExtraData, q)
+		if err != nil {
+			_ = log.Warn("skipping malformed log entry", map[string]interface{}{
+				"log":   l.URL,
+				"index": start,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if ok {
+			res = append(res, issuance)
+		}
+	}
+	return res, start, nil
+}
+
+// evict drops the cached entries outside of the window of the log.
+func (st *ctLogState) evict(q Query, start, position uint64, done bool, maxEntries uint64) {
+	low, high := st.window.update(q, start, position, done, maxEntries)
+	for i := range st.entries {
+		if i < low || i >= high {
+			delete(st.entries, i)
+		}
+	}
+}
+
+func parseLogEntry(id uint64, leafInput, extraData []byte, q Query) (api.Issuance, bool, error) {
+	var e logEntry
+	if err := parseMerkleTreeLeaf(leafInput, &e); err != nil {
+		return api.Issuance{}, false, err
+	}
+	if err := parseExtraData(extraData, &e); err != nil {
+		return api.Issuance{}, false, err
+	}
+	return e.toIssuance(id, q)
+}
+
+// WithClient returns a copy of the source using the given client, with an
+// empty cache of fetched entries. The copy should be used for a single run, so that
+// entries are fetched once per run and shared by all domains.
+func (s *CTLogSource) WithClient(client api.HTTPClient) *CTLogSource {
+	res := *s
+	res.Client = client
+	res.cache = &logCache[ctLogState]{}
+	return &res
+}
+
+// GetIssuances implements the IssuanceSource's GetIssuances interface.
+func (s *CTLogSource) GetIssuances(ctx context.Context, q Query, cursor Cursor) ([]api.Issuance, Cursor, error) {
+	return scanLogs(ctx, s.Logs, q, cursor, s.scanLog)
+}
+
+type logScanner func(ctx context.Context, l CTLog, q Query, start uint64, resume bool) ([]api.Issuance, uint64, error)
+
+// scanLogs scans each log from its cursor and merges the resulting issuances.
+// Certificates logged to several logs, as well as precertificates along with
+// their certificate, are reported once, preferring the certificate.
+// Logs which cannot be queried are skipped and keep their cursor, so that
+// no entry is missed once they become available again. Scanning stops when
+// ctx is canceled, in which case the cursor is returned unchanged.
+func scanLogs(ctx context.Context, logs []CTLog, q Query, cursor Cursor, scan logScanner) ([]api.Issuance, Cursor, error) {
+	next := cursor.Clone()
+	// seen holds the index in res of issuances by TBSCertificate hash.
+	seen := make(map[string]int)
+	res := []api.Issuance{}
+	failed := 0
+	for _, l := range logs {
+		if ctx.Err() != nil {
+			break
+		}
+		key := l.CursorKey()
+		start, resume := cursor[key]
+		issuances, position, err := scan(ctx, l, q, start, resume)
+		if err != nil {
+			_ = log.Error("failed to scan CT log", map[string]interface{}{
+				"log":    l.URL,
+				"domain": q.Domain,
+				"error":  err.Error(),
+			})
+			failed++
+		}
+		if resume || err == nil {
+			next[key] = position
+		}
+		for _, issuance := range issuances {
+			if i, ok := seen[issuance.TBSSHA256]; ok {
+				if res[i].Cert.Type == precertType && issuance.Cert.Type != precertType {
+					res[i] = issuance
+				}
+				continue
+			}
+			seen[issuance.TBSSHA256] = len(res)
+			res = append(res, issuance)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, cursor, err
+	}
+	if len(logs) > 0 && failed == len(logs) {
+		return nil, cursor, ErrNoLogs
+	}
+	return res, next, nil
+}
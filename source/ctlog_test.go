@@ -0,0 +1,248 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+type fakeLogEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+// fakeLog is a minimal RFC 6962 log serving get-sth and get-entries.
+type fakeLog struct {
+	entries []fakeLogEntry
+	// maxEntries limits the number of entries returned per get-entries call.
+	maxEntries int
+	// requests counts the get-entries calls served.
+	requests int
+}
+
+func (l *fakeLog) add(t *testing.T, cert, issuer *x509.Certificate, precert bool) {
+	t.Helper()
+	var leaf cryptobyte.Builder
+	leaf.AddUint8(leafVersionV1)
+	leaf.AddUint8(timestampedEntryLeaf)
+	addTimestampedEntry(&leaf, cert, issuer, precert)
+	var extra cryptobyte.Builder
+	if precert {
+		extra.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cert.Raw)
+		})
+	}
+	extra.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(issuer.Raw)
+		})
+	})
+	l.entries = append(l.entries, fakeLogEntry{
+		LeafInput: leaf.BytesOrPanic(),
+		ExtraData: extra.BytesOrPanic(),
+	})
+}
+
+func (l *fakeLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/ct/v1/get-sth":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"tree_size": len(l.entries),
+		})
+	case "/ct/v1/get-entries":
+		l.requests++
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		end, _ := strconv.Atoi(r.URL.Query().Get("end"))
+		if start > end || end >= len(l.entries) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if l.maxEntries > 0 && end-start+1 > l.maxEntries {
+			end = start + l.maxEntries - 1
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"entries": l.entries[start : end+1],
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCTLogSourceGetIssuances(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeLog{maxEntries: 2}
+	fl.add(t, ca.issue(t, 2, false, "other.example.org"), ca.cert, false)
+	precert := ca.issue(t, 3, true, "www.example.com")
+	fl.add(t, precert, ca.cert, true)
+	fl.add(t, ca.issue(t, 4, false, "*.example.com"), ca.cert, false)
+	fl.add(t, ca.issue(t, 5, false, "example.com", "api.example.com"), ca.cert, false)
+	server := httptest.NewServer(fl)
+	defer server.Close()
+	deadServer := httptest.NewServer(http.NotFoundHandler())
+	defer deadServer.Close()
+
+	l := CTLog{URL: server.URL + "/"}
+	dead := CTLog{URL: deadServer.URL}
+	src := &CTLogSource{
+		Logs:      []CTLog{l, dead},
+		BatchSize: 3,
+	}
+	q := Query{Domain: "example.com", MatchWildcards: true}
+
+	issuances, cursor, err := src.GetIssuances(context.Background(), q, Cursor{})
+	assert.NoError(t, err)
+	assert.Empty(t, issuances)
+	assert.Equal(t, Cursor{l.CursorKey(): 4}, cursor)
+
+	issuances, cursor, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 0, dead.CursorKey(): 7})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 4, dead.CursorKey(): 7}, cursor)
+	if assert.Len(t, issuances, 1) {
+		assert.Equal(t, l.issuanceID(3), issuances[0].ID)
+		assert.Equal(t, []string{"example.com", "api.example.com"}, issuances[0].Domains)
+		assert.Equal(t, "cert", issuances[0].Cert.Type)
+		assert.Equal(t, hexSHA256(ca.cert.RawSubjectPublicKeyInfo), issuances[0].Issuer.PubKeySHA256)
+	}
+
+	q.IncludeSubdomains = true
+	issuances, _, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 1})
+	assert.NoError(t, err)
+	if assert.Len(t, issuances, 3) {
+		assert.Equal(t, "precert", issuances[0].Cert.Type)
+		assert.Equal(t, hexSHA256(precert.Raw), issuances[0].CertSHA256)
+		assert.Equal(t, hexSHA256(ca.cert.RawSubjectPublicKeyInfo), issuances[0].Issuer.PubKeySHA256)
+	}
+
+	src.Logs = []CTLog{dead}
+	_, cursor, err = src.GetIssuances(context.Background(), q, Cursor{dead.CursorKey(): 7})
+	assert.ErrorIs(t, err, ErrNoLogs)
+	assert.Equal(t, Cursor{dead.CursorKey(): 7}, cursor)
+}
+
+func TestCTLogSourceSharedEntries(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeLog{}
+	fl.add(t, ca.issue(t, 2, false, "www.example.org"), ca.cert, false)
+	fl.add(t, ca.issue(t, 3, false, "www.example.com"), ca.cert, false)
+	fl.add(t, ca.issue(t, 4, false, "api.example.org"), ca.cert, false)
+	server := httptest.NewServer(fl)
+	defer server.Close()
+
+	l := CTLog{URL: server.URL}
+	src := (&CTLogSource{Logs: []CTLog{l}, BatchSize: 2}).WithClient(http.DefaultClient)
+	issuances, cursor, err := src.GetIssuances(context.Background(), Query{Domain: "example.com", IncludeSubdomains: true}, Cursor{l.CursorKey(): 1})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 1)
+	assert.Equal(t, Cursor{l.CursorKey(): 3}, cursor)
+	assert.Equal(t, 1, fl.requests)
+
+	// Only the entry not fetched yet is requested for the next domain.
+	issuances, cursor, err = src.GetIssuances(context.Background(), Query{Domain: "example.org", IncludeSubdomains: true}, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 2)
+	assert.Equal(t, Cursor{l.CursorKey(): 3}, cursor)
+	assert.Equal(t, 2, fl.requests)
+
+	issuances, _, err = src.GetIssuances(context.Background(), Query{Domain: "example.com", IncludeSubdomains: true}, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 1)
+	assert.Equal(t, 2, fl.requests)
+}
+
+func TestCTLogSourceEvictsEntries(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeLog{}
+	for i := int64(0); i < 6; i++ {
+		fl.add(t, ca.issue(t, i+2, false, "www.example.com"), ca.cert, false)
+	}
+	server := httptest.NewServer(fl)
+	defer server.Close()
+
+	l := CTLog{URL: server.URL}
+	src := (&CTLogSource{Logs: []CTLog{l}, MaxEntries: 2}).WithClient(http.DefaultClient)
+	state := src.cache.get(l)
+	slow := Query{Domain: "example.com"}
+	fast := Query{Domain: "www.example.com"}
+
+	_, cursor, err := src.GetIssuances(context.Background(), slow, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 2}, cursor)
+	assert.Len(t, state.entries, 2)
+
+	// Entries below the position of the slowest domain are dropped.
+	_, cursor, err = src.GetIssuances(context.Background(), fast, Cursor{l.CursorKey(): 2})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 4}, cursor)
+	assert.Len(t, state.entries, 2)
+	assert.Contains(t, state.entries, uint64(2))
+
+	_, _, err = src.GetIssuances(context.Background(), slow, Cursor{l.CursorKey(): 2})
+	assert.NoError(t, err)
+	_, cursor, err = src.GetIssuances(context.Background(), fast, Cursor{l.CursorKey(): 4})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 6}, cursor)
+	assert.NotContains(t, state.entries, uint64(2))
+
+	// Once every domain caught up, only the last window is kept.
+	_, cursor, err = src.GetIssuances(context.Background(), slow, Cursor{l.CursorKey(): 4})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 6}, cursor)
+	assert.Len(t, state.entries, 2)
+	assert.NotContains(t, state.entries, uint64(3))
+}
+
+func TestCTLogIssuanceID(t *testing.T) {
+	t.Parallel()
+	a := CTLog{URL: "https://a.example.com/log/"}
+	b := CTLog{URL: "https://b.example.com/log"}
+	assert.Equal(t, a.issuanceID(5), CTLog{URL: "https://a.example.com/log"}.issuanceID(5))
+	assert.NotEqual(t, a.issuanceID(5), b.issuanceID(5))
+	assert.NotEqual(t, a.issuanceID(5), a.issuanceID(6))
+	assert.Equal(t, uint64(5), a.issuanceID(5)&(1<<ctLogIndexBits-1))
+}
+
+func TestScanLogsDeduplicates(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	precert, err := NewIssuance(1, ca.issue(t, 2, true, "www.example.com"), ca.cert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := NewIssuance(2, ca.issue(t, 2, false, "www.example.com"), ca.cert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewIssuance(3, ca.issue(t, 3, false, "api.example.com"), ca.cert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, precert.TBSSHA256, cert.TBSSHA256)
+	logs := []CTLog{{URL: "https://a.example.com"}, {URL: "https://b.example.com"}}
+	scanned := map[string][]api.Issuance{
+		logs[0].URL: {precert, other},
+		logs[1].URL: {cert, other},
+	}
+	scan := func(_ context.Context, l CTLog, _ Query, start uint64, _ bool) ([]api.Issuance, uint64, error) {
+		return scanned[l.URL], start + 1, nil
+	}
+	issuances, _, err := scanLogs(context.Background(), logs, Query{Domain: "example.com"}, Cursor{}, scan)
+	assert.NoError(t, err)
+	if assert.Len(t, issuances, 2) {
+		assert.Equal(t, cert.ID, issuances[0].ID)
+		assert.Equal(t, other.ID, issuances[1].ID)
+	}
+}
@@ -0,0 +1,39 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+// fetch performs a GET request and returns the response body.
+func fetch(ctx context.Context, client api.HTTPClient, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code returned by %s: %d", url, res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// contextClient is an HTTPClient sending requests with a context, for clients
+// which build requests without one.
+type contextClient struct {
+	ctx    context.Context
+	client api.HTTPClient
+}
+
+// Do implements the HTTPClient's Do interface.
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
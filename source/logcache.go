@@ -0,0 +1,63 @@
+package source
+
+import (
+	"sync"
+)
+
+// logCache holds the state of each CT log scanned by a source. Sources are
+// instantiated once per run, so that each log range is downloaded once per
+// run and matched against every domain, instead of once per domain.
+// It is safe for concurrent use.
+type logCache[T any] struct {
+	mu   sync.Mutex
+	logs map[string]*T
+}
+
+// get returns the state of the log, creating it if needed.
+// A nil cache returns a new state on each call.
+func (c *logCache[T]) get(l CTLog) *T {
+	if c == nil {
+		return new(T)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.logs == nil {
+		c.logs = make(map[string]*T)
+	}
+	key := l.CursorKey()
+	state, ok := c.logs[key]
+	if !ok {
+		state = new(T)
+		c.logs[key] = state
+	}
+	return state
+}
+
+// logWindow bounds the entries cached for a log. Entries are kept from the
+// lowest position of the domains still scanning the log, and up to the
+// maximum number of entries scanned per call past it, so that memory does not
+// grow with the backlog. Domains scanning the log in lockstep, which is the
+// case when they are checked concurrently or are caught up, share entries,
+// while others fetch them again.
+type logWindow struct {
+	positions map[Query]uint64
+}
+
+// update records the position the domain reached after scanning from start,
+// and returns the range of entries to keep. Domains which caught up with
+// the log, or failed to scan it, no longer hold entries.
+func (w *logWindow) update(q Query, start, position uint64, done bool, maxEntries uint64) (low, high uint64) {
+	if w.positions == nil {
+		w.positions = make(map[Query]uint64)
+	}
+	if done {
+		delete(w.positions, q)
+	} else {
+		w.positions[q] = position
+	}
+	low = start
+	for _, p := range w.positions {
+		low = min(low, p)
+	}
+	return low, low + maxEntries
+}
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"strings"
+)
+
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// MatchesName returns true if the DNS name matches the query, following
+// the semantics of the Cert Spotter API.
+//   - The name matches if it is equal to the queried domain.
+//   - If IncludeSubdomains is set, names under the queried domain, including
+//     wildcards, also match.
+//   - If MatchWildcards is set, wildcard names covering the queried domain also match.
+func (q Query) MatchesName(name string) bool {
+	domain := normalizeName(q.Domain)
+	name = normalizeName(name)
+	if name == domain {
+		return true
+	}
+	if q.IncludeSubdomains && strings.HasSuffix(name, "."+domain) {
+		return true
+	}
+	if !q.MatchWildcards {
+		return false
+	}
+	base, ok := strings.CutPrefix(name, "*.")
+	if !ok {
+		return false
+	}
+	label, ok := strings.CutSuffix(domain, "."+base)
+	return ok && label != "" && !strings.Contains(label, ".")
+}
+
+// Matches returns true if any of the DNS names matches the query.
+func (q Query) Matches(names []string) bool {
+	for _, name := range names {
+		if q.MatchesName(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesName(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title    string
+		query    Query
+		name     string
+		expected bool
+	}{
+		{title: "Exact", query: Query{Domain: "example.com"}, name: "example.com", expected: true},
+		{title: "CaseInsensitive", query: Query{Domain: "example.com"}, name: "EXAMPLE.com.", expected: true},
+		{title: "Subdomain", query: Query{Domain: "example.com"}, name: "www.example.com"},
+		{title: "IncludeSubdomains", query: Query{Domain: "example.com", IncludeSubdomains: true}, name: "a.b.example.com", expected: true},
+		{title: "IncludeSubdomainsWildcard", query: Query{Domain: "example.com", IncludeSubdomains: true}, name: "*.example.com", expected: true},
+		{title: "Suffix", query: Query{Domain: "example.com", IncludeSubdomains: true}, name: "badexample.com"},
+		{title: "Wildcard", query: Query{Domain: "www.example.com"}, name: "*.example.com"},
+		{title: "MatchWildcards", query: Query{Domain: "www.example.com", MatchWildcards: true}, name: "*.example.com", expected: true},
+		{title: "MatchWildcardsApex", query: Query{Domain: "example.com", MatchWildcards: true}, name: "*.example.com"},
+		{title: "MatchWildcardsDeep", query: Query{Domain: "a.www.example.com", MatchWildcards: true}, name: "*.example.com"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, tc.query.MatchesName(tc.name))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package source
+
+import (
+	"net/http"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedClient is an HTTPClient waiting on a rate limiter before each request.
+// It is safe for concurrent use, so that a single limiter can be shared by all
+// domains queried through a source.
+type RateLimitedClient struct {
+	Client  api.HTTPClient
+	Limiter *rate.Limiter
+}
+
+// NewRateLimitedClient returns a client allowing up to r requests per second with the given burst.
+func NewRateLimitedClient(client api.HTTPClient, r float64, burst int) *RateLimitedClient {
+	return &RateLimitedClient{
+		Client:  client,
+		Limiter: rate.NewLimiter(rate.Limit(r), max(burst, 1)),
+	}
+}
+
+// Do implements the HTTPClient's Do interface.
+func (c *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
@@ -0,0 +1,33 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitedClient(t *testing.T) {
+	t.Parallel()
+	client := NewRateLimitedClient(&mockHTTPClient{content: "[]"}, 20, 0)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		assert.NoError(t, err)
+		_, err = client.Do(req)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+	assert.NoError(t, err)
+	_, err = client.Do(req)
+	assert.Error(t, err)
+}
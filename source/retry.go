@@ -0,0 +1,184 @@
+package source
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+)
+
+// RetryPolicy represents the policy for retrying failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per request, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between retries.
+	MaxBackoff time.Duration
+	// Budget is the total time that may be spent waiting between retries
+	// over the lifetime of the client, or over each BudgetPeriod if set.
+	Budget time.Duration
+	// BudgetPeriod is the period after which the retry budget is renewed.
+	// The budget is never renewed if unset.
+	BudgetPeriod time.Duration
+}
+
+// RetryingClient is an HTTPClient retrying requests which failed with a transport
+// error, a 429 or a 5xx status code, using exponential backoff with jitter.
+// Retry-After headers are honored, and delay every request sent through the
+// client until then, so that concurrent requests back off together. Once the
+// retry budget is spent, the last response or error is returned as is.
+// It is safe for concurrent use.
+type RetryingClient struct {
+	Client api.HTTPClient
+	Policy RetryPolicy
+
+	mu      sync.Mutex
+	spent   time.Duration
+	renewed time.Time
+	// until is the time before which requests wait, as set by Retry-After headers.
+	until time.Time
+}
+
+// NewRetryingClient returns a client retrying requests according to the policy.
+func NewRetryingClient(client api.HTTPClient, policy RetryPolicy) *RetryingClient {
+	return &RetryingClient{
+		Client: client,
+		Policy: policy,
+	}
+}
+
+func isRetryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the given retry, using exponential backoff with equal jitter.
+func (c *RetryingClient) backoff(retry int) time.Duration {
+	d := c.Policy.InitialBackoff
+	for i := 0; i < retry && d < c.Policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.Policy.MaxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// reserve reserves the delay from the retry budget, returning false if the budget would be exceeded.
+// If shared is true, other requests also wait for the delay before being sent.
+func (c *RetryingClient) reserve(delay time.Duration, shared bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.Policy.BudgetPeriod > 0 && now.Sub(c.renewed) >= c.Policy.BudgetPeriod {
+		c.spent = 0
+		c.renewed = now
+	}
+	if c.spent+delay > c.Policy.Budget {
+		return false
+	}
+	c.spent += delay
+	if until := now.Add(delay); shared && until.After(c.until) {
+		c.until = until
+	}
+	return true
+}
+
+// wait returns the delay before requests may be sent, as set by Retry-After headers.
+func (c *RetryingClient) wait() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return max(time.Until(c.until), 0)
+}
+
+// delay returns the delay before the given retry, and true if it was set by a Retry-After header.
+func (c *RetryingClient) delay(res *http.Response, retry int) (time.Duration, bool) {
+	if res != nil {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			return d, true
+		}
+	}
+	return c.backoff(retry), false
+}
+
+// Do implements the HTTPClient's Do interface.
+func (c *RetryingClient) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if d := c.wait(); d > 0 {
+			if err := sleep(req, d); err != nil {
+				return nil, err
+			}
+		}
+		res, err := c.Client.Do(req)
+		if !isRetryable(res, err) || attempt >= c.Policy.MaxAttempts || req.Context().Err() != nil {
+			return res, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+		delay, retryAfter := c.delay(res, attempt-1)
+		if !c.reserve(delay, retryAfter) {
+			_ = log.Warn("retry budget exhausted", map[string]interface{}{
+				"url": req.URL.String(),
+			})
+			return res, err
+		}
+		fields := map[string]interface{}{
+			"url":     req.URL.String(),
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			fields["status_code"] = res.StatusCode
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		_ = log.Warn("retrying request", fields)
+		if err := sleep(req, delay); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func sleep(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
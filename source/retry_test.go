@@ -0,0 +1,187 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		title    string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{title: "Empty"},
+		{title: "Seconds", value: "120", expected: 2 * time.Minute, ok: true},
+		{title: "Date", value: "Mon, 01 Jan 2024 00:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{title: "PastDate", value: "Sun, 31 Dec 2023 23:00:00 GMT", ok: true},
+		{title: "Invalid", value: "hoge"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			actual, ok := parseRetryAfter(tc.value, now)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestRetryingClient(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		title            string
+		failures         int32
+		status           int
+		retryAfter       string
+		policy           RetryPolicy
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{
+			title:            "Success",
+			failures:         2,
+			status:           http.StatusServiceUnavailable,
+			policy:           RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Budget: time.Second},
+			expectedStatus:   http.StatusOK,
+			expectedAttempts: 3,
+		},
+		{
+			title:            "MaxAttempts",
+			failures:         5,
+			status:           http.StatusInternalServerError,
+			policy:           RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Budget: time.Second},
+			expectedStatus:   http.StatusInternalServerError,
+			expectedAttempts: 2,
+		},
+		{
+			title:            "RetryAfterOverBudget",
+			failures:         1,
+			status:           http.StatusTooManyRequests,
+			retryAfter:       "3600",
+			policy:           RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Budget: time.Second},
+			expectedStatus:   http.StatusTooManyRequests,
+			expectedAttempts: 1,
+		},
+		{
+			title:            "NotRetryable",
+			failures:         1,
+			status:           http.StatusNotFound,
+			policy:           RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Budget: time.Second},
+			expectedStatus:   http.StatusNotFound,
+			expectedAttempts: 1,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.title, func(t *testing.T) {
+			t.Parallel()
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if attempts.Add(1) <= tc.failures {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(tc.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(server.Close)
+			client := NewRetryingClient(http.DefaultClient, tc.policy)
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			assert.NoError(t, err)
+			res, err := client.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res.Body.Close()
+			assert.Equal(t, tc.expectedStatus, res.StatusCode)
+			assert.Equal(t, tc.expectedAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestRetryingClientSharedRetryAfter(t *testing.T) {
+	t.Parallel()
+	limited := make(chan struct{})
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			close(limited)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	client := NewRetryingClient(http.DefaultClient, RetryPolicy{MaxAttempts: 3, Budget: time.Minute})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, err := fetch(context.Background(), client, server.URL)
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	}()
+	<-limited
+	// Requests sent after a Retry-After header wait as well.
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	_, err := fetch(context.Background(), client, server.URL)
+	assert.NoError(t, err)
+	assert.Greater(t, time.Since(start), 500*time.Millisecond)
+	<-done
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestRetryingClientBudgetPeriod(t *testing.T) {
+	t.Parallel()
+	client := NewRetryingClient(http.DefaultClient, RetryPolicy{Budget: time.Second, BudgetPeriod: 50 * time.Millisecond})
+	assert.True(t, client.reserve(time.Second, false))
+	assert.False(t, client.reserve(time.Millisecond, false))
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, client.reserve(time.Second, false))
+}
+
+func TestSourceRetryCanceled(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewRetryingClient(http.DefaultClient, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Budget: 24 * time.Hour})
+	sources := map[string]IssuanceSource{
+		"Certspotter": &CertspotterSource{Client: api.CertspotterClient{Endpoint: server.URL, Client: client}},
+		"CTLog":       &CTLogSource{Logs: []CTLog{{URL: server.URL}}, Client: client},
+		"StaticCT":    &StaticCTSource{Logs: []CTLog{{URL: server.URL}}, Client: client},
+		"Crtsh":       &CrtshSource{Endpoint: server.URL, Client: client},
+	}
+	for title, src := range sources {
+		src := src
+		t.Run(title, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			cursor := Cursor{CTLog{URL: server.URL}.CursorKey(): 1}
+			_, next, err := src.GetIssuances(ctx, Query{Domain: "example.com"}, cursor)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Equal(t, cursor, next)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package source
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	x509EntryType        uint16 = 0
+	precertEntryType     uint16 = 1
+	leafVersionV1        uint8  = 0
+	timestampedEntryLeaf uint8  = 0
+)
+
+// ErrMalformedEntry is returned when a CT log entry cannot be parsed.
+var ErrMalformedEntry = fmt.Errorf("malformed log entry")
+
+// logEntry represents a parsed CT log entry.
+type logEntry struct {
+	entryType uint16
+	// cert is the leaf certificate, or the precertificate for precert entries.
+	cert []byte
+	// tbs is the TBSCertificate as logged for precert entries.
+	tbs []byte
+	// issuerKeyHash is the SHA256 of the issuer's public key for precert entries.
+	issuerKeyHash []byte
+	// issuer is the issuing certificate if it is known.
+	issuer []byte
+}
+
+// readTimestampedEntry reads a TimestampedEntry structure as defined in RFC 6962 section 3.4.
+func readTimestampedEntry(s *cryptobyte.String, e *logEntry) bool {
+	var timestamp uint64
+	var extensions cryptobyte.String
+	if !s.ReadUint64(&timestamp) || !s.ReadUint16(&e.entryType) {
+		return false
+	}
+	switch e.entryType {
+	case x509EntryType:
+		if !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.cert)) {
+			return false
+		}
+	case precertEntryType:
+		if !s.ReadBytes(&e.issuerKeyHash, 32) || !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.tbs)) {
+			return false
+		}
+	default:
+		return false
+	}
+	return s.ReadUint16LengthPrefixed(&extensions)
+}
+
+// parseMerkleTreeLeaf parses the leaf_input of a get-entries response,
+// which is a MerkleTreeLeaf as defined in RFC 6962 section 3.4.
+func parseMerkleTreeLeaf(leafInput []byte, e *logEntry) error {
+	s := cryptobyte.String(leafInput)
+	var version, leafType uint8
+	if !s.ReadUint8(&version) || version != leafVersionV1 {
+		return ErrMalformedEntry
+	}
+	if !s.ReadUint8(&leafType) || leafType != timestampedEntryLeaf {
+		return ErrMalformedEntry
+	}
+	if !readTimestampedEntry(&s, e) || !s.Empty() {
+		return ErrMalformedEntry
+	}
+	return nil
+}
+
+// parseExtraData parses the extra_data of a get-entries response, which contains
+// the precertificate for precert entries, followed by the certificate chain.
+func parseExtraData(extraData []byte, e *logEntry) error {
+	s := cryptobyte.String(extraData)
+	if e.entryType == precertEntryType && !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&e.cert)) {
+		return ErrMalformedEntry
+	}
+	var chain, issuer cryptobyte.String
+	if !s.ReadUint24LengthPrefixed(&chain) {
+		return ErrMalformedEntry
+	}
+	if !chain.Empty() && chain.ReadUint24LengthPrefixed(&issuer) {
+		e.issuer = issuer
+	}
+	return nil
+}
+
+// toIssuance converts the entry to an Issuance if it matches the query.
+func (e *logEntry) toIssuance(id uint64, q Query) (api.Issuance, bool, error) {
+	cert, err := x509.ParseCertificate(e.cert)
+	if err != nil {
+		return api.Issuance{}, false, err
+	}
+	if !q.Matches(cert.DNSNames) {
+		return api.Issuance{}, false, nil
+	}
+	var issuer *x509.Certificate
+	if len(e.issuer) > 0 {
+		// The issuer is only used for informational purposes, ignore parse errors.
+		issuer, _ = x509.ParseCertificate(e.issuer)
+	}
+	issuance, err := NewIssuance(id, cert, issuer, hex.EncodeToString(e.issuerKeyHash))
+	if err != nil {
+		return api.Issuance{}, false, err
+	}
+	if e.entryType == precertEntryType {
+		// Use the TBSCertificate as logged since the issuer may have been
+		// rewritten if the precertificate was issued by a precertificate signing certificate.
+		if issuance.TBSSHA256, err = TBSSHA256(e.tbs); err != nil {
+			return api.Issuance{}, false, err
+		}
+	}
+	return issuance, true, nil
+}
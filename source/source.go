@@ -0,0 +1,45 @@
+package source
+
+import (
+	"context"
+
+	"github.com/Hsn723/certspotter-client/api"
+)
+
+const (
+	// DefaultCursorKey is the cursor key used by sources reading from a single stream.
+	DefaultCursorKey = ""
+)
+
+// Query represents the domain an IssuanceSource is queried for.
+type Query struct {
+	// Domain is the FQDN of the domain to query for.
+	Domain string
+	// MatchWildcards should be set to true to include wildcards.
+	MatchWildcards bool
+	// IncludeSubdomains should be set to true if subdomains should also be scanned.
+	IncludeSubdomains bool
+}
+
+// Cursor holds the positions from which a source resumes for a given domain.
+// Sources reading from a single stream use DefaultCursorKey, while sources
+// reading from several streams, such as individual CT logs, keep one entry per stream.
+type Cursor map[string]uint64
+
+// Clone returns a copy of the cursor.
+func (c Cursor) Clone() Cursor {
+	res := make(Cursor, len(c))
+	for k, v := range c {
+		res[k] = v
+	}
+	return res
+}
+
+// IssuanceSource is the interface for backends providing certificate issuances.
+type IssuanceSource interface {
+	// GetIssuances returns issuances observed after the given cursor,
+	// along with the cursor to resume from on the next call.
+	// Implementations must not modify the cursor passed as argument, and
+	// should give up on requests, including retries, when ctx is canceled.
+	GetIssuances(ctx context.Context, q Query, cursor Cursor) ([]api.Issuance, Cursor, error)
+}
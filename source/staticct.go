@@ -0,0 +1,340 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"github.com/cybozu-go/log"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	staticCTTileHeight = 8
+	staticCTTileWidth  = 1 << staticCTTileHeight
+)
+
+var (
+	// ErrMalformedCheckpoint is returned when a checkpoint cannot be parsed.
+	ErrMalformedCheckpoint = fmt.Errorf("malformed checkpoint")
+	// ErrTileMismatch is returned when a data tile does not match the checkpoint tree hash.
+	ErrTileMismatch = fmt.Errorf("data tile does not match checkpoint")
+)
+
+// StaticCTSource is an IssuanceSource tailing CT logs through the Static CT API.
+// Data tiles are verified against the checkpoint tree hash before being used.
+// Each log keeps its own cursor. Logs are tailed from their current tree
+// size the first time they are seen for a given domain. Tiles fetched are
+// shared by all domains when the source is obtained with WithClient.
+type StaticCTSource struct {
+	// Logs is the list of CT logs to tail. URL is the monitoring prefix of the log.
+	Logs []CTLog `mapstructure:"logs"`
+	// MaxEntries is the maximum number of entries scanned per log on each call.
+	// This defaults to 16384.
+	MaxEntries uint64 `mapstructure:"max_entries"`
+	Client     api.HTTPClient
+
+	cache *logCache[staticCTState]
+	// issuers caches issuing certificates by fingerprint. Since entries are
+	// content-addressed, the cache is shared across logs.
+	issuers *sync.Map
+}
+
+// staticCTState caches the checkpoint, and the hash tiles and verified data
+// tiles fetched from a log within its window. Its lock is held while the log is scanned, so that
+// concurrent scans of the same log wait for tiles being fetched instead of
+// fetching them again.
+type staticCTState struct {
+	mu     sync.Mutex
+	tree   *tlog.Tree
+	reader *tileReader
+	hashes tlog.HashReader
+	// tiles holds verified data tiles by tile index.
+	tiles  map[int64][]tileLeaf
+	window logWindow
+}
+
+// tileLeaf represents a parsed TileLeaf from a data tile.
+type tileLeaf struct {
+	entry logEntry
+	// merkleTreeLeaf is the MerkleTreeLeaf the leaf hash is computed from.
+	merkleTreeLeaf []byte
+	// issuerFingerprint is the SHA256 of the issuing certificate.
+	issuerFingerprint []byte
+}
+
+// tileReader implements tlog.TileReader for a Static CT API log.
+// Verified tiles are cached until they are evicted from the window of the log.
+// Tiles are fetched with ctx, which is set to the context of the current scan.
+type tileReader struct {
+	ctx    context.Context
+	source *StaticCTSource
+	log    CTLog
+	cache  map[tlog.Tile][]byte
+}
+
+func (r *tileReader) Height() int {
+	return staticCTTileHeight
+}
+
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	res := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		if data, ok := r.cache[t]; ok {
+			res[i] = data
+			continue
+		}
+		data, err := r.source.fetch(r.ctx, tileURL(r.log, t))
+		if err != nil {
+			return nil, err
+		}
+		res[i] = data
+	}
+	return res, nil
+}
+
+func (r *tileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {
+	for i, t := range tiles {
+		r.cache[t] = data[i]
+	}
+}
+
+func tileURL(l CTLog, t tlog.Tile) string {
+	// The Static CT API omits the tile height from tile paths.
+	path := strings.Replace(t.Path(), fmt.Sprintf("tile/%d/", t.H), "tile/", 1)
+	return strings.TrimSuffix(l.URL, "/") + "/" + path
+}
+
+func (s *StaticCTSource) fetch(ctx context.Context, url string) ([]byte, error) {
+	if s.Client == nil {
+		s.Client = http.DefaultClient
+	}
+	return fetch(ctx, s.Client, url)
+}
+
+// getCheckpoint retrieves the tree size and root hash from the log's checkpoint.
+// The checkpoint signature is not verified.
+func (s *StaticCTSource) getCheckpoint(ctx context.Context, l CTLog) (tlog.Tree, error) {
+	body, err := s.fetch(ctx, strings.TrimSuffix(l.URL, "/")+"/checkpoint")
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	lines := strings.SplitN(string(body), "\n", 4)
+	if len(lines) < 4 {
+		return tlog.Tree{}, ErrMalformedCheckpoint
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil || size < 0 {
+		return tlog.Tree{}, ErrMalformedCheckpoint
+	}
+	rawHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(rawHash) != tlog.HashSize {
+		return tlog.Tree{}, ErrMalformedCheckpoint
+	}
+	tree := tlog.Tree{N: size}
+	copy(tree.Hash[:], rawHash)
+	return tree, nil
+}
+
+func (s *StaticCTSource) getIssuer(ctx context.Context, l CTLog, fingerprint []byte) ([]byte, error) {
+	key := hex.EncodeToString(fingerprint)
+	if s.issuers != nil {
+		if issuer, ok := s.issuers.Load(key); ok {
+			return issuer.([]byte), nil
+		}
+	}
+	issuer, err := s.fetch(ctx, strings.TrimSuffix(l.URL, "/")+"/issuer/"+key)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(issuer); !bytes.Equal(sum[:], fingerprint) {
+		return nil, fmt.Errorf("issuer %s does not match its fingerprint", key)
+	}
+	if s.issuers != nil {
+		s.issuers.Store(key, issuer)
+	}
+	return issuer, nil
+}
+
+// parseDataTile parses the TileLeaf entries of a data tile.
+func parseDataTile(data []byte, width int) ([]tileLeaf, error) {
+	s := cryptobyte.String(data)
+	leaves := make([]tileLeaf, 0, width)
+	for !s.Empty() {
+		var leaf tileLeaf
+		entry := s
+		if !readTimestampedEntry(&s, &leaf.entry) {
+			return nil, ErrMalformedEntry
+		}
+		leaf.merkleTreeLeaf = append([]byte{leafVersionV1, timestampedEntryLeaf}, entry[:len(entry)-len(s)]...)
+		if leaf.entry.entryType == precertEntryType && !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&leaf.entry.cert)) {
+			return nil, ErrMalformedEntry
+		}
+		var chain cryptobyte.String
+		if !s.ReadUint16LengthPrefixed(&chain) || len(chain)%sha256.Size != 0 {
+			return nil, ErrMalformedEntry
+		}
+		if !chain.Empty() {
+			leaf.issuerFingerprint = chain[:sha256.Size]
+		}
+		leaves = append(leaves, leaf)
+	}
+	if len(leaves) != width {
+		return nil, fmt.Errorf("%w: expected %d entries in data tile, got %d", ErrMalformedEntry, width, len(leaves))
+	}
+	return leaves, nil
+}
+
+// readDataTile retrieves the data tile containing the given index and verifies it against the tree.
+func (s *StaticCTSource) readDataTile(ctx context.Context, l CTLog, state *staticCTState, index uint64) ([]tileLeaf, uint64, error) {
+	n := int64(index / staticCTTileWidth)
+	offset := n * staticCTTileWidth
+	if leaves, ok := state.tiles[n]; ok {
+		return leaves, uint64(offset), nil
+	}
+	t := tlog.Tile{H: staticCTTileHeight, L: -1, N: n, W: int(min(staticCTTileWidth, state.tree.N-offset))}
+	data, err := s.fetch(ctx, tileURL(l, t))
+	if err != nil {
+		return nil, 0, err
+	}
+	leaves, err := parseDataTile(data, t.W)
+	if err != nil {
+		return nil, 0, err
+	}
+	indexes := make([]int64, t.W)
+	for i := range indexes {
+		indexes[i] = tlog.StoredHashIndex(0, offset+int64(i))
+	}
+	hashes, err := state.hashes.ReadHashes(indexes)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, leaf := range leaves {
+		if tlog.RecordHash(leaf.merkleTreeLeaf) != hashes[i] {
+			return nil, 0, fmt.Errorf("%w: entry %d", ErrTileMismatch, offset+int64(i))
+		}
+	}
+	state.tiles[n] = leaves
+	return leaves, uint64(offset), nil
+}
+
+func (s *StaticCTSource) toIssuance(ctx context.Context, l CTLog, index uint64, leaf tileLeaf, q Query) (api.Issuance, bool, error) {
+	if leaf.entry.entryType == x509EntryType && leaf.issuerFingerprint != nil {
+		issuer, err := s.getIssuer(ctx, l, leaf.issuerFingerprint)
+		if err != nil {
+			// The issuer is only used for informational purposes.
+			_ = log.Warn("could not retrieve issuer", map[string]interface{}{
+				"log":   l.URL,
+				"index": index,
+				"error": err.Error(),
+			})
+		}
+		leaf.entry.issuer = issuer
+	}
+	return leaf.entry.toIssuance(l.issuanceID(index), q)
+}
+
+// scanLog scans the log from the given index and returns matching issuances
+// along with the index to resume from. The checkpoint is cached for the
+// lifetime of the source, and tiles for as long as they are within the window of the log.
+func (s *StaticCTSource) scanLog(ctx context.Context, l CTLog, q Query, start uint64, resume bool) ([]api.Issuance, uint64, error) {
+	state := s.cache.get(l)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.tree == nil {
+		tree, err := s.getCheckpoint(ctx, l)
+		if err != nil {
+			return nil, start, err
+		}
+		state.tree = &tree
+		state.reader = &tileReader{source: s, log: l, cache: make(map[tlog.Tile][]byte)}
+		state.hashes = tlog.TileHashReader(tree, state.reader)
+		state.tiles = make(map[int64][]tileLeaf)
+	}
+	state.reader.ctx = ctx
+	if !resume {
+		return nil, uint64(state.tree.N), nil
+	}
+	res, position, err := s.scanTiles(ctx, l, state, q, start)
+	state.evict(q, start, position, err != nil || position >= uint64(state.tree.N), maxEntriesOrDefault(s.MaxEntries))
+	return res, position, err
+}
+
+func (s *StaticCTSource) scanTiles(ctx context.Context, l CTLog, state *staticCTState, q Query, start uint64) ([]api.Issuance, uint64, error) {
+	end := min(uint64(state.tree.N), start+maxEntriesOrDefault(s.MaxEntries))
+	var res []api.Issuance
+	for start < end {
+		leaves, offset, err := s.readDataTile(ctx, l, state, start)
+		if err != nil {
+			return res, start, err
+		}
+		for ; start < end && start-offset < uint64(len(leaves)); start++ {
+			issuance, ok, err := s.toIssuance(ctx, l, start, leaves[start-offset], q)
+			if err != nil {
+				_ = log.Warn("skipping malformed log entry", map[string]interface{}{
+					"log":   l.URL,
+					"index": start,
+					"error": err.Error(),
+				})
+				continue
+			}
+			if ok {
+				res = append(res, issuance)
+			}
+		}
+	}
+	return res, start, nil
+}
+
+// evict drops the cached data tiles and hash tiles which do not cover any
+// entry within the window of the log.
+func (st *staticCTState) evict(q Query, start, position uint64, done bool, maxEntries uint64) {
+	low, high := st.window.update(q, start, position, done, maxEntries)
+	for n := range st.tiles {
+		if !tileOverlaps(0, n, low, high) {
+			delete(st.tiles, n)
+		}
+	}
+	for t := range st.reader.cache {
+		if !tileOverlaps(t.L, t.N, low, high) {
+			delete(st.reader.cache, t)
+		}
+	}
+}
+
+// tileOverlaps returns true if the tile at the given level, where level 0
+// and data tiles hash or hold entries, covers an entry in [low, high).
+func tileOverlaps(level int, n int64, low, high uint64) bool {
+	shift := staticCTTileHeight * (max(level, 0) + 1)
+	if shift >= 64 {
+		return true
+	}
+	first := uint64(n) << shift
+	last := (uint64(n)+1)<<shift - 1
+	return first < high && last >= low
+}
+
+// WithClient returns a copy of the source using the given client, with empty
+// caches of fetched tiles and issuers. The copy should be used for a single run, so that
+// entries are fetched once per run and shared by all domains.
+func (s *StaticCTSource) WithClient(client api.HTTPClient) *StaticCTSource {
+	res := *s
+	res.Client = client
+	res.cache = &logCache[staticCTState]{}
+	res.issuers = &sync.Map{}
+	return &res
+}
+
+// GetIssuances implements the IssuanceSource's GetIssuances interface.
+func (s *StaticCTSource) GetIssuances(ctx context.Context, q Query, cursor Cursor) ([]api.Issuance, Cursor, error) {
+	return scanLogs(ctx, s.Logs, q, cursor, s.scanLog)
+}
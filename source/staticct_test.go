@@ -0,0 +1,244 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// fakeStaticLog is a minimal Static CT API log serving a fixed tree.
+type fakeStaticLog struct {
+	issuer *x509.Certificate
+	leaves [][]byte
+	hashes []tlog.Hash
+	files  map[string][]byte
+	// requests counts the requests served.
+	requests int
+}
+
+func (l *fakeStaticLog) add(t *testing.T, cert *x509.Certificate, precert bool) {
+	t.Helper()
+	var entry cryptobyte.Builder
+	addTimestampedEntry(&entry, cert, l.issuer, precert)
+	merkleTreeLeaf := append([]byte{leafVersionV1, timestampedEntryLeaf}, entry.BytesOrPanic()...)
+	hashes, err := tlog.StoredHashes(int64(len(l.leaves)), merkleTreeLeaf, tlog.HashReaderFunc(l.readHashes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.hashes = append(l.hashes, hashes...)
+	if precert {
+		entry.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cert.Raw)
+		})
+	}
+	fingerprint := sha256.Sum256(l.issuer.Raw)
+	entry.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(fingerprint[:])
+	})
+	l.leaves = append(l.leaves, entry.BytesOrPanic())
+}
+
+func (l *fakeStaticLog) readHashes(indexes []int64) ([]tlog.Hash, error) {
+	res := make([]tlog.Hash, len(indexes))
+	for i, index := range indexes {
+		res[i] = l.hashes[index]
+	}
+	return res, nil
+}
+
+// publish builds the checkpoint, hash tiles and data tiles for the current tree.
+func (l *fakeStaticLog) publish(t *testing.T) {
+	t.Helper()
+	n := int64(len(l.leaves))
+	hr := tlog.HashReaderFunc(l.readHashes)
+	root, err := tlog.TreeHash(n, hr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := sha256.Sum256(l.issuer.Raw)
+	l.files = map[string][]byte{
+		"/checkpoint": []byte(fmt.Sprintf("example.com/log\n%d\n%s\n\n— example.com/log AAAA\n", n, base64.StdEncoding.EncodeToString(root[:]))),
+		"/issuer/" + hex.EncodeToString(fingerprint[:]): l.issuer.Raw,
+	}
+	for _, tile := range tlog.NewTiles(staticCTTileHeight, 0, n) {
+		data, err := tlog.ReadTileData(tile, hr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.files[tileURL(CTLog{}, tile)] = data
+		if tile.L != 0 {
+			continue
+		}
+		tile.L = -1
+		var buf []byte
+		for _, leaf := range l.leaves[tile.N*staticCTTileWidth : tile.N*staticCTTileWidth+int64(tile.W)] {
+			buf = append(buf, leaf...)
+		}
+		l.files[tileURL(CTLog{}, tile)] = buf
+	}
+}
+
+func (l *fakeStaticLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.requests++
+	data, ok := l.files[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func TestStaticCTSourceGetIssuances(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeStaticLog{issuer: ca.cert}
+	filler := ca.issue(t, 2, false, "other.example.org")
+	for i := 0; i < 300; i++ {
+		switch i {
+		case 10:
+			fl.add(t, ca.issue(t, 3, false, "www.example.com"), false)
+		case 270:
+			fl.add(t, ca.issue(t, 4, true, "example.com"), true)
+		default:
+			fl.add(t, filler, false)
+		}
+	}
+	fl.publish(t)
+	server := httptest.NewServer(fl)
+	defer server.Close()
+
+	l := CTLog{URL: server.URL}
+	src := &StaticCTSource{Logs: []CTLog{l}}
+	q := Query{Domain: "example.com", IncludeSubdomains: true}
+
+	issuances, cursor, err := src.GetIssuances(context.Background(), q, Cursor{})
+	assert.NoError(t, err)
+	assert.Empty(t, issuances)
+	assert.Equal(t, Cursor{l.CursorKey(): 300}, cursor)
+
+	issuances, cursor, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 5})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 300}, cursor)
+	if assert.Len(t, issuances, 2) {
+		assert.Equal(t, l.issuanceID(10), issuances[0].ID)
+		assert.Equal(t, hexSHA256(ca.cert.RawSubjectPublicKeyInfo), issuances[0].Issuer.PubKeySHA256)
+		assert.Equal(t, l.issuanceID(270), issuances[1].ID)
+		assert.Equal(t, "precert", issuances[1].Cert.Type)
+	}
+
+	src.MaxEntries = 100
+	issuances, cursor, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 200})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 1)
+	assert.Equal(t, Cursor{l.CursorKey(): 300}, cursor)
+
+	issuances, cursor, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 11})
+	assert.NoError(t, err)
+	assert.Empty(t, issuances)
+	assert.Equal(t, Cursor{l.CursorKey(): 111}, cursor)
+
+	tampered := fl.files["/tile/data/001.p/44"]
+	fl.files["/tile/data/001.p/44"] = append([]byte{}, tampered...)
+	fl.files["/tile/data/001.p/44"][100] ^= 0xff
+	_, cursor, err = src.GetIssuances(context.Background(), q, Cursor{l.CursorKey(): 260})
+	assert.ErrorIs(t, err, ErrNoLogs)
+	assert.Equal(t, Cursor{l.CursorKey(): 260}, cursor)
+}
+
+func TestStaticCTSourceSharedTiles(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeStaticLog{issuer: ca.cert}
+	fl.add(t, ca.issue(t, 2, false, "www.example.org"), false)
+	fl.add(t, ca.issue(t, 3, false, "www.example.com"), false)
+	fl.publish(t)
+	server := httptest.NewServer(fl)
+	defer server.Close()
+
+	l := CTLog{URL: server.URL}
+	src := (&StaticCTSource{Logs: []CTLog{l}}).WithClient(http.DefaultClient)
+	issuances, _, err := src.GetIssuances(context.Background(), Query{Domain: "example.com", IncludeSubdomains: true}, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 1)
+	requests := fl.requests
+
+	issuances, cursor, err := src.GetIssuances(context.Background(), Query{Domain: "example.org", IncludeSubdomains: true}, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Len(t, issuances, 1)
+	assert.Equal(t, Cursor{l.CursorKey(): 2}, cursor)
+	assert.Equal(t, requests, fl.requests)
+}
+
+func TestStaticCTSourceEvictsTiles(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	fl := &fakeStaticLog{issuer: ca.cert}
+	filler := ca.issue(t, 2, false, "www.example.com")
+	for i := 0; i < 600; i++ {
+		fl.add(t, filler, false)
+	}
+	fl.publish(t)
+	server := httptest.NewServer(fl)
+	defer server.Close()
+
+	l := CTLog{URL: server.URL}
+	src := (&StaticCTSource{Logs: []CTLog{l}, MaxEntries: staticCTTileWidth}).WithClient(http.DefaultClient)
+	state := src.cache.get(l)
+	slow := Query{Domain: "example.com", IncludeSubdomains: true}
+	fast := Query{Domain: "www.example.com"}
+
+	_, cursor, err := src.GetIssuances(context.Background(), slow, Cursor{l.CursorKey(): 0})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 256}, cursor)
+	_, cursor, err = src.GetIssuances(context.Background(), fast, Cursor{l.CursorKey(): 256})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 512}, cursor)
+	_, cursor, err = src.GetIssuances(context.Background(), fast, Cursor{l.CursorKey(): 512})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 600}, cursor)
+
+	// Only the tiles from the position of the slowest domain are kept.
+	tiles := []int64{}
+	for n := range state.tiles {
+		tiles = append(tiles, n)
+	}
+	assert.Equal(t, []int64{1}, tiles)
+	for tile := range state.reader.cache {
+		assert.True(t, tileOverlaps(tile.L, tile.N, 256, 512), tile)
+	}
+	requests := fl.requests
+	_, cursor, err = src.GetIssuances(context.Background(), slow, Cursor{l.CursorKey(): 256})
+	assert.NoError(t, err)
+	assert.Equal(t, Cursor{l.CursorKey(): 512}, cursor)
+	assert.Equal(t, requests, fl.requests)
+
+	// Issuers are cached for a single run.
+	_, ok := src.issuers.Load(hexSHA256(ca.cert.Raw))
+	assert.True(t, ok)
+	next := (&StaticCTSource{Logs: []CTLog{l}}).WithClient(http.DefaultClient)
+	_, ok = next.issuers.Load(hexSHA256(ca.cert.Raw))
+	assert.False(t, ok)
+}
+
+func TestTileOverlaps(t *testing.T) {
+	t.Parallel()
+	assert.True(t, tileOverlaps(-1, 1, 256, 512))
+	assert.True(t, tileOverlaps(0, 1, 300, 400))
+	assert.False(t, tileOverlaps(0, 0, 256, 512))
+	assert.False(t, tileOverlaps(0, 2, 256, 512))
+	assert.True(t, tileOverlaps(1, 0, 256, 512))
+	assert.False(t, tileOverlaps(1, 1, 256, 512))
+}
@@ -0,0 +1,149 @@
+package source
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/Hsn723/certspotter-client/api"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const (
+	// certType and precertType are the types of certificates in issuances.
+	certType    = "cert"
+	precertType = "precert"
+)
+
+var (
+	oidCTPoison  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidSCTList   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	extensionTag = cbasn1.Tag(3).Constructed().ContextSpecific()
+
+	// ErrMalformedTBS is returned when a TBSCertificate cannot be parsed.
+	ErrMalformedTBS = fmt.Errorf("malformed TBSCertificate")
+)
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TBSSHA256 returns the hex-encoded SHA256 digest of the given TBSCertificate,
+// with the CT poison and embedded SCT list extensions removed, so that a
+// precertificate and its final certificate yield the same digest.
+func TBSSHA256(rawTBS []byte) (string, error) {
+	input := cryptobyte.String(rawTBS)
+	var tbs cryptobyte.String
+	if !input.ReadASN1(&tbs, cbasn1.SEQUENCE) {
+		return "", ErrMalformedTBS
+	}
+	var b cryptobyte.Builder
+	var err error
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !tbs.Empty() {
+			var element cryptobyte.String
+			var tag cbasn1.Tag
+			if !tbs.ReadAnyASN1Element(&element, &tag) {
+				err = ErrMalformedTBS
+				return
+			}
+			if tag != extensionTag {
+				b.AddBytes(element)
+				continue
+			}
+			if err = addFilteredExtensions(b, element); err != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	res, err := b.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return hexSHA256(res), nil
+}
+
+func addFilteredExtensions(b *cryptobyte.Builder, element cryptobyte.String) error {
+	var wrapper, extensions cryptobyte.String
+	if !element.ReadASN1(&wrapper, extensionTag) || !wrapper.ReadASN1(&extensions, cbasn1.SEQUENCE) {
+		return ErrMalformedTBS
+	}
+	var kept [][]byte
+	for !extensions.Empty() {
+		var ext, body cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		if !extensions.ReadASN1Element(&ext, cbasn1.SEQUENCE) {
+			return ErrMalformedTBS
+		}
+		raw := ext
+		if !raw.ReadASN1(&body, cbasn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&oid) {
+			return ErrMalformedTBS
+		}
+		if oid.Equal(oidCTPoison) || oid.Equal(oidSCTList) {
+			continue
+		}
+		kept = append(kept, ext)
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	b.AddASN1(extensionTag, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			for _, ext := range kept {
+				b.AddBytes(ext)
+			}
+		})
+	})
+	return nil
+}
+
+// NewIssuance builds an Issuance from a certificate or precertificate.
+// The issuer may be nil if it is not known, in which case only the issuer's
+// public key hash, if provided, is recorded.
+func NewIssuance(id uint64, cert, issuer *x509.Certificate, issuerKeySHA256 string) (api.Issuance, error) {
+	tbsSHA256, err := TBSSHA256(cert.RawTBSCertificate)
+	if err != nil {
+		return api.Issuance{}, err
+	}
+	certSHA256 := hexSHA256(cert.Raw)
+	if issuer != nil {
+		issuerKeySHA256 = hexSHA256(issuer.RawSubjectPublicKeyInfo)
+	}
+	return api.Issuance{
+		ID:           id,
+		TBSSHA256:    tbsSHA256,
+		Domains:      cert.DNSNames,
+		PubKeySHA256: hexSHA256(cert.RawSubjectPublicKeyInfo),
+		Issuer: api.Issuer{
+			Name:         cert.Issuer.String(),
+			PubKeySHA256: issuerKeySHA256,
+		},
+		NotBefore: cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:  cert.NotAfter.UTC().Format(time.RFC3339),
+		Cert: api.Certificate{
+			Type:   certificateType(cert),
+			SHA256: certSHA256,
+			Data:   base64.StdEncoding.EncodeToString(cert.Raw),
+		},
+		CertDER:    base64.StdEncoding.EncodeToString(cert.Raw),
+		CertSHA256: certSHA256,
+	}, nil
+}
+
+func certificateType(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidCTPoison) {
+			return precertType
+		}
+	}
+	return certType
+}
@@ -0,0 +1,28 @@
+//go:build test
+// +build test
+
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTBSSHA256(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+	precert := ca.issue(t, 2, true, "example.com")
+	cert := ca.issue(t, 2, false, "example.com")
+	// Certificates only differ by their CT extensions.
+	precertHash, err := TBSSHA256(precert.RawTBSCertificate)
+	assert.NoError(t, err)
+	certHash, err := TBSSHA256(cert.RawTBSCertificate)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hexSHA256(precert.RawTBSCertificate), precertHash)
+	assert.NotEqual(t, hexSHA256(cert.RawTBSCertificate), certHash)
+	assert.Equal(t, precertHash, certHash)
+
+	_, err = TBSSHA256([]byte{0x30, 0x03, 0x02})
+	assert.ErrorIs(t, err, ErrMalformedTBS)
+}